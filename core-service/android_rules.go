@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Rule types sent by the Android parent app
+const (
+	AndroidRuleDailyLimit  = "daily_limit"
+	AndroidRuleBedtime     = "bedtime"
+	AndroidRuleSchoolHours = "school_hours"
+	AndroidRuleBreak       = "break"
+)
+
+const minutesPerDay = 24 * 60
+
+// normalizeAndroidRuleType maps the spellings used by different app versions
+// ("DAILY_LIMIT", "dailyLimit", "School Hours"...) to one of the rule types
+func normalizeAndroidRuleType(ruleType string) string {
+	key := strings.ToLower(ruleType)
+	key = strings.NewReplacer("_", "", "-", "", " ", "").Replace(key)
+
+	switch key {
+	case "dailylimit", "limit", "screentime", "dailyscreentime":
+		return AndroidRuleDailyLimit
+	case "bedtime", "sleep", "sleeptime", "night":
+		return AndroidRuleBedtime
+	case "schoolhours", "school", "schooltime", "study", "studytime":
+		return AndroidRuleSchoolHours
+	case "break", "breaks", "breakreminder", "mandatorybreak":
+		return AndroidRuleBreak
+	}
+	return key
+}
+
+// appliesTo reports whether the rule covers weekdays (weekend = false) or weekends.
+// Days use java.time.DayOfWeek numbering (1 = Monday ... 7 = Sunday, 0 is also
+// accepted for Sunday); no days means every day.
+func (r *AndroidTimeRule) appliesTo(weekend bool) bool {
+	if len(r.DaysOfWeek) == 0 {
+		return true
+	}
+	for _, day := range r.DaysOfWeek {
+		isWeekend := day == 6 || day == 7 || day == 0
+		if isWeekend == weekend {
+			return true
+		}
+	}
+	return false
+}
+
+// coversAllDays reports whether the rule lists every day of its weekday/weekend group.
+// The PC only has one rule per group, so a partial group is widened to the whole group.
+func (r *AndroidTimeRule) coversAllDays(weekend bool) bool {
+	if len(r.DaysOfWeek) == 0 {
+		return true
+	}
+	days := make(map[int]bool)
+	for _, day := range r.DaysOfWeek {
+		if day == 0 {
+			day = 7
+		}
+		days[day] = true
+	}
+	if weekend {
+		return days[6] && days[7]
+	}
+	for day := 1; day <= 5; day++ {
+		if !days[day] {
+			return false
+		}
+	}
+	return true
+}
+
+// blockedWindow returns the slot a bedtime or school-hours rule blocks
+func (r *AndroidTimeRule) blockedWindow(ruleType string) (TimeSlot, bool) {
+	slot := TimeSlot{StartTime: r.StartTime, EndTime: r.EndTime}
+	if ruleType == AndroidRuleBedtime && r.BedtimeStart != "" && r.BedtimeEnd != "" {
+		slot = TimeSlot{StartTime: r.BedtimeStart, EndTime: r.BedtimeEnd}
+	}
+	if slot.StartTime == "" || slot.EndTime == "" || slotSegments(slot) == nil {
+		return TimeSlot{}, false
+	}
+	return slot, true
+}
+
+// dayRuleBuilder combines every Android rule that applies to one day group,
+// keeping the most restrictive value of each setting
+type dayRuleBuilder struct {
+	enabled       bool
+	dailyLimit    int
+	breakInterval int
+	breakDuration int
+	allowed       []bool // Minutes allowed by every rule with allowed slots (nil = no restriction)
+	blocked       []bool // Minutes blocked by any rule
+}
+
+func (b *dayRuleBuilder) add(rule *AndroidTimeRule) error {
+	ruleType := normalizeAndroidRuleType(rule.RuleType)
+
+	// Validate the windows first so an invalid rule leaves the day untouched
+	var window TimeSlot
+	hasWindow := ruleType == AndroidRuleBedtime || ruleType == AndroidRuleSchoolHours
+	if hasWindow {
+		slot, ok := rule.blockedWindow(ruleType)
+		if !ok {
+			return fmt.Errorf("%s rule has no valid start/end time", ruleType)
+		}
+		window = slot
+	}
+	for _, slot := range rule.AllowedSlots {
+		if slotSegments(slot) == nil {
+			return fmt.Errorf("invalid allowed slot %s-%s", slot.StartTime, slot.EndTime)
+		}
+	}
+
+	b.enabled = true
+
+	// Lowest daily limit wins
+	if rule.DailyLimitMinutes > 0 && (b.dailyLimit == 0 || rule.DailyLimitMinutes < b.dailyLimit) {
+		b.dailyLimit = rule.DailyLimitMinutes
+	}
+
+	// Most frequent and longest break wins
+	if rule.BreakIntervalMinutes > 0 && (b.breakInterval == 0 || rule.BreakIntervalMinutes < b.breakInterval) {
+		b.breakInterval = rule.BreakIntervalMinutes
+	}
+	if rule.BreakDurationMinutes > b.breakDuration {
+		b.breakDuration = rule.BreakDurationMinutes
+	}
+
+	if hasWindow {
+		if b.blocked == nil {
+			b.blocked = make([]bool, minutesPerDay)
+		}
+		markSlotMinutes(b.blocked, window, true)
+	}
+
+	// Allowed slots narrow each other: a minute is allowed only if every rule allows it
+	if len(rule.AllowedSlots) > 0 {
+		minutes := make([]bool, minutesPerDay)
+		for _, slot := range rule.AllowedSlots {
+			markSlotMinutes(minutes, slot, true)
+		}
+		if b.allowed == nil {
+			b.allowed = minutes
+		} else {
+			for i := range b.allowed {
+				b.allowed[i] = b.allowed[i] && minutes[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (b *dayRuleBuilder) build() DayRule {
+	rule := DayRule{
+		Enabled:              b.enabled,
+		DailyLimitMinutes:    b.dailyLimit,
+		BreakIntervalMinutes: b.breakInterval,
+		BreakDurationMinutes: b.breakDuration,
+		AllowedSlots:         []TimeSlot{},
+		BlockedSlots:         []TimeSlot{},
+	}
+
+	if b.allowed != nil && !isWholeDay(b.allowed) {
+		rule.AllowedSlots = minutesToSlots(b.allowed)
+		if len(rule.AllowedSlots) == 0 {
+			// Allowed slots that never overlap leave no time at all
+			rule.AllowedSlots = []TimeSlot{}
+			rule.BlockedSlots = []TimeSlot{{StartTime: "00:00", EndTime: "23:59"}}
+			return rule
+		}
+	}
+	if b.blocked != nil {
+		rule.BlockedSlots = minutesToSlots(b.blocked)
+	}
+	return rule
+}
+
+// markSlotMinutes sets the minutes covered by a slot (half-open, wraps past midnight)
+func markSlotMinutes(minutes []bool, slot TimeSlot, value bool) {
+	for _, segment := range slotSegments(slot) {
+		for m := segment[0]; m < segment[1]; m++ {
+			minutes[m] = value
+		}
+	}
+}
+
+func isWholeDay(minutes []bool) bool {
+	for _, set := range minutes {
+		if !set {
+			return false
+		}
+	}
+	return true
+}
+
+// minutesToSlots turns a minute map back into slots. A run reaching midnight is
+// joined with a run starting at 00:00 into one overnight slot.
+func minutesToSlots(minutes []bool) []TimeSlot {
+	var runs [][2]int
+	for m := 0; m < minutesPerDay; m++ {
+		if !minutes[m] {
+			continue
+		}
+		start := m
+		for m < minutesPerDay && minutes[m] {
+			m++
+		}
+		runs = append(runs, [2]int{start, m})
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+
+	if len(runs) == 1 && runs[0][0] == 0 && runs[0][1] == minutesPerDay {
+		return []TimeSlot{{StartTime: "00:00", EndTime: "23:59"}}
+	}
+
+	last := len(runs) - 1
+	if len(runs) > 1 && runs[0][0] == 0 && runs[last][1] == minutesPerDay {
+		runs[0][0] = runs[last][0]
+		runs = runs[:last]
+	}
+
+	slots := make([]TimeSlot, 0, len(runs))
+	for _, run := range runs {
+		end := run[1]
+		if end == minutesPerDay {
+			end = minutesPerDay - 1
+		}
+		slots = append(slots, TimeSlot{StartTime: formatClock(run[0]), EndTime: formatClock(end)})
+	}
+	return slots
+}
+
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// latestAndroidRuleEdit returns when the parent last changed any rule on Android
+func latestAndroidRuleEdit(androidRules map[string]*AndroidTimeRule) time.Time {
+	var latest int64
+	for _, rule := range androidRules {
+		if rule == nil {
+			continue
+		}
+		if rule.UpdatedAt > latest {
+			latest = rule.UpdatedAt
+		}
+		if rule.CreatedAt > latest {
+			latest = rule.CreatedAt
+		}
+	}
+	if latest == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(latest)
+}
+
+// convertAndroidRulesToPCFormat converts Android time rules to PC TimeRules format.
+// Each active rule is applied to the day groups it covers; when several rules
+// apply, the most restrictive combination is kept (lowest limit, most frequent
+// break, union of blocked windows, intersection of allowed slots).
+func (fs *FirebaseService) convertAndroidRulesToPCFormat(androidRules map[string]*AndroidTimeRule) *TimeRules {
+	var weekdays, weekends dayRuleBuilder
+
+	for key, rule := range androidRules {
+		if rule == nil || !rule.Active {
+			continue
+		}
+
+		log.Printf("🕐 Processing rule: %s (type: %s, days: %v, daily limit: %d min)",
+			rule.Name, rule.RuleType, rule.DaysOfWeek, rule.DailyLimitMinutes)
+
+		for _, group := range []struct {
+			weekend bool
+			name    string
+			builder *dayRuleBuilder
+		}{{false, "weekdays", &weekdays}, {true, "weekends", &weekends}} {
+			if !rule.appliesTo(group.weekend) {
+				continue
+			}
+			if !rule.coversAllDays(group.weekend) {
+				log.Printf("🕐 Rule %s covers only some %s, applying it to all %s", key, group.name, group.name)
+			}
+			if err := group.builder.add(rule); err != nil {
+				log.Printf("⚠️ Rule %s (%s) skipped for %s: %v", key, rule.Name, group.name, err)
+			}
+		}
+	}
+
+	pcRules := &TimeRules{
+		Weekdays: weekdays.build(),
+		Weekends: weekends.build(),
+	}
+
+	if !pcRules.Weekdays.Enabled && !pcRules.Weekends.Enabled {
+		log.Printf("🕐 No active time rules found")
+		return pcRules
+	}
+
+	for _, day := range []struct {
+		name string
+		rule DayRule
+	}{{"weekdays", pcRules.Weekdays}, {"weekends", pcRules.Weekends}} {
+		log.Printf("🕐 Converted %s: enabled=%v, daily limit=%d min, break %d/%d min, allowed %v, blocked %v",
+			day.name, day.rule.Enabled, day.rule.DailyLimitMinutes, day.rule.BreakIntervalMinutes,
+			day.rule.BreakDurationMinutes, day.rule.AllowedSlots, day.rule.BlockedSlots)
+	}
+	return pcRules
+}
@@ -0,0 +1,246 @@
+// core-service/clock_guard.go
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Chính sách khi phát hiện đồng hồ hệ thống bị chỉnh
+const (
+	ClockPolicyIgnore = "ignore" // Chỉ ghi log và audit
+	ClockPolicyBlock  = "block"  // Chặn mạng cho tới khi đồng hồ được chỉnh lại đúng
+	ClockPolicyAlert  = "alert"  // Báo cho phụ huynh (mặc định)
+)
+
+// Độ lệch tối đa giữa đồng hồ hệ thống và đồng hồ đơn điệu trước khi coi là bị chỉnh.
+// Đủ lớn để bỏ qua các lần đồng bộ NTP thông thường.
+const clockTamperThreshold = 2 * time.Minute
+
+// Key trong service_state lưu thời điểm cuối cùng đồng hồ được tin cậy
+const clockLastSeenKey = "clock_last_seen"
+
+// Sự kiện phát hiện đồng hồ bị chỉnh hoặc đã được chỉnh lại đúng
+type ClockTamperEvent struct {
+	Type          string    `json:"type"`   // clock_tamper_detected | clock_tamper_cleared
+	Source        string    `json:"source"` // startup | runtime | parent
+	DetectedAt    time.Time `json:"detected_at"`
+	ExpectedTime  time.Time `json:"expected_time"`
+	OffsetSeconds int64     `json:"offset_seconds"`
+	Policy        string    `json:"policy"`
+	Message       string    `json:"message"`
+}
+
+// Trạng thái đồng hồ hệ thống
+type ClockState struct {
+	Tampered      bool       `json:"tampered"`
+	OffsetSeconds int64      `json:"offset_seconds"`
+	Since         *time.Time `json:"since,omitempty"`
+	Policy        string     `json:"policy"`
+}
+
+// Set callback nhận sự kiện thay đổi đồng hồ
+func (tm *TimeManager) SetClockTamperCallback(callback func(event ClockTamperEvent)) {
+	tm.onClockTamper = callback
+}
+
+// Chính sách đang áp dụng (yêu cầu đã giữ mutex)
+func (tm *TimeManager) clockPolicyLocked() string {
+	if tm.rules != nil && tm.rules.ClockTamperPolicy != "" {
+		return tm.rules.ClockTamperPolicy
+	}
+	return ClockPolicyAlert
+}
+
+// So sánh đồng hồ lúc khởi động với thời điểm cuối cùng đã lưu. Nếu đồng hồ
+// hiện tại lùi về trước thời điểm đó thì coi thời điểm đã lưu là mốc tin cậy.
+func (tm *TimeManager) checkClockAtStartup() {
+	now := time.Now()
+	trusted := now.Round(0)
+
+	lastSeen, err := tm.loadClockLastSeen()
+	if err != nil {
+		log.Printf("⚠️ Không đọc được thời điểm đồng hồ đã lưu: %v", err)
+	} else if lastSeen.After(trusted.Add(clockTamperThreshold)) {
+		trusted = lastSeen
+	}
+
+	tm.mutex.Lock()
+	tm.clockAnchor = now
+	tm.clockAnchorWall = trusted
+	// Không biết máy đã tắt bao lâu nên mốc khởi động chỉ là giới hạn dưới
+	tm.clockAnchorIsFloor = trusted != now.Round(0)
+	event := tm.evaluateClockLocked(now, "startup")
+	tm.mutex.Unlock()
+
+	tm.finishClockCheck(now, event)
+}
+
+// Kiểm tra đồng hồ hệ thống so với đồng hồ đơn điệu trong mỗi lần tick
+func (tm *TimeManager) checkClock(now time.Time) {
+	tm.mutex.Lock()
+	if tm.clockAnchor.IsZero() {
+		tm.clockAnchor = now
+		tm.clockAnchorWall = now.Round(0)
+	}
+	event := tm.evaluateClockLocked(now, "runtime")
+	tm.mutex.Unlock()
+
+	tm.finishClockCheck(now, event)
+}
+
+// Tính độ lệch hiện tại và trả về sự kiện nếu trạng thái thay đổi (yêu cầu đã giữ mutex).
+// now phải có monotonic reading (lấy từ time.Now()).
+func (tm *TimeManager) evaluateClockLocked(now time.Time, source string) *ClockTamperEvent {
+	expected := tm.clockAnchorWall.Add(now.Sub(tm.clockAnchor))
+	offset := now.Round(0).Sub(expected)
+
+	// Mốc là giới hạn dưới: đồng hồ đã vượt qua mốc thì coi như đúng, lấy làm mốc mới
+	if tm.clockAnchorIsFloor && offset >= -clockTamperThreshold {
+		tm.clockAnchor = now
+		tm.clockAnchorWall = now.Round(0)
+		tm.clockAnchorIsFloor = false
+		expected = tm.clockAnchorWall
+		offset = 0
+	}
+	tm.clockOffset = offset
+
+	tampered := offset > clockTamperThreshold || offset < -clockTamperThreshold
+	if tampered == tm.clockTampered {
+		return nil
+	}
+
+	tm.clockTampered = tampered
+	event := &ClockTamperEvent{
+		Source:        source,
+		DetectedAt:    now.Round(0),
+		ExpectedTime:  expected,
+		OffsetSeconds: int64(offset.Seconds()),
+		Policy:        tm.clockPolicyLocked(),
+	}
+
+	if tampered {
+		tm.clockTamperSince = expected
+		event.Type = "clock_tamper_detected"
+		event.Message = fmt.Sprintf("Đồng hồ hệ thống bị lệch %s so với thời gian thực", offset.Round(time.Second))
+	} else {
+		tm.clockTamperSince = time.Time{}
+		event.Type = "clock_tamper_cleared"
+		event.Message = "Đồng hồ hệ thống đã được chỉnh lại đúng"
+	}
+	return event
+}
+
+// Lưu mốc tin cậy và gửi sự kiện (nếu có) sau khi đã nhả mutex
+func (tm *TimeManager) finishClockCheck(now time.Time, event *ClockTamperEvent) {
+	if !tm.IsClockTampered() {
+		if err := tm.saveClockLastSeen(now); err != nil {
+			log.Printf("⚠️ Không thể lưu thời điểm đồng hồ: %v", err)
+		}
+	}
+
+	if event == nil {
+		return
+	}
+
+	if event.Type == "clock_tamper_detected" {
+		log.Printf("🚨 Phát hiện chỉnh đồng hồ (%s): lệch %d giây, chính sách %s", event.Source, event.OffsetSeconds, event.Policy)
+	} else {
+		log.Printf("✅ Đồng hồ hệ thống đã trở lại bình thường (%s)", event.Source)
+	}
+
+	if tm.onClockTamper != nil {
+		go tm.onClockTamper(*event)
+	}
+}
+
+// Dời mốc theo thời gian máy ngủ khi đồng hồ đơn điệu không chạy lúc ngủ (Linux),
+// để khoảng ngủ không bị coi là chỉnh đồng hồ (yêu cầu đã giữ mutex)
+func (tm *TimeManager) acceptSuspendClockJumpLocked(sleep time.Duration) {
+	if tm.clockAnchor.IsZero() || tm.clockTampered {
+		return
+	}
+	tm.clockAnchorWall = tm.clockAnchorWall.Add(sleep)
+}
+
+// Phụ huynh xác nhận giờ hiện tại là đúng: lấy đồng hồ hiện tại làm mốc mới
+func (tm *TimeManager) AcknowledgeClockChange() *ClockTamperEvent {
+	now := time.Now()
+
+	tm.mutex.Lock()
+	tm.clockAnchor = now
+	tm.clockAnchorWall = now.Round(0)
+	tm.clockAnchorIsFloor = false
+	event := tm.evaluateClockLocked(now, "parent")
+	tm.mutex.Unlock()
+
+	tm.finishClockCheck(now, event)
+	go tm.checkTimeRules()
+	return event
+}
+
+// Đồng hồ có đang bị chỉnh không
+func (tm *TimeManager) IsClockTampered() bool {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return tm.clockTampered
+}
+
+// Có cần chặn vì đồng hồ bị chỉnh không
+func (tm *TimeManager) clockBlockActive() bool {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return tm.clockTampered && tm.clockPolicyLocked() == ClockPolicyBlock
+}
+
+// Lấy trạng thái đồng hồ hiện tại
+func (tm *TimeManager) GetClockState() ClockState {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return tm.clockStateLocked()
+}
+
+// Trạng thái đồng hồ (yêu cầu đã giữ mutex)
+func (tm *TimeManager) clockStateLocked() ClockState {
+	state := ClockState{
+		Tampered:      tm.clockTampered,
+		OffsetSeconds: int64(tm.clockOffset.Seconds()),
+		Policy:        tm.clockPolicyLocked(),
+	}
+	if !tm.clockTamperSince.IsZero() {
+		since := tm.clockTamperSince
+		state.Since = &since
+	}
+	return state
+}
+
+// Đọc thời điểm cuối cùng đồng hồ được tin cậy
+func (tm *TimeManager) loadClockLastSeen() (time.Time, error) {
+	if tm.db == nil {
+		return time.Time{}, nil
+	}
+
+	var value string
+	err := tm.db.QueryRow("SELECT value FROM service_state WHERE key = ?", clockLastSeenKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// Lưu thời điểm đồng hồ được tin cậy
+func (tm *TimeManager) saveClockLastSeen(t time.Time) error {
+	if tm.db == nil {
+		return nil
+	}
+
+	_, err := tm.db.Exec(`INSERT INTO service_state (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		clockLastSeenKey, t.Round(0).Format(time.RFC3339Nano))
+	return err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version reported to the parent app
+const serviceVersion = "1.0.0"
+
+// Keys in service_state holding the identity of this PC
+const (
+	deviceIDKey        = "device_id"
+	deviceNameKey      = "device_name"       // Shown in the parent app, defaults to the hostname
+	deviceProfileIDKey = "device_profile_id" // Profile of the child using this PC
+)
+
+// DeviceInfo is written to kidsafe/families/{uid}/devices/{deviceId}/info
+type DeviceInfo struct {
+	DeviceID     string `json:"deviceId"`
+	Name         string `json:"name"`
+	Hostname     string `json:"hostname"`
+	OS           string `json:"os"`
+	Version      string `json:"version"`
+	ProfileID    int    `json:"profileId"`
+	ProfileName  string `json:"profileName,omitempty"`
+	RegisteredAt int64  `json:"registeredAt"`
+	UpdatedAt    int64  `json:"updatedAt"`
+}
+
+// loadDeviceID returns the ID of this PC under the family's devices, created
+// on first use and kept across restarts
+func loadDeviceID(db *sql.DB) string {
+	if db == nil {
+		return hostDeviceID()
+	}
+
+	var deviceID string
+	err := db.QueryRow("SELECT value FROM service_state WHERE key = ?", deviceIDKey).Scan(&deviceID)
+	if err == nil && deviceID != "" {
+		return deviceID
+	}
+
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return hostDeviceID()
+	}
+	deviceID = "pc_" + hex.EncodeToString(random)
+
+	// INSERT OR IGNORE keeps the ID of a concurrent first start
+	db.Exec("INSERT OR IGNORE INTO service_state (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)", deviceIDKey, deviceID)
+	if err := db.QueryRow("SELECT value FROM service_state WHERE key = ?", deviceIDKey).Scan(&deviceID); err != nil {
+		log.Printf("Warning: could not save device ID: %v", err)
+	}
+	log.Printf("🖥️ Device ID created: %s", deviceID)
+	return deviceID
+}
+
+// hostDeviceID derives an ID from the computer name when nothing can be stored
+func hostDeviceID() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		name = "unknown"
+	}
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(name))
+	return fmt.Sprintf("pc_%s", name)
+}
+
+// appliesToDevice reports whether a rule targeted at devices applies to
+// deviceID; no devices means every device of the family
+func appliesToDevice(devices []string, deviceID string) bool {
+	if len(devices) == 0 {
+		return true
+	}
+	for _, device := range devices {
+		if device == deviceID || device == "*" || device == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+// targetsAllDevices reports whether devices covers every device: an empty list
+// or one naming "*" or "all"
+func targetsAllDevices(devices []string) bool {
+	if len(devices) == 0 {
+		return true
+	}
+	for _, device := range devices {
+		if device == "*" || device == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutDevice returns a copy of devices without deviceID
+func withoutDevice(devices []string, deviceID string) []string {
+	result := make([]string, 0, len(devices))
+	for _, device := range devices {
+		if device != deviceID {
+			result = append(result, device)
+		}
+	}
+	return result
+}
+
+// loadDeviceInfo describes this PC from the stored name and owner profile
+func loadDeviceInfo(db *sql.DB, deviceID string) DeviceInfo {
+	hostname, _ := os.Hostname()
+	info := DeviceInfo{
+		DeviceID:  deviceID,
+		Name:      hostname,
+		Hostname:  hostname,
+		OS:        runtime.GOOS + "/" + runtime.GOARCH,
+		Version:   serviceVersion,
+		ProfileID: 1,
+		UpdatedAt: time.Now().UnixMilli(),
+	}
+	if db == nil {
+		return info
+	}
+
+	var name, profileID string
+	if db.QueryRow("SELECT value FROM service_state WHERE key = ?", deviceNameKey).Scan(&name) == nil && name != "" {
+		info.Name = name
+	}
+	if db.QueryRow("SELECT value FROM service_state WHERE key = ?", deviceProfileIDKey).Scan(&profileID) == nil {
+		if id, err := strconv.Atoi(profileID); err == nil && id > 0 {
+			info.ProfileID = id
+		}
+	}
+	db.QueryRow("SELECT name FROM profiles WHERE id = ?", info.ProfileID).Scan(&info.ProfileName)
+	return info
+}
+
+// saveDeviceSettings stores the name and owner profile of this PC
+func saveDeviceSettings(db *sql.DB, name string, profileID int) error {
+	for key, value := range map[string]string{deviceNameKey: name, deviceProfileIDKey: strconv.Itoa(profileID)} {
+		_, err := db.Exec(`INSERT INTO service_state (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`, key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// How often this PC publishes its usage for the family-wide daily limit
+const familyUsagePublishInterval = time.Minute
+
+// Days of family usage kept in Firebase
+const familyUsageRetentionDays = 7
+
+// DeviceUsage is written by every device of the family to
+// kidsafe/families/{uid}/familyUsage/{date}/{deviceId}. A device writes its own
+// running total for the day rather than increments, so a write repeated after
+// an offline period never counts a minute twice and the latest values of all
+// devices always add up to the family total.
+type DeviceUsage struct {
+	DeviceID    string `json:"deviceId"`
+	ProfileID   int    `json:"profileId"`
+	ProfileName string `json:"profileName,omitempty"` // Identifies the child across devices
+	Minutes     int64  `json:"minutes"`
+	Active      bool   `json:"active"` // A session is running
+	UpdatedAt   int64  `json:"updatedAt"`
+}
+
+// sameChild reports whether two usage records belong to the same child. Profile
+// IDs are local to each PC, so the profile name is compared when both have one.
+func (u *DeviceUsage) sameChild(other *DeviceUsage) bool {
+	if u.ProfileName != "" && other.ProfileName != "" {
+		return strings.EqualFold(strings.TrimSpace(u.ProfileName), strings.TrimSpace(other.ProfileName))
+	}
+	return u.ProfileID == other.ProfileID
+}
+
+func (fs *FirebaseService) familyUsagePath() string {
+	return fmt.Sprintf("kidsafe/families/%s/familyUsage", fs.familyID)
+}
+
+// publishFamilyUsagePeriodically publishes the usage of this PC every minute.
+// Writes that fail while offline are simply made again on the next tick.
+func (fs *FirebaseService) publishFamilyUsagePeriodically() {
+	ticker := time.NewTicker(familyUsagePublishInterval)
+	defer ticker.Stop()
+
+	fs.publishDeviceUsage()
+	for {
+		select {
+		case <-ticker.C:
+			fs.publishDeviceUsage()
+		case <-fs.ctx.Done():
+			return
+		}
+	}
+}
+
+// currentDeviceUsage describes today's usage of this PC
+func (fs *FirebaseService) currentDeviceUsage(now time.Time) *DeviceUsage {
+	info := loadDeviceInfo(fs.database, fs.deviceID)
+	status := fs.coreService.timeManager.GetStatus()
+
+	usage := &DeviceUsage{
+		DeviceID:    fs.deviceID,
+		ProfileID:   info.ProfileID,
+		ProfileName: info.ProfileName,
+		UpdatedAt:   now.UnixMilli(),
+	}
+	usage.Minutes, _ = status["today_usage"].(int64)
+	_, usage.Active = status["session_duration"]
+	return usage
+}
+
+// publishDeviceUsage writes today's usage of this PC when it changed. After
+// midnight the previous day is written one last time with its final total.
+func (fs *FirebaseService) publishDeviceUsage() {
+	if fs.coreService == nil || fs.coreService.timeManager == nil {
+		return
+	}
+
+	now := time.Now()
+	today := now.Format(usageDateLayout)
+	usage := fs.currentDeviceUsage(now)
+
+	fs.mutex.Lock()
+	last, lastDate := fs.publishedUsage, fs.publishedUsageDate
+	fs.mutex.Unlock()
+
+	if last != nil && lastDate != today {
+		if err := fs.publishFinalUsage(lastDate, last); err != nil {
+			log.Printf("⚠️ Family usage for %s not published, will retry: %v", lastDate, err)
+			return
+		}
+		last = nil
+	}
+	if last != nil && last.Minutes == usage.Minutes && last.Active == usage.Active &&
+		last.ProfileID == usage.ProfileID && last.ProfileName == usage.ProfileName {
+		return
+	}
+
+	path := fmt.Sprintf("%s/%s/%s", fs.familyUsagePath(), today, fs.deviceID)
+	if err := fs.backend.Set(fs.ctx, path, usage); err != nil {
+		log.Printf("⚠️ Family usage not published, will retry: %v", err)
+		return
+	}
+
+	fs.mutex.Lock()
+	fs.publishedUsage, fs.publishedUsageDate = usage, today
+	fs.mutex.Unlock()
+}
+
+// publishFinalUsage writes the stored total of a past day
+func (fs *FirebaseService) publishFinalUsage(date string, last *DeviceUsage) error {
+	day, err := time.ParseInLocation(usageDateLayout, date, time.Local)
+	if err != nil {
+		return err
+	}
+	history, err := fs.coreService.timeManager.GetUsageHistory(day, day, false)
+	if err != nil {
+		return err
+	}
+
+	final := *last
+	final.Active = false
+	final.UpdatedAt = time.Now().UnixMilli()
+	if len(history) > 0 {
+		final.Minutes = history[0].Total
+	}
+	return fs.backend.Set(fs.ctx, fmt.Sprintf("%s/%s/%s", fs.familyUsagePath(), date, fs.deviceID), &final)
+}
+
+// listenForFamilyUsage follows the usage published by the devices of the family
+func (fs *FirebaseService) listenForFamilyUsage() {
+	path := fs.familyUsagePath()
+	log.Printf("👨‍👩‍👧 Starting family usage listener at: %s", path)
+
+	fs.followPath("Family usage", path, func(data json.RawMessage) {
+		var days map[string]map[string]*DeviceUsage
+		if err := json.Unmarshal(data, &days); err != nil {
+			log.Printf("❌ Invalid family usage data: %v", err)
+			return
+		}
+		fs.applyFamilyUsage(days)
+	})
+	log.Println("👨‍👩‍👧 Family usage listener stopped")
+}
+
+// applyFamilyUsage passes the usage of the child's other devices to the
+// TimeManager, which adds it to the local usage when checking the daily limit
+func (fs *FirebaseService) applyFamilyUsage(days map[string]map[string]*DeviceUsage) {
+	if fs.coreService == nil || fs.coreService.timeManager == nil {
+		return
+	}
+	tm := fs.coreService.timeManager
+
+	now := time.Now()
+	self := fs.currentDeviceUsage(now)
+	changed := false
+	for _, day := range []time.Time{startOfDay(now).AddDate(0, 0, -1), startOfDay(now)} {
+		date := day.Format(usageDateLayout)
+
+		var others int64
+		for deviceID, usage := range days[date] {
+			if usage == nil || deviceID == fs.deviceID || !self.sameChild(usage) {
+				continue
+			}
+			others += usage.Minutes
+		}
+		if tm.SetOtherDevicesUsage(date, others) && date == now.Format(usageDateLayout) {
+			log.Printf("👨‍👩‍👧 Other devices used %d minute(s) today", others)
+			changed = true
+		}
+	}
+
+	// Remove days nobody needs any more
+	oldest := startOfDay(now).AddDate(0, 0, -familyUsageRetentionDays).Format(usageDateLayout)
+	for date := range days {
+		if date < oldest {
+			go fs.backend.Set(fs.ctx, fs.familyUsagePath()+"/"+date, nil)
+		}
+	}
+
+	if changed {
+		go tm.checkTimeRules()
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/db"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+)
+
+// Environment variables that point the sync at another database
+const (
+	databaseURLEnvVar = "KIDSAFE_FIREBASE_DATABASE_URL"
+	// host:port of the local Realtime Database emulator (e.g. localhost:9000),
+	// optionally with ?ns=<database name>; same variable as the Firebase tools
+	databaseEmulatorEnvVar = "FIREBASE_DATABASE_EMULATOR_HOST"
+)
+
+// Hosts the service itself talks to, kept reachable while the network is
+// blocked: access tokens for the Admin SDK and the parent's sign-in. Only these
+// hosts are allowed, not www.googleapis.com, whose front ends also serve other
+// Google sites.
+var serviceAPIHosts = []string{
+	"oauth2.googleapis.com",
+	"identitytoolkit.googleapis.com",
+	"securetoken.googleapis.com",
+}
+
+// serviceHosts returns the Realtime Database host and the Google API hosts the
+// service needs to keep syncing and to verify the parent during a time block
+func serviceHosts() []string {
+	hosts := append([]string{}, serviceAPIHosts...)
+	if target, err := resolveDatabaseTarget(); err == nil {
+		if parsed, err := url.Parse(target.StreamURL); err == nil && parsed.Hostname() != "" {
+			hosts = append(hosts, parsed.Hostname())
+		}
+	}
+	return hosts
+}
+
+// Scopes needed to read the Realtime Database with service account credentials
+var databaseScopes = []string{
+	"https://www.googleapis.com/auth/firebase.database",
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
+// databaseTarget is where the Realtime Database is reached
+type databaseTarget struct {
+	SDKURL    string     // Passed to the Admin SDK
+	StreamURL string     // Base URL of the streaming REST API
+	Query     url.Values // Extra query parameters for streaming (emulator namespace)
+	Emulator  bool
+}
+
+// FirebaseBackend syncs with the Realtime Database: reads and writes go through
+// the Admin SDK, changes are followed over the REST streaming API
+type FirebaseBackend struct {
+	client      *db.Client
+	target      databaseTarget
+	tokenSource oauth2.TokenSource // Access tokens for streaming, nil for anonymous access
+}
+
+// NewFirebaseBackend connects with service account credentials, or anonymously
+// (public read access only) when credentialsPath is empty
+func NewFirebaseBackend(ctx context.Context, credentialsPath string) (*FirebaseBackend, error) {
+	target, err := resolveDatabaseTarget()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &firebase.Config{DatabaseURL: target.SDKURL}
+	var opts []option.ClientOption
+	if credentialsPath != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsPath))
+	} else {
+		config.ProjectID = "kidsafe-control"
+	}
+
+	app, err := firebase.NewApp(ctx, config, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Firebase app: %v", err)
+	}
+
+	client, err := app.Database(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Database client: %v", err)
+	}
+
+	backend := &FirebaseBackend{client: client, target: target}
+
+	// Access tokens for the streaming REST API (the SDK client only polls).
+	// The emulator accepts a fixed admin token instead.
+	if credentialsPath != "" && !target.Emulator {
+		backend.tokenSource, err = newDatabaseTokenSource(ctx, credentialsPath)
+		if err != nil {
+			log.Printf("⚠️ Streaming unavailable, falling back to polling: %v", err)
+		}
+	}
+	return backend, nil
+}
+
+func (b *FirebaseBackend) Name() string {
+	switch {
+	case b.target.Emulator:
+		return fmt.Sprintf("emulator at %s (ns=%s)", b.target.StreamURL, b.target.Query.Get("ns"))
+	case b.tokenSource == nil:
+		return fmt.Sprintf("unauthenticated streaming from %s", b.target.StreamURL)
+	}
+	return fmt.Sprintf("streaming from %s", b.target.StreamURL)
+}
+
+func (b *FirebaseBackend) Get(ctx context.Context, path string, v interface{}) error {
+	return b.client.NewRef(path).Get(ctx, v)
+}
+
+func (b *FirebaseBackend) Set(ctx context.Context, path string, v interface{}) error {
+	return b.client.NewRef(path).Set(ctx, v)
+}
+
+func (b *FirebaseBackend) Listen(ctx context.Context, path string, onChange func(data json.RawMessage)) error {
+	stream := &RTDBStream{
+		BaseURL:  b.target.StreamURL,
+		Path:     path,
+		Query:    b.target.Query,
+		OnChange: onChange,
+	}
+	if b.target.Emulator {
+		stream.Header = http.Header{"Authorization": {"Bearer owner"}}
+	}
+	if b.tokenSource != nil {
+		stream.Token = b.accessToken
+	}
+	return stream.Run(ctx)
+}
+
+func (b *FirebaseBackend) accessToken(ctx context.Context) (string, error) {
+	token, err := b.tokenSource.Token()
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// newDatabaseTokenSource creates access tokens from the service account credentials
+func newDatabaseTokenSource(ctx context.Context, credentialsPath string) (oauth2.TokenSource, error) {
+	data, err := os.ReadFile(credentialsPath)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := google.CredentialsFromJSON(ctx, data, databaseScopes...)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.TokenSource, nil
+}
+
+// resolveDatabaseTarget uses the emulator when FIREBASE_DATABASE_EMULATOR_HOST
+// is set, otherwise the configured database URL
+func resolveDatabaseTarget() (databaseTarget, error) {
+	databaseURL := configuredDatabaseURL()
+
+	emulatorHost := os.Getenv(databaseEmulatorEnvVar)
+	if emulatorHost == "" {
+		return databaseTarget{SDKURL: databaseURL, StreamURL: databaseURL}, nil
+	}
+
+	host, rawQuery, _ := strings.Cut(emulatorHost, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil || host == "" || strings.Contains(host, "/") {
+		return databaseTarget{}, fmt.Errorf("invalid %s '%s' (use host:port, e.g. localhost:9000)", databaseEmulatorEnvVar, emulatorHost)
+	}
+
+	// The emulator keeps one database per namespace, named like the real one
+	namespace := query.Get("ns")
+	if namespace == "" {
+		parsed, err := url.Parse(databaseURL)
+		if err != nil || parsed.Hostname() == "" {
+			return databaseTarget{}, fmt.Errorf("cannot derive emulator namespace from '%s', set %s=%s?ns=<name>",
+				databaseURL, databaseEmulatorEnvVar, host)
+		}
+		namespace, _, _ = strings.Cut(parsed.Hostname(), ".")
+	}
+
+	log.Printf("🧪 Using Realtime Database emulator at %s (ns=%s)", host, namespace)
+	return databaseTarget{
+		SDKURL:    fmt.Sprintf("%s?ns=%s", host, url.QueryEscape(namespace)),
+		StreamURL: "http://" + host,
+		Query:     url.Values{"ns": {namespace}},
+		Emulator:  true,
+	}, nil
+}
+
+// configuredDatabaseURL returns the database URL from KIDSAFE_FIREBASE_DATABASE_URL,
+// then the databaseURL field of firebase-config.json, then the KidSafe project default
+func configuredDatabaseURL() string {
+	if databaseURL := os.Getenv(databaseURLEnvVar); databaseURL != "" {
+		return databaseURL
+	}
+
+	execPath, _ := os.Executable()
+	execDir := filepath.Dir(execPath)
+	configPaths := []string{
+		"firebase-config.json",
+		filepath.Join(execDir, "firebase-config.json"),
+		"../firebase-config.json",
+		"../ui-admin/firebase-config.json",
+	}
+
+	for _, path := range configPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var config struct {
+			DatabaseURL string `json:"databaseURL"`
+		}
+		if err := json.Unmarshal(data, &config); err == nil && config.DatabaseURL != "" {
+			log.Printf("Using Firebase database URL from %s: %s", path, config.DatabaseURL)
+			return config.DatabaseURL
+		}
+	}
+	return firebaseDatabaseURL
+}
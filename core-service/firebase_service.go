@@ -3,23 +3,24 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
-
-	firebase "firebase.google.com/go/v4"
-	"firebase.google.com/go/v4/db"
-	"google.golang.org/api/option"
 )
 
+// Realtime Database of the KidSafe project, used unless configured otherwise
+const firebaseDatabaseURL = "https://kidsafe-control-default-rtdb.asia-southeast1.firebasedatabase.app/"
+
 // Firebase service configuration
 type FirebaseService struct {
-	app          *firebase.App
-	client       *db.Client
+	backend      SyncBackend
 	familyID     string
+	deviceID     string // This PC under kidsafe/families/{uid}/devices
 	userEmail    string // Add email field to calculate LocalAuth UID
 	hostsManager *HostsManager
 	database     *sql.DB      // Add database reference for syncing
@@ -30,6 +31,15 @@ type FirebaseService struct {
 	mutex        sync.Mutex
 	blockedUrls  map[string]*BlockedUrl
 	timeRules    map[string]*AndroidTimeRule // Track time rules from Android
+
+	usageUploadMutex   sync.Mutex // Serializes queue flushes triggered by the timer and by block/unblock events
+	remoteCommandMutex sync.Mutex // Serializes command execution; commands run one at a time in creation order
+
+	blockedUrlsPath string // Blocked URLs location being followed, rule changes are pushed there
+	rulesMerged     bool   // A blocked URLs snapshot has been merged since start
+
+	publishedUsage     *DeviceUsage // Last usage of this PC written to familyUsage
+	publishedUsageDate string
 }
 
 // BlockedUrl represents a URL blocked by the parent app
@@ -39,6 +49,12 @@ type BlockedUrl struct {
 	AddedAt int64  `json:"addedAt"`
 	AddedBy string `json:"addedBy"`
 	Status  string `json:"status"`
+
+	// Last edit in milliseconds, set by the PC and newer app versions
+	UpdatedAt int64 `json:"updatedAt,omitempty"`
+
+	// Device IDs the rule applies to, empty = every device of the family
+	Devices []string `json:"devices,omitempty"`
 }
 
 // AndroidTimeRule represents a time rule from Android app
@@ -51,46 +67,63 @@ type AndroidTimeRule struct {
 	DailyLimitMinutes    int    `json:"dailyLimitMinutes"`
 	Description          string `json:"description"`
 	Name                 string `json:"name"`
-	RuleType             string `json:"ruleType"`
+	RuleType             string `json:"ruleType"` // daily_limit, bedtime, school_hours or break
 	UpdatedAt            int64  `json:"updatedAt"`
+
+	// Days the rule applies to (1 = Monday ... 7 = Sunday), empty = every day
+	DaysOfWeek []int `json:"daysOfWeek,omitempty"`
+
+	// Window for school hours (blocked) and bedtime when the bedtime fields are not set, HH:MM
+	StartTime string `json:"startTime,omitempty"`
+	EndTime   string `json:"endTime,omitempty"`
+
+	// Bedtime window, may wrap past midnight (e.g. 21:30-06:30)
+	BedtimeStart string `json:"bedtimeStart,omitempty"`
+	BedtimeEnd   string `json:"bedtimeEnd,omitempty"`
+
+	// Slots when the device may be used; several rules narrow each other
+	AllowedSlots []TimeSlot `json:"allowedSlots,omitempty"`
+
+	// Device IDs the rule applies to, empty = every device of the family
+	Devices []string `json:"devices,omitempty"`
 }
 
-// PCStatus represents the status of the PC application
+// PCStatus represents the status of the PC application, written to
+// kidsafe/families/{uid}/devices/{deviceId}/status
 type PCStatus struct {
+	DeviceID       string `json:"deviceId"`
 	LastSeen       int64  `json:"lastSeen"`
 	Status         string `json:"status"`
 	Version        string `json:"version"`
 	HostFileStatus string `json:"hostFileStatus"`
 	BlockedCount   int    `json:"blockedCount"`
+
+	// System clock tampering, reported unless the policy is "ignore"
+	ClockTampered      bool  `json:"clockTampered"`
+	ClockOffsetSeconds int64 `json:"clockOffsetSeconds,omitempty"`
 }
 
 // NewFirebaseService creates a new Firebase service instance
 func NewFirebaseService(credentialsPath string, userUID string, hostsManager *HostsManager, database *sql.DB, coreService *CoreService) (*FirebaseService, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// Initialize Firebase app
-	opt := option.WithCredentialsFile(credentialsPath)
-	config := &firebase.Config{
-		DatabaseURL: "https://kidsafe-control-default-rtdb.asia-southeast1.firebasedatabase.app/",
-	}
-
-	app, err := firebase.NewApp(ctx, config, opt)
+	backend, err := NewFirebaseBackend(context.Background(), credentialsPath)
 	if err != nil {
-		cancel()
-		return nil, fmt.Errorf("error initializing Firebase app: %v", err)
+		return nil, err
 	}
 
-	// Get database client
-	client, err := app.Database(ctx)
-	if err != nil {
-		cancel()
-		return nil, fmt.Errorf("error getting Database client: %v", err)
-	}
+	fs := NewFirebaseServiceWithBackend(backend, userUID, hostsManager, database, coreService)
+	log.Printf("Firebase service initialized for user: %s", userUID)
+	return fs, nil
+}
+
+// NewFirebaseServiceWithBackend creates a Firebase service that syncs with the
+// given backend (e.g. FakeSyncBackend to run the sync pipeline offline)
+func NewFirebaseServiceWithBackend(backend SyncBackend, userUID string, hostsManager *HostsManager, database *sql.DB, coreService *CoreService) *FirebaseService {
+	ctx, cancel := context.WithCancel(context.Background())
 
-	fs := &FirebaseService{
-		app:          app,
-		client:       client,
+	return &FirebaseService{
+		backend:      backend,
 		familyID:     userUID,
+		deviceID:     loadDeviceID(database),
 		userEmail:    "", // Will be set later if available
 		hostsManager: hostsManager,
 		database:     database,
@@ -101,9 +134,6 @@ func NewFirebaseService(credentialsPath string, userUID string, hostsManager *Ho
 		blockedUrls:  make(map[string]*BlockedUrl),
 		timeRules:    make(map[string]*AndroidTimeRule),
 	}
-
-	log.Printf("Firebase service initialized for user: %s", userUID)
-	return fs, nil
 }
 
 // SetCoreService sets the core service reference (used to avoid circular dependency)
@@ -120,17 +150,37 @@ func (fs *FirebaseService) Start() error {
 		return fmt.Errorf("Firebase service is already listening")
 	}
 
+	// Register this PC under the family's devices
+	go fs.registerDevice()
+
 	// Start listening for blocked URLs changes
 	go fs.listenForBlockedUrls()
 
 	// Start listening for time rules changes
 	go fs.listenForTimeRules()
 
+	// Start listening for bonus time grants
+	go fs.listenForTimeGrants()
+
 	// Update PC status periodically
 	go fs.updatePCStatusPeriodically()
 
+	// Publish daily usage for the parent app
+	go fs.uploadUsagePeriodically()
+
+	// Retry rule changes made on the PC while offline
+	go fs.pushRuleChangesPeriodically()
+
+	// Execute commands sent from the parent app
+	fs.failInterruptedCommands()
+	go fs.listenForCommands()
+
+	// Share usage with the family's other devices for the daily limit
+	go fs.publishFamilyUsagePeriodically()
+	go fs.listenForFamilyUsage()
+
 	fs.isListening = true
-	log.Println("Firebase service started successfully")
+	log.Printf("Firebase service started successfully (%s)", fs.backend.Name())
 	return nil
 }
 
@@ -181,363 +231,118 @@ func (fs *FirebaseService) listenForBlockedUrls() {
 		log.Printf("   Path %d: %s", i+1, path)
 	}
 
-	// Start polling all possible paths
-	fs.optimizedPollingMultiplePaths(possiblePaths)
-}
-
-// optimizedPollingMultiplePaths polls multiple Firebase paths to find data
-func (fs *FirebaseService) optimizedPollingMultiplePaths(paths []string) {
-	pollInterval := 2 * time.Second
-	maxInterval := 30 * time.Second
-
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
-
-	consecutiveNoChanges := 0
-	var activePath string
+	// Stream the path that holds the data (polling only while the stream is down)
+	path := fs.discoverPath(possiblePaths)
+	log.Printf("📡 Following blocked URLs at: %s", path)
 
-	for {
-		select {
-		case <-ticker.C:
-			var foundData map[string]*BlockedUrl
-			var workingPath string
-
-			// Try each path until we find data
-			for _, path := range paths {
-				ref := fs.client.NewRef(path)
-				var urlsData map[string]*BlockedUrl
-
-				if err := ref.Get(fs.ctx, &urlsData); err != nil {
-					log.Printf("❌ Error checking path %s: %v", path, err)
-					continue
-				}
-
-				// Debug: Also try different data structures
-				if len(urlsData) == 0 {
-					// Try as array structure
-					var urlsArray []*BlockedUrl
-					if err := ref.Get(fs.ctx, &urlsArray); err == nil && len(urlsArray) > 0 {
-						log.Printf("🔍 Found array data at path: %s (%d URLs)", path, len(urlsArray))
-						// Convert array to map
-						urlsData = make(map[string]*BlockedUrl)
-						for i, url := range urlsArray {
-							if url != nil {
-								key := fmt.Sprintf("url_%d", i)
-								urlsData[key] = url
-							}
-						}
-					} else {
-						// Try as generic interface to see raw structure
-						var rawData interface{}
-						if err := ref.Get(fs.ctx, &rawData); err == nil && rawData != nil {
-							log.Printf("🔍 Found raw data at path %s: %+v", path, rawData)
-						}
-					}
-				}
-
-				if len(urlsData) > 0 {
-					foundData = urlsData
-					workingPath = path
-
-					// If this is a new working path, log it
-					if activePath != workingPath {
-						log.Printf("✅ Found data at path: %s (%d URLs)", workingPath, len(urlsData))
-						activePath = workingPath
-
-						// Debug: Print first few URLs
-						count := 0
-						for key, url := range urlsData {
-							if count < 3 && url != nil {
-								log.Printf("   Sample URL %d: %s -> %s (status: %s)", count+1, key, url.URL, url.Status)
-								count++
-							}
-						}
-					}
-					break
-				}
-			}
-
-			if foundData == nil {
-				log.Printf("[FIREBASE] No data found in any path (checked %d paths)", len(paths))
-				consecutiveNoChanges++
-
-				if consecutiveNoChanges > 5 && pollInterval < maxInterval {
-					pollInterval = time.Duration(float64(pollInterval) * 1.2)
-					if pollInterval > maxInterval {
-						pollInterval = maxInterval
-					}
-					ticker.Reset(pollInterval)
-					log.Printf("[FIREBASE] Adjusting poll interval to %v", pollInterval)
-				}
-				continue
-			}
-
-			// Check if data changed
-			fs.mutex.Lock()
-			changed := len(fs.blockedUrls) != len(foundData)
-			if !changed {
-				// Check for additions or modifications
-				for k, v := range foundData {
-					if existing, ok := fs.blockedUrls[k]; !ok || existing.URL != v.URL || existing.Status != v.Status {
-						changed = true
-						break
-					}
-				}
-
-				// Check for deletions (items that exist in fs.blockedUrls but not in foundData)
-				if !changed {
-					for k := range fs.blockedUrls {
-						if _, exists := foundData[k]; !exists {
-							changed = true
-							log.Printf("🗑️ Detected deletion: %s no longer in Firebase data", k)
-							break
-						}
-					}
-				}
-			}
-
-			if changed {
-				log.Printf("🔥 Firebase data changed at %s: %d URLs found", activePath, len(foundData))
-				fs.blockedUrls = foundData
-				if fs.blockedUrls == nil {
-					fs.blockedUrls = make(map[string]*BlockedUrl)
-				}
-				fs.mutex.Unlock()
-
-				// Reset to fast polling after changes
-				pollInterval = 2 * time.Second
-				ticker.Reset(pollInterval)
-				consecutiveNoChanges = 0
-
-				var urls []string
-				for _, blockedUrl := range foundData {
-					if blockedUrl != nil && blockedUrl.Status == "active" {
-						cleanedUrl := fs.extractDomain(blockedUrl.URL)
-						if cleanedUrl != "" {
-							urls = append(urls, cleanedUrl)
-						}
-					}
-				}
-
-				// Force immediate hosts file update
-				log.Printf("🔄 Processing %d URLs for hosts file update...", len(urls))
-				for i, url := range urls {
-					log.Printf("   URL %d: %s", i+1, url)
-				}
-
-				if err := fs.updateHostsFile(urls); err != nil {
-					log.Printf("❌ Error updating hosts file: %v", err)
-				} else {
-					log.Printf("✅ Hosts file updated with %d URLs from %s", len(urls), activePath)
-
-					// Verify hosts file was actually updated
-					if fs.hostsManager != nil {
-						currentBlocked := fs.hostsManager.GetBlockedDomains()
-						log.Printf("✅ Hosts file now contains %d blocked domains", len(currentBlocked))
-					}
-				}
-
-				// FORCE save to local database for UI display
-				log.Printf("🔄 Syncing %d Firebase URLs to local database...", len(foundData))
-				if err := fs.syncToLocalDatabase(foundData); err != nil {
-					log.Printf("❌ Error syncing to local database: %v", err)
-				} else {
-					log.Printf("✅ Firebase URLs synced to local database successfully")
-
-					// Trigger database reload to refresh UI
-					log.Printf("🔄 Triggering database rules reload...")
-				}
-
-				go fs.updatePCStatus()
-			} else {
-				fs.mutex.Unlock()
-				consecutiveNoChanges++
-
-				if consecutiveNoChanges > 5 && pollInterval < maxInterval {
-					pollInterval = time.Duration(float64(pollInterval) * 1.2)
-					if pollInterval > maxInterval {
-						pollInterval = maxInterval
-					}
-					ticker.Reset(pollInterval)
-				}
-			}
+	fs.mutex.Lock()
+	fs.blockedUrlsPath = path
+	fs.mutex.Unlock()
 
-		case <-fs.ctx.Done():
+	fs.followPath("Blocked URLs", path, func(data json.RawMessage) {
+		urlsData, err := decodeBlockedUrls(data)
+		if err != nil {
+			log.Printf("❌ Invalid blocked URLs data at %s: %v", path, err)
 			return
 		}
-	}
+		fs.applyBlockedUrls(path, urlsData)
+	})
 }
 
-// optimizedPolling uses smart polling with exponential backoff
-func (fs *FirebaseService) optimizedPolling(ref *db.Ref) {
-	pollInterval := 2 * time.Second // Start with 2 seconds
-	maxInterval := 30 * time.Second
-
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
-
-	consecutiveNoChanges := 0
-
-	for {
-		select {
-		case <-ticker.C:
-			var urlsData map[string]*BlockedUrl
-			if err := ref.Get(fs.ctx, &urlsData); err != nil {
-				log.Printf("❌ Firebase polling error: %v", err)
-				// Increase interval on error
-				if pollInterval < maxInterval {
-					pollInterval = time.Duration(float64(pollInterval) * 1.5)
-					ticker.Reset(pollInterval)
-				}
-				continue
+// applyBlockedUrls merges the blocked URLs from Firebase when they differ from
+// the ones applied last
+func (fs *FirebaseService) applyBlockedUrls(source string, foundData map[string]*BlockedUrl) {
+	fs.mutex.Lock()
+	changed := !fs.rulesMerged || len(fs.blockedUrls) != len(foundData)
+	if !changed {
+		// Check for additions or modifications
+		for k, v := range foundData {
+			if existing, ok := fs.blockedUrls[k]; !ok || v == nil || existing == nil || existing.URL != v.URL ||
+				existing.Status != v.Status || existing.UpdatedAt != v.UpdatedAt {
+				changed = true
+				break
 			}
+		}
 
-			fs.mutex.Lock()
-			changed := len(fs.blockedUrls) != len(urlsData)
-			if !changed {
-				// Check for additions or modifications
-				for k, v := range urlsData {
-					if existing, ok := fs.blockedUrls[k]; !ok || existing.URL != v.URL || existing.Status != v.Status {
-						changed = true
-						break
-					}
-				}
-
-				// Check for deletions (items that exist in fs.blockedUrls but not in urlsData)
-				if !changed {
-					for k := range fs.blockedUrls {
-						if _, exists := urlsData[k]; !exists {
-							changed = true
-							log.Printf("🗑️ Detected deletion in optimized polling: %s no longer in Firebase data", k)
-							break
-						}
-					}
+		// Check for deletions (items that exist in fs.blockedUrls but not in foundData)
+		if !changed {
+			for k := range fs.blockedUrls {
+				if _, exists := foundData[k]; !exists {
+					changed = true
+					log.Printf("🗑️ Detected deletion: %s no longer in Firebase data", k)
+					break
 				}
 			}
+		}
+	}
+	fs.mutex.Unlock()
 
-			if changed {
-				log.Printf("🔥 Firebase data changed: %d URLs found", len(urlsData))
-				fs.blockedUrls = urlsData
-				if fs.blockedUrls == nil {
-					fs.blockedUrls = make(map[string]*BlockedUrl)
-				}
-				fs.mutex.Unlock()
-
-				// Reset to fast polling after changes
-				pollInterval = 2 * time.Second
-				ticker.Reset(pollInterval)
-				consecutiveNoChanges = 0
-
-				var urls []string
-				for _, blockedUrl := range urlsData {
-					if blockedUrl != nil && blockedUrl.Status == "active" {
-						cleanedUrl := fs.extractDomain(blockedUrl.URL)
-						if cleanedUrl != "" {
-							urls = append(urls, cleanedUrl)
-						}
-					}
-				}
-
-				if err := fs.updateHostsFile(urls); err != nil {
-					log.Printf("❌ Error updating hosts file: %v", err)
-				} else {
-					log.Printf("✅ Hosts file updated with %d URLs", len(urls))
-				}
-
-				go fs.updatePCStatus()
-			} else {
-				fs.mutex.Unlock()
-				consecutiveNoChanges++
-
-				// Implement exponential backoff when no changes
-				if consecutiveNoChanges > 5 && pollInterval < maxInterval {
-					pollInterval = time.Duration(float64(pollInterval) * 1.2)
-					if pollInterval > maxInterval {
-						pollInterval = maxInterval
-					}
-					ticker.Reset(pollInterval)
-					log.Printf("[FIREBASE] Adjusting poll interval to %v (no changes for %d cycles)", pollInterval, consecutiveNoChanges)
-				}
-			}
+	if !changed {
+		return
+	}
 
-		case <-fs.ctx.Done():
-			return
-		}
+	log.Printf("🔥 Firebase data changed at %s: %d URLs found", source, len(foundData))
+	if err := fs.syncBlockedUrls(source, foundData); err != nil {
+		log.Printf("❌ Error syncing blocked URLs: %v", err)
 	}
 }
 
-// fallbackToPolling provides a backup mechanism if real-time listeners fail
-func (fs *FirebaseService) fallbackToPolling() {
-	ref := fs.client.NewRef(fmt.Sprintf("kidsafe/families/%s/blockedUrls", fs.familyID))
-	ticker := time.NewTicker(10 * time.Second) // Less frequent polling as fallback
-	defer ticker.Stop()
-
-	log.Printf("📡 Firebase fallback polling started (every 10s)")
+// syncBlockedUrls merges a blocked URLs snapshot with the local rules, updates
+// the hosts file and pushes the PC changes Firebase does not have yet
+func (fs *FirebaseService) syncBlockedUrls(source string, foundData map[string]*BlockedUrl) error {
+	fs.mutex.Lock()
+	fs.blockedUrls = foundData
+	if fs.blockedUrls == nil {
+		fs.blockedUrls = make(map[string]*BlockedUrl)
+	}
+	fs.rulesMerged = true
+	fs.mutex.Unlock()
 
-	for {
-		select {
-		case <-ticker.C:
-			var urlsData map[string]*BlockedUrl
-			if err := ref.Get(fs.ctx, &urlsData); err != nil {
-				log.Printf("❌ Error in fallback polling: %v", err)
-				continue
-			}
+	defer func() { go fs.updatePCStatus() }()
 
-			fs.mutex.Lock()
-			changed := len(fs.blockedUrls) != len(urlsData)
-			if !changed {
-				// Check for additions or modifications
-				for k, v := range urlsData {
-					if existing, ok := fs.blockedUrls[k]; !ok || existing.URL != v.URL || existing.Status != v.Status {
-						changed = true
-						break
-					}
-				}
+	if fs.database == nil {
+		return fmt.Errorf("database not available")
+	}
+	if fs.coreService == nil {
+		return fmt.Errorf("core service not available")
+	}
 
-				// Check for deletions (items that exist in fs.blockedUrls but not in urlsData)
-				if !changed {
-					for k := range fs.blockedUrls {
-						if _, exists := urlsData[k]; !exists {
-							changed = true
-							log.Printf("🗑️ Detected deletion in fallback polling: %s no longer in Firebase data", k)
-							break
-						}
-					}
-				}
-			}
+	changed, err := fs.mergeBlockedUrls(foundData)
+	if err != nil {
+		return err
+	}
+	go fs.pushRuleChanges()
 
-			if changed {
-				fs.blockedUrls = urlsData
-				if fs.blockedUrls == nil {
-					fs.blockedUrls = make(map[string]*BlockedUrl)
-				}
-				fs.mutex.Unlock()
-
-				var urls []string
-				for _, blockedUrl := range urlsData {
-					if blockedUrl != nil && blockedUrl.Status == "active" {
-						cleanedUrl := fs.extractDomain(blockedUrl.URL)
-						if cleanedUrl != "" {
-							urls = append(urls, cleanedUrl)
-						}
-					}
-				}
+	if changed == 0 {
+		return nil
+	}
 
-				if err := fs.updateHostsFile(urls); err != nil {
-					log.Printf("❌ Error updating hosts file: %v", err)
-				} else {
-					log.Printf("📝 Hosts file updated via polling with %d URLs", len(urls))
-				}
+	log.Printf("🔄 %d synced rule(s) changed, updating hosts file...", changed)
+	if err := fs.updateHostsFile(); err != nil {
+		return fmt.Errorf("failed to update hosts file: %v", err)
+	}
+	log.Printf("✅ Hosts file updated from %s", source)
+	return nil
+}
 
-				go fs.updatePCStatus()
-			} else {
-				fs.mutex.Unlock()
-			}
+// decodeBlockedUrls reads blocked URLs stored either as an object or as an array
+func decodeBlockedUrls(data json.RawMessage) (map[string]*BlockedUrl, error) {
+	var urlsData map[string]*BlockedUrl
+	if err := json.Unmarshal(data, &urlsData); err == nil {
+		return urlsData, nil
+	}
 
-		case <-fs.ctx.Done():
-			return
+	var urlsArray []*BlockedUrl
+	if err := json.Unmarshal(data, &urlsArray); err != nil {
+		return nil, err
+	}
+	urlsData = make(map[string]*BlockedUrl)
+	for i, url := range urlsArray {
+		if url != nil {
+			urlsData[fmt.Sprintf("url_%d", i)] = url
 		}
 	}
+	return urlsData, nil
 }
 
 // extractDomain extracts domain from URL for hosts file
@@ -565,31 +370,9 @@ func (fs *FirebaseService) extractDomain(url string) string {
 	return domain
 }
 
-// updateHostsFile updates the hosts file with new URLs and also updates database
-func (fs *FirebaseService) updateHostsFile(urls []string) error {
-	// Update database with Firebase synced URLs first
-	if fs.database != nil {
-		// First, remove all existing firebase-sync rules
-		_, err := fs.database.Exec("DELETE FROM block_rules WHERE category = 'firebase-sync'")
-		if err != nil {
-			log.Printf("Warning: Failed to clear existing firebase-sync rules: %v", err)
-		}
-
-		// Add new firebase-sync rules
-		for _, url := range urls {
-			if url != "" {
-				_, err := fs.database.Exec(
-					"INSERT INTO block_rules (domain, category, profile_id, reason, is_active) VALUES (?, ?, ?, ?, ?)",
-					url, "firebase-sync", 1, "Synced from Android app", true)
-				if err != nil {
-					log.Printf("Warning: Failed to insert firebase-sync rule for %s: %v", url, err)
-				}
-			}
-		}
-		log.Printf("📱 Database updated with %d Firebase synced URLs", len(urls))
-	}
-
-	// Now sync ALL rules (Firebase + manual) to hosts file using core service
+// updateHostsFile writes every active rule (Firebase + manual) to the hosts file
+func (fs *FirebaseService) updateHostsFile() error {
+	// Sync ALL rules (Firebase + manual) to hosts file using core service
 	if fs.coreService != nil {
 		err := fs.coreService.syncRulesToHosts()
 		if err != nil {
@@ -600,28 +383,42 @@ func (fs *FirebaseService) updateHostsFile(urls []string) error {
 		// Broadcast real-time update to web UI clients
 		go fs.coreService.broadcastRulesUpdate()
 		log.Printf("📡 Broadcasting Firebase rules update to web UI clients")
-	} else {
-		log.Printf("⚠️ Core service not available, falling back to Firebase-only sync")
-		// Fallback to old method if core service not available
-		if fs.hostsManager == nil {
-			return fmt.Errorf("hosts manager not available")
-		}
-		err := fs.hostsManager.UpdateBlockedDomains(urls)
-		if err != nil {
-			return fmt.Errorf("failed to update hosts file: %v", err)
+		return nil
+	}
+
+	log.Printf("⚠️ Core service not available, falling back to Firebase-only sync")
+	// Fallback to old method if core service not available
+	if fs.hostsManager == nil {
+		return fmt.Errorf("hosts manager not available")
+	}
+
+	var urls []string
+	fs.mutex.Lock()
+	for _, blockedUrl := range fs.blockedUrls {
+		if blockedUrl != nil && blockedUrl.Status == blockedUrlActive && fs.appliesToThisDevice(blockedUrl.Devices) {
+			if domain := fs.extractDomain(blockedUrl.URL); domain != "" {
+				urls = append(urls, domain)
+			}
 		}
 	}
+	fs.mutex.Unlock()
 
+	if err := fs.hostsManager.UpdateBlockedDomains(urls); err != nil {
+		return fmt.Errorf("failed to update hosts file: %v", err)
+	}
 	return nil
 }
 
 // updatePCStatus updates the PC status in Firebase
 func (fs *FirebaseService) updatePCStatus() {
-	ref := fs.client.NewRef(fmt.Sprintf("kidsafe/families/%s/pcStatus", fs.familyID))
-
 	// Get current blocked count
 	fs.mutex.Lock()
-	blockedCount := len(fs.blockedUrls)
+	blockedCount := 0
+	for _, blockedUrl := range fs.blockedUrls {
+		if blockedUrl != nil && fs.appliesToThisDevice(blockedUrl.Devices) {
+			blockedCount++
+		}
+	}
 	fs.mutex.Unlock()
 
 	// Determine host file status
@@ -631,19 +428,63 @@ func (fs *FirebaseService) updatePCStatus() {
 	}
 
 	status := &PCStatus{
+		DeviceID:       fs.deviceID,
 		LastSeen:       time.Now().UnixMilli(),
 		Status:         "connected",
-		Version:        "1.0.0",
+		Version:        serviceVersion,
 		HostFileStatus: hostFileStatus,
 		BlockedCount:   blockedCount,
 	}
 
-	err := ref.Set(fs.ctx, status)
+	if fs.coreService != nil && fs.coreService.timeManager != nil {
+		clock := fs.coreService.timeManager.GetClockState()
+		if clock.Tampered && clock.Policy != ClockPolicyIgnore {
+			status.ClockTampered = true
+			status.ClockOffsetSeconds = clock.OffsetSeconds
+		}
+	}
+
+	err := fs.backend.Set(fs.ctx, fs.devicePath()+"/status", status)
 	if err != nil {
 		log.Printf("Error updating PC status: %v", err)
+		return
+	}
+	log.Printf("[FIREBASE] PC status updated: %d blocked URLs", blockedCount)
+
+	// Older app versions only read the single pcStatus node
+	if err := fs.backend.Set(fs.ctx, fmt.Sprintf("kidsafe/families/%s/pcStatus", fs.familyID), status); err != nil {
+		log.Printf("Error updating legacy PC status: %v", err)
+	}
+}
+
+// devicePath is the node of this PC under the family's devices
+func (fs *FirebaseService) devicePath() string {
+	return fmt.Sprintf("kidsafe/families/%s/devices/%s", fs.familyID, fs.deviceID)
+}
+
+// registerDevice writes the name, hostname, OS, version and owner profile of
+// this PC so the parent app can list the family's devices and target rules
+func (fs *FirebaseService) registerDevice() error {
+	info := loadDeviceInfo(fs.database, fs.deviceID)
+
+	var existing DeviceInfo
+	if err := fs.backend.Get(fs.ctx, fs.devicePath()+"/info", &existing); err == nil && existing.RegisteredAt > 0 {
+		info.RegisteredAt = existing.RegisteredAt
 	} else {
-		log.Printf("[FIREBASE] PC status updated: %d blocked URLs", blockedCount)
+		info.RegisteredAt = info.UpdatedAt
+	}
+
+	if err := fs.backend.Set(fs.ctx, fs.devicePath()+"/info", info); err != nil {
+		log.Printf("⚠️ Could not register device %s: %v", fs.deviceID, err)
+		return err
 	}
+	log.Printf("🖥️ Registered as device %s (%s, profile %s)", info.DeviceID, info.Name, info.ProfileName)
+	return nil
+}
+
+// appliesToThisDevice reports whether a rule targeted at devices applies to this PC
+func (fs *FirebaseService) appliesToThisDevice(devices []string) bool {
+	return appliesToDevice(devices, fs.deviceID)
 }
 
 // updatePCStatusPeriodically updates PC status every 30 seconds
@@ -680,14 +521,12 @@ func (fs *FirebaseService) GetBlockedUrls() map[string]*BlockedUrl {
 
 // TestConnection tests the Firebase connection
 func (fs *FirebaseService) TestConnection() error {
-	ref := fs.client.NewRef(fmt.Sprintf("kidsafe/families/%s/connectionTest", fs.familyID))
-
 	testData := map[string]interface{}{
 		"timestamp": time.Now().UnixMilli(),
 		"message":   "PC connection test",
 	}
 
-	err := ref.Set(fs.ctx, testData)
+	err := fs.backend.Set(fs.ctx, fmt.Sprintf("kidsafe/families/%s/connectionTest", fs.familyID), testData)
 	if err != nil {
 		return fmt.Errorf("Firebase connection test failed: %v", err)
 	}
@@ -743,42 +582,44 @@ func (fs *FirebaseService) ForceSync() error {
 		}
 	}
 
+	// Once a path is followed, rule changes are merged with that path only
+	fs.mutex.Lock()
+	followed := fs.blockedUrlsPath
+	fs.mutex.Unlock()
+	if followed != "" {
+		possiblePaths = []string{followed}
+	}
+
 	log.Printf("🔍 Checking %d paths for Firebase data...", len(possiblePaths))
 
 	for i, path := range possiblePaths {
 		log.Printf("   Checking path %d: %s", i+1, path)
-		ref := fs.client.NewRef(path)
-
-		var urlsData map[string]*BlockedUrl
-		if err := ref.Get(fs.ctx, &urlsData); err != nil {
+		var data json.RawMessage
+		if err := fs.backend.Get(fs.ctx, path, &data); err != nil {
 			log.Printf("     ❌ Error: %v", err)
 			continue
 		}
 
-		if len(urlsData) > 0 {
+		urlsData, err := decodeBlockedUrls(data)
+		if err != nil {
+			log.Printf("     ❌ Invalid data: %v", err)
+			continue
+		}
+
+		if len(urlsData) > 0 || path == followed {
 			log.Printf("     ✅ Found %d URLs at this path!", len(urlsData))
 
-			// Process the data
-			var urls []string
-			for _, blockedUrl := range urlsData {
-				if blockedUrl != nil && blockedUrl.Status == "active" {
-					cleanedUrl := fs.extractDomain(blockedUrl.URL)
-					if cleanedUrl != "" {
-						urls = append(urls, cleanedUrl)
-					}
-				}
-			}
+			fs.mutex.Lock()
+			fs.blockedUrlsPath = path
+			fs.mutex.Unlock()
 
-			if len(urls) > 0 {
-				if err := fs.updateHostsFile(urls); err != nil {
-					return fmt.Errorf("failed to update hosts file: %v", err)
-				}
-				log.Printf("✅ Manual sync successful: %d URLs updated", len(urls))
-				return nil
+			if err := fs.syncBlockedUrls(path, urlsData); err != nil {
+				return err
 			}
-		} else {
-			log.Printf("     ⚪ No data found")
+			log.Printf("✅ Manual sync successful: %d URLs merged", len(urlsData))
+			return nil
 		}
+		log.Printf("     ⚪ No data found")
 	}
 
 	return fmt.Errorf("no Firebase data found in any of the %d paths checked", len(possiblePaths))
@@ -841,39 +682,13 @@ func SetupFirebaseServiceWithEmail(userUID, userEmail string, hostsManager *Host
 
 // SetupFirebaseServiceAnonymous creates Firebase service for public read access
 func SetupFirebaseServiceAnonymous(userUID string, hostsManager *HostsManager, database *sql.DB) (*FirebaseService, error) {
-	// Use built-in config for anonymous access
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// Initialize Firebase app with public database URL only
-	firebaseConfig := &firebase.Config{
-		DatabaseURL: "https://kidsafe-control-default-rtdb.asia-southeast1.firebasedatabase.app/",
-		ProjectID:   "kidsafe-control",
-	}
-
-	app, err := firebase.NewApp(ctx, firebaseConfig)
+	// No credentials: the backend uses the public database URL only
+	backend, err := NewFirebaseBackend(context.Background(), "")
 	if err != nil {
-		cancel()
-		return nil, fmt.Errorf("error initializing Firebase app: %v", err)
+		return nil, err
 	}
 
-	// Get database client
-	client, err := app.Database(ctx)
-	if err != nil {
-		cancel()
-		return nil, fmt.Errorf("error getting Database client: %v", err)
-	}
-
-	fs := &FirebaseService{
-		app:          app,
-		client:       client,
-		familyID:     userUID,
-		hostsManager: hostsManager,
-		database:     database,
-		ctx:          ctx,
-		cancel:       cancel,
-		isListening:  false,
-		blockedUrls:  make(map[string]*BlockedUrl),
-	}
+	fs := NewFirebaseServiceWithBackend(backend, userUID, hostsManager, database, nil)
 
 	log.Printf("🔥 Anonymous Firebase service initialized for user: %s", userUID)
 	log.Printf("⚠️ Note: This mode has read-only access to public data")
@@ -886,100 +701,6 @@ func fileExists(filename string) bool {
 	return err == nil
 }
 
-// syncToLocalDatabase syncs Firebase URLs to local SQLite database
-func (fs *FirebaseService) syncToLocalDatabase(firebaseUrls map[string]*BlockedUrl) error {
-	if fs.database == nil {
-		return fmt.Errorf("database not available")
-	}
-
-	log.Printf("🔄 Starting sync of %d Firebase URLs to local database", len(firebaseUrls))
-
-	// First, get all Firebase domains currently active
-	activeFirebaseDomains := make(map[string]bool)
-
-	// Process each Firebase URL
-	for _, blockedUrl := range firebaseUrls {
-		if blockedUrl == nil || blockedUrl.Status != "active" {
-			continue
-		}
-
-		domain := fs.extractDomain(blockedUrl.URL)
-		if domain == "" {
-			continue
-		}
-
-		activeFirebaseDomains[domain] = true
-
-		// Check if domain already exists in local database
-		var existingID int
-		err := fs.database.QueryRow("SELECT id FROM block_rules WHERE domain = ? AND category = 'firebase-sync'", domain).Scan(&existingID)
-
-		if err == sql.ErrNoRows {
-			// Domain doesn't exist, insert it
-			_, insertErr := fs.database.Exec(
-				"INSERT INTO block_rules (domain, category, profile_id, reason, created_at, is_active) VALUES (?, ?, ?, ?, datetime('now'), ?)",
-				domain,
-				"firebase-sync",           // Category for Firebase synced rules
-				1,                         // Default profile ID
-				"Synced from Android app", // Reason
-				true,                      // Active
-			)
-			if insertErr != nil {
-				log.Printf("❌ Failed to insert Firebase domain %s: %v", domain, insertErr)
-			} else {
-				log.Printf("✅ Added Firebase domain to local DB: %s", domain)
-			}
-		} else if err != nil {
-			log.Printf("❌ Error checking existing domain %s: %v", domain, err)
-		} else {
-			// Domain exists, ensure it's active
-			fs.database.Exec("UPDATE block_rules SET is_active = 1 WHERE id = ?", existingID)
-		}
-	}
-
-	// Remove Firebase domains that are no longer active (deleted from Android)
-	rows, err := fs.database.Query("SELECT id, domain FROM block_rules WHERE category = 'firebase-sync' AND is_active = 1")
-	if err != nil {
-		log.Printf("❌ Error querying Firebase domains: %v", err)
-		return err
-	}
-	defer rows.Close()
-
-	var domainsToRemove []struct {
-		ID     int
-		Domain string
-	}
-
-	for rows.Next() {
-		var id int
-		var domain string
-		if err := rows.Scan(&id, &domain); err != nil {
-			continue
-		}
-
-		// If this domain is not in the active Firebase list, mark for removal
-		if !activeFirebaseDomains[domain] {
-			domainsToRemove = append(domainsToRemove, struct {
-				ID     int
-				Domain string
-			}{id, domain})
-		}
-	}
-
-	// Remove domains that were deleted from Android
-	for _, item := range domainsToRemove {
-		_, err := fs.database.Exec("DELETE FROM block_rules WHERE id = ?", item.ID)
-		if err != nil {
-			log.Printf("❌ Failed to remove deleted Firebase domain %s: %v", item.Domain, err)
-		} else {
-			log.Printf("🗑️ Removed deleted Firebase domain from local DB: %s", item.Domain)
-		}
-	}
-
-	log.Printf("✅ Firebase sync to local database completed: %d active domains, %d removed", len(activeFirebaseDomains), len(domainsToRemove))
-	return nil
-}
-
 // listenForTimeRules listens for time rules changes from Android app
 func (fs *FirebaseService) listenForTimeRules() {
 	// Build possible paths for time rules
@@ -1007,91 +728,37 @@ func (fs *FirebaseService) listenForTimeRules() {
 		log.Printf("   Time Rules Path %d: %s", i+1, path)
 	}
 
-	// Start polling for time rules
-	fs.pollTimeRules(possiblePaths)
-}
+	// Stream the path that holds the rules (polling only while the stream is down)
+	path := fs.discoverPath(possiblePaths)
+	log.Printf("📡 Following time rules at: %s", path)
 
-// pollTimeRules polls Firebase for time rules changes
-func (fs *FirebaseService) pollTimeRules(paths []string) {
-	pollInterval := 3 * time.Second
-	maxInterval := 30 * time.Second
-
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
-
-	consecutiveNoChanges := 0
-	var activePath string
 	lastRulesHash := ""
+	fs.followPath("Time rules", path, func(data json.RawMessage) {
+		var rulesData map[string]*AndroidTimeRule
+		if err := json.Unmarshal(data, &rulesData); err != nil {
+			log.Printf("❌ Invalid time rules data at %s: %v", path, err)
+			return
+		}
+		if len(rulesData) == 0 {
+			return
+		}
 
-	for {
-		select {
-		case <-ticker.C:
-			var foundRules map[string]*AndroidTimeRule
-			var workingPath string
-
-			// Try each path until we find data
-			for _, path := range paths {
-				ref := fs.client.NewRef(path)
-				var rulesData map[string]*AndroidTimeRule
-
-				if err := ref.Get(fs.ctx, &rulesData); err != nil {
-					continue // Try next path
-				}
-
-				if len(rulesData) > 0 {
-					foundRules = rulesData
-					workingPath = path
-
-					// If this is a new working path, log it
-					if activePath != workingPath {
-						log.Printf("✅ Found time rules at path: %s (%d rules)", workingPath, len(rulesData))
-						activePath = workingPath
-
-						// Debug: Print rules found
-						for key, rule := range rulesData {
-							if rule != nil && rule.Active {
-								log.Printf("   Rule %s: %s - daily limit: %d min", key, rule.Name, rule.DailyLimitMinutes)
-							}
-						}
-					}
-					break
-				}
-			}
-
-			if foundRules == nil {
-				consecutiveNoChanges++
-				if consecutiveNoChanges > 10 && pollInterval < maxInterval {
-					pollInterval = time.Duration(float64(pollInterval) * 1.5)
-					if pollInterval > maxInterval {
-						pollInterval = maxInterval
-					}
-					ticker.Reset(pollInterval)
-				}
-				continue
-			}
+		// Check if rules have changed (simple hash comparison)
+		currentHash := fs.calculateTimeRulesHash(rulesData)
+		if currentHash == lastRulesHash {
+			return
+		}
+		lastRulesHash = currentHash
 
-			// Check if rules have changed (simple hash comparison)
-			currentHash := fs.calculateTimeRulesHash(foundRules)
-			if currentHash != lastRulesHash {
-				log.Printf("🕐 Time rules changed, applying updates...")
-				fs.processTimeRulesUpdate(foundRules)
-				lastRulesHash = currentHash
-				consecutiveNoChanges = 0
-
-				// Reset to fast polling after changes
-				if pollInterval > 3*time.Second {
-					pollInterval = 3 * time.Second
-					ticker.Reset(pollInterval)
-				}
-			} else {
-				consecutiveNoChanges++
+		for key, rule := range rulesData {
+			if rule != nil && rule.Active {
+				log.Printf("   Rule %s: %s - daily limit: %d min", key, rule.Name, rule.DailyLimitMinutes)
 			}
-
-		case <-fs.ctx.Done():
-			log.Println("🕐 Time rules listener stopped")
-			return
 		}
-	}
+		log.Printf("🕐 Time rules changed, applying updates...")
+		fs.processTimeRulesUpdate(rulesData)
+	})
+	log.Println("🕐 Time rules listener stopped")
 }
 
 // calculateTimeRulesHash creates a simple hash of time rules for change detection
@@ -1099,9 +766,10 @@ func (fs *FirebaseService) calculateTimeRulesHash(rules map[string]*AndroidTimeR
 	var hash strings.Builder
 	for key, rule := range rules {
 		if rule != nil {
-			hash.WriteString(fmt.Sprintf("%s:%v:%d:%d:%d:%d",
-				key, rule.Active, rule.DailyLimitMinutes, rule.BreakIntervalMinutes,
-				rule.BreakDurationMinutes, rule.UpdatedAt))
+			hash.WriteString(fmt.Sprintf("%s:%v:%s:%d:%d:%d:%d:%v:%s-%s:%s-%s:%v:%v",
+				key, rule.Active, rule.RuleType, rule.DailyLimitMinutes, rule.BreakIntervalMinutes,
+				rule.BreakDurationMinutes, rule.UpdatedAt, rule.DaysOfWeek, rule.StartTime, rule.EndTime,
+				rule.BedtimeStart, rule.BedtimeEnd, rule.AllowedSlots, rule.Devices))
 		}
 	}
 	return hash.String()
@@ -1113,94 +781,77 @@ func (fs *FirebaseService) processTimeRulesUpdate(androidRules map[string]*Andro
 	fs.timeRules = androidRules
 	fs.mutex.Unlock()
 
+	// Only the rules targeted at this PC (or at every device) apply here
+	deviceRules := make(map[string]*AndroidTimeRule)
+	for key, rule := range androidRules {
+		if rule != nil && fs.appliesToThisDevice(rule.Devices) {
+			deviceRules[key] = rule
+		}
+	}
+	if skipped := len(androidRules) - len(deviceRules); skipped > 0 {
+		log.Printf("🖥️ %d time rule(s) target other devices, skipped", skipped)
+	}
+
 	// Convert Android rules to PC format
-	pcRules := fs.convertAndroidRulesToPCFormat(androidRules)
+	pcRules := fs.convertAndroidRulesToPCFormat(deviceRules)
 
-	// Apply to TimeManager if available
+	// Apply to TimeManager if available (rules configured on the PC after the
+	// last edit on Android are kept, see StoredTimeRules)
 	if fs.coreService != nil && fs.coreService.timeManager != nil {
-		log.Printf("🕐 Applying %d time rules to TimeManager", len(androidRules))
-		fs.coreService.timeManager.UpdateRules(*pcRules)
+		applied, err := fs.coreService.timeManager.ApplyFirebaseRules(*pcRules, latestAndroidRuleEdit(androidRules))
+		if err != nil {
+			log.Printf("⚠️ Failed to save time rules from Firebase: %v", err)
+		} else if applied {
+			log.Printf("🕐 Applied %d time rules from Firebase", len(deviceRules))
+		}
 	} else {
 		log.Printf("⚠️ TimeManager not available, time rules stored but not applied")
 	}
 }
 
-// convertAndroidRulesToPCFormat converts Android time rules to PC TimeRules format
-func (fs *FirebaseService) convertAndroidRulesToPCFormat(androidRules map[string]*AndroidTimeRule) *TimeRules {
-	// Initialize default rules
-	pcRules := &TimeRules{
-		Weekdays: DayRule{
-			Enabled:              false,
-			DailyLimitMinutes:    0,
-			BreakIntervalMinutes: 0,
-			BreakDurationMinutes: 0,
-			AllowedSlots:         []TimeSlot{},
-		},
-		Weekends: DayRule{
-			Enabled:              false,
-			DailyLimitMinutes:    0,
-			BreakIntervalMinutes: 0,
-			BreakDurationMinutes: 0,
-			AllowedSlots:         []TimeSlot{},
-		},
-	}
-
-	// Process Android rules
-	var hasActiveRules bool
-	var maxDailyLimit int
-	var maxBreakInterval int
-	var maxBreakDuration int
-
-	for _, rule := range androidRules {
-		if rule == nil || !rule.Active {
-			continue
+// listenForTimeGrants follows the family's timeGrants path for bonus minutes
+// granted from the Android parent app
+func (fs *FirebaseService) listenForTimeGrants() {
+	path := fmt.Sprintf("kidsafe/families/%s/timeGrants", fs.familyID)
+	log.Printf("🎁 Starting time grants listener at: %s", path)
+
+	lastHash := ""
+	fs.followPath("Time grants", path, func(data json.RawMessage) {
+		var grants map[string]*TimeGrant
+		if err := json.Unmarshal(data, &grants); err != nil {
+			log.Printf("❌ Invalid time grants data: %v", err)
+			return
 		}
 
-		hasActiveRules = true
-
-		// Find the most restrictive (highest) values
-		if rule.DailyLimitMinutes > maxDailyLimit {
-			maxDailyLimit = rule.DailyLimitMinutes
-		}
-		if rule.BreakIntervalMinutes > maxBreakInterval {
-			maxBreakInterval = rule.BreakIntervalMinutes
+		currentHash := fs.calculateTimeGrantsHash(grants)
+		if currentHash == lastHash {
+			return
 		}
-		if rule.BreakDurationMinutes > maxBreakDuration {
-			maxBreakDuration = rule.BreakDurationMinutes
+		lastHash = currentHash
+
+		log.Printf("🎁 Time grants changed: %d grants from Firebase", len(grants))
+		if fs.coreService != nil && fs.coreService.timeManager != nil {
+			fs.coreService.timeManager.SetRemoteGrants(grants)
 		}
+	})
+	log.Println("🎁 Time grants listener stopped")
+}
 
-		log.Printf("🕐 Processing rule: %s (type: %s, daily limit: %d min)",
-			rule.Name, rule.RuleType, rule.DailyLimitMinutes)
+// calculateTimeGrantsHash creates a simple hash of time grants for change detection
+func (fs *FirebaseService) calculateTimeGrantsHash(grants map[string]*TimeGrant) string {
+	keys := make([]string, 0, len(grants))
+	for key := range grants {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	if hasActiveRules {
-		// Apply same rules to both weekdays and weekends for now
-		// TODO: In future, Android could send separate weekend/weekday rules
-		dayRule := DayRule{
-			Enabled:              true,
-			DailyLimitMinutes:    maxDailyLimit,
-			BreakIntervalMinutes: maxBreakInterval,
-			BreakDurationMinutes: maxBreakDuration,
-			AllowedSlots:         []TimeSlot{}, // Default: no time restrictions, only daily limit
-		}
-
-		// If no daily limit is set, allow all day but with breaks
-		if maxDailyLimit == 0 {
-			dayRule.AllowedSlots = []TimeSlot{
-				{StartTime: "00:00", EndTime: "23:59"}, // Allow all day
-			}
+	var hash strings.Builder
+	for _, key := range keys {
+		if grant := grants[key]; grant != nil {
+			hash.WriteString(fmt.Sprintf("%s:%s:%d;", key, grant.Date, grant.Minutes))
 		}
-
-		pcRules.Weekdays = dayRule
-		pcRules.Weekends = dayRule
-
-		log.Printf("🕐 Converted rules: daily limit=%d min, break interval=%d min, break duration=%d min",
-			maxDailyLimit, maxBreakInterval, maxBreakDuration)
-	} else {
-		log.Printf("🕐 No active time rules found")
 	}
-
-	return pcRules
+	return hash.String()
 }
 
 // GetTimeRules returns current time rules from Android
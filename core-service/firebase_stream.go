@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	streamRetryMin       = 10 * time.Second // Polling period after the first stream failure
+	streamRetryMax       = 5 * time.Minute  // Longest polling period between stream attempts
+	fallbackPollInterval = 10 * time.Second
+)
+
+// discoverPath returns the first path that holds data, or the first path if none does
+func (fs *FirebaseService) discoverPath(paths []string) string {
+	for _, path := range paths {
+		var data json.RawMessage
+		if err := fs.backend.Get(fs.ctx, path, &data); err != nil {
+			log.Printf("❌ Error checking path %s: %v", path, err)
+			continue
+		}
+		if len(data) > 0 && string(data) != "null" {
+			log.Printf("✅ Found data at path: %s", path)
+			return path
+		}
+	}
+	return paths[0]
+}
+
+// followPath streams the value at path and passes every change to apply. While
+// the stream is down the path is polled, for a period that doubles after each
+// failed attempt, before streaming is tried again.
+func (fs *FirebaseService) followPath(label, path string, apply func(data json.RawMessage)) {
+	retry := streamRetryMin
+
+	for fs.ctx.Err() == nil {
+		started := time.Now()
+		err := fs.backend.Listen(fs.ctx, path, apply)
+		if fs.ctx.Err() != nil {
+			return
+		}
+
+		healthy := time.Since(started) > time.Minute
+		if healthy {
+			retry = streamRetryMin
+		}
+		if healthy && (errors.Is(err, errStreamAuthRevoked) || errors.Is(err, errStreamIdle)) {
+			log.Printf("📡 %s stream reconnecting: %v", label, err)
+			continue
+		}
+
+		log.Printf("⚠️ %s stream failed (%v), polling every %v for %v", label, err, fallbackPollInterval, retry)
+		if !fs.pollPath(path, retry, apply) {
+			return
+		}
+		if retry *= 2; retry > streamRetryMax {
+			retry = streamRetryMax
+		}
+	}
+}
+
+// pollPath reads path every fallbackPollInterval for the given duration.
+// Returns false when the service is stopping.
+func (fs *FirebaseService) pollPath(path string, duration time.Duration, apply func(data json.RawMessage)) bool {
+	deadline := time.Now().Add(duration)
+	ticker := time.NewTicker(fallbackPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var data json.RawMessage
+		if err := fs.backend.Get(fs.ctx, path, &data); err != nil {
+			log.Printf("❌ Firebase polling error at %s: %v", path, err)
+		} else {
+			apply(data)
+		}
+
+		if !time.Now().Before(deadline) {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-fs.ctx.Done():
+			return false
+		}
+	}
+}
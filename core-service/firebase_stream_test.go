@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// sseSyncBackend reads from a FakeSyncBackend but follows changes through the
+// streaming client, pointed at a stand-in server
+type sseSyncBackend struct {
+	*FakeSyncBackend
+	streamURL string
+}
+
+func (b *sseSyncBackend) Listen(ctx context.Context, path string, onChange func(data json.RawMessage)) error {
+	stream := &RTDBStream{
+		BaseURL:  b.streamURL,
+		Path:     path,
+		Token:    func(ctx context.Context) (string, error) { return "test-token", nil },
+		OnChange: onChange,
+	}
+	return stream.Run(ctx)
+}
+
+func TestFollowPathFallsBackToPolling(t *testing.T) {
+	// The stream is canceled right away, so the value can only come from polling
+	server := newSSEServer(t, "test-token", sseEvent{"cancel", "permission denied"})
+	backend := &sseSyncBackend{FakeSyncBackend: NewFakeSyncBackend(), streamURL: server.URL}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := "kidsafe/families/fam/blockedUrls"
+	if err := backend.Set(ctx, path+"/a", &BlockedUrl{URL: "a.com", Status: blockedUrlActive}); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &FirebaseService{backend: backend, ctx: ctx, cancel: cancel}
+	changes := make(chan json.RawMessage, 1)
+	done := make(chan struct{})
+	go func() {
+		fs.followPath("Blocked URLs", path, func(data json.RawMessage) {
+			select {
+			case changes <- data:
+			default:
+			}
+		})
+		close(done)
+	}()
+
+	select {
+	case data := <-changes:
+		var urls map[string]*BlockedUrl
+		if err := json.Unmarshal(data, &urls); err != nil || urls["a"] == nil || urls["a"].URL != "a.com" {
+			t.Fatalf("polled %s, want the blocked URL", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no value polled after the stream failed")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("followPath did not stop with the service")
+	}
+}
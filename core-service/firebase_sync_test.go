@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFamilyID = "family-test"
+
+// newTestServices wires a CoreService on an in-memory database and a temporary
+// hosts file to a FirebaseService on a FakeSyncBackend
+func newTestServices(t *testing.T) (*CoreService, *FirebaseService, *FakeSyncBackend) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	dir := t.TempDir()
+	hostsPath := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(hostsPath, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hostsManager := NewHostsManager()
+	hostsManager.hostsPath = hostsPath
+	hostsManager.backupPath = hostsPath + BackupSuffix
+
+	core := &CoreService{db: db, hostsManager: hostsManager, sseClients: make(map[string]*SSEClient)}
+	if err := core.initDB(); err != nil {
+		t.Fatal(err)
+	}
+
+	timeManager := NewTimeManager(db)
+	timeManager.networkEnforcer = NewFakeNetworkEnforcer()
+	timeManager.grantsFile = filepath.Join(dir, "time_grants.json")
+	timeManager.usageDataFile = filepath.Join(dir, "time_usage.json")
+	core.timeManager = timeManager
+
+	backend := NewFakeSyncBackend()
+	fs := NewFirebaseServiceWithBackend(backend, testFamilyID, hostsManager, db, core)
+	core.firebaseService = fs
+	t.Cleanup(fs.cancel)
+	return core, fs, backend
+}
+
+// waitFor polls condition until it holds or the test times out
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func ruleState(db *sql.DB, domain string) (exists, active bool) {
+	err := db.QueryRow("SELECT is_active FROM block_rules WHERE domain = ?", domain).Scan(&active)
+	return err == nil, active
+}
+
+func hostsFileBlocks(t *testing.T, hm *HostsManager, domain string) bool {
+	content, err := os.ReadFile(hm.hostsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Contains(string(content), BlockedIP+" "+domain)
+}
+
+func TestBlockedUrlsReachRulesAndHostsFile(t *testing.T) {
+	core, fs, backend := newTestServices(t)
+	path := "kidsafe/families/" + testFamilyID + "/blockedUrls/"
+
+	entry := &BlockedUrl{URL: "https://www.games.com/play", Status: blockedUrlActive, AddedAt: time.Now().UnixMilli(), AddedBy: "parent"}
+	if err := backend.Set(fs.ctx, path+"k1", entry); err != nil {
+		t.Fatal(err)
+	}
+	go fs.listenForBlockedUrls()
+
+	waitFor(t, "games.com to be blocked", func() bool {
+		exists, active := ruleState(core.db, "games.com")
+		return exists && active && hostsFileBlocks(t, core.hostsManager, "games.com")
+	})
+
+	// Disabled on the parent app: the rule stays but the hosts file lets it through
+	entry.Status = blockedUrlInactive
+	entry.UpdatedAt = time.Now().UnixMilli()
+	backend.Set(fs.ctx, path+"k1", entry)
+	waitFor(t, "games.com to be disabled", func() bool {
+		exists, active := ruleState(core.db, "games.com")
+		return exists && !active && !hostsFileBlocks(t, core.hostsManager, "games.com")
+	})
+
+	// Deleted on the parent app
+	backend.Set(fs.ctx, path+"k1", nil)
+	waitFor(t, "games.com to be removed", func() bool {
+		exists, _ := ruleState(core.db, "games.com")
+		return !exists
+	})
+}
+
+func TestRemoteCommandIsAcknowledged(t *testing.T) {
+	core, fs, backend := newTestServices(t)
+	go fs.listenForCommands()
+
+	command := &RemoteCommand{
+		Type:      CommandGrantTime,
+		Params:    json.RawMessage(`{"minutes":15,"reason":"homework"}`),
+		IssuedBy:  "parent",
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	if err := backend.Set(fs.ctx, fs.commandsPath()+"/cmd1", command); err != nil {
+		t.Fatal(err)
+	}
+
+	var ack *CommandAck
+	waitFor(t, "the command ack", func() bool {
+		ack = nil
+		backend.Get(fs.ctx, fs.commandsPath()+"/cmd1/ack", &ack)
+		return ack != nil && ack.Status != CommandReceived
+	})
+	if ack.Status != CommandDone || ack.DeviceID != fs.deviceID || ack.Error != "" {
+		t.Fatalf("got ack %+v, want done by %s", ack, fs.deviceID)
+	}
+	if grants := core.timeManager.GetGrants(""); len(grants) != 1 || grants[0].Minutes != 15 {
+		t.Fatalf("got grants %+v, want one 15-minute grant", grants)
+	}
+
+	// The same command again is not executed twice
+	fs.processCommands(map[string]*RemoteCommand{"cmd1": command})
+	if grants := core.timeManager.GetGrants(""); len(grants) != 1 {
+		t.Fatalf("replayed command executed again: %+v", grants)
+	}
+}
+
+func TestSyncRecoversAfterOffline(t *testing.T) {
+	core, fs, backend := newTestServices(t)
+	rulePath := fs.rulesPath() + "/"
+
+	backend.SetOffline(true)
+	var value json.RawMessage
+	if err := backend.Get(fs.ctx, rulePath, &value); err == nil {
+		t.Fatal("Get succeeded while the backend is offline")
+	}
+
+	// A rule added on the PC while offline stays pending
+	if err := core.storeLocalRuleChange("news.com", blockedUrlActive); err != nil {
+		t.Fatal(err)
+	}
+	fs.pushRuleChanges()
+	pending, err := loadSyncedRules(core.db, "WHERE pending = 1")
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("got %d pending rule changes (%v), want 1", len(pending), err)
+	}
+
+	// A command whose ack cannot be written is acknowledged once back online
+	command := &RemoteCommand{Type: CommandClearOverride, CreatedAt: time.Now().UnixMilli()}
+	fs.processCommands(map[string]*RemoteCommand{"cmd1": command})
+
+	backend.SetOffline(false)
+	fs.pushRuleChanges()
+	fs.processCommands(map[string]*RemoteCommand{"cmd1": command})
+
+	var remote map[string]*BlockedUrl
+	if err := backend.Get(fs.ctx, fs.rulesPath(), &remote); err != nil {
+		t.Fatal(err)
+	}
+	var pushed *BlockedUrl
+	for _, entry := range remote {
+		if entry != nil && normalizeDomain(entry.URL) == "news.com" {
+			pushed = entry
+		}
+	}
+	if pushed == nil || pushed.AddedBy != blockedUrlAddedByPC || pushed.Status != blockedUrlActive {
+		t.Fatalf("rule not pushed after reconnecting: %+v", remote)
+	}
+	if pending, _ := loadSyncedRules(core.db, "WHERE pending = 1"); len(pending) != 0 {
+		t.Fatalf("%d rule changes still pending", len(pending))
+	}
+
+	var ack *CommandAck
+	if err := backend.Get(fs.ctx, fs.commandsPath()+"/cmd1/ack", &ack); err != nil || ack == nil || ack.Status != CommandDone {
+		t.Fatalf("got ack %+v (%v), want done", ack, err)
+	}
+}
+
+func TestInterruptedCommandIsAcknowledgedAsFailed(t *testing.T) {
+	core, fs, backend := newTestServices(t)
+
+	// The previous run claimed the command and crashed before finishing it
+	command := &RemoteCommand{
+		Type:      CommandGrantTime,
+		Params:    json.RawMessage(`{"minutes":15}`),
+		CreatedAt: time.Now().UnixMilli(),
+		Ack:       &CommandAck{Status: CommandReceived, DeviceID: fs.deviceID, ReceivedAt: time.Now().UnixMilli()},
+	}
+	if _, err := fs.claimCommand("cmd1", command); err != nil {
+		t.Fatal(err)
+	}
+
+	fs.failInterruptedCommands()
+	fs.processCommands(map[string]*RemoteCommand{"cmd1": command})
+
+	var ack *CommandAck
+	if err := backend.Get(fs.ctx, fs.commandsPath()+"/cmd1/ack", &ack); err != nil || ack == nil || ack.Status != CommandFailed {
+		t.Fatalf("got ack %+v (%v), want failed", ack, err)
+	}
+	if grants := core.timeManager.GetGrants(""); len(grants) != 0 {
+		t.Fatalf("interrupted command executed again: %+v", grants)
+	}
+}
@@ -6,6 +6,7 @@ require (
 	firebase.google.com/go/v4 v4.14.1
 	github.com/gorilla/mux v1.8.1
 	github.com/mattn/go-sqlite3 v1.14.30
+	golang.org/x/oauth2 v0.18.0
 	golang.org/x/sys v0.35.0
 	google.golang.org/api v0.170.0
 )
@@ -37,7 +38,6 @@ require (
 	go.opentelemetry.io/otel/trace v1.24.0 // indirect
 	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/net v0.23.0 // indirect
-	golang.org/x/oauth2 v0.18.0 // indirect
 	golang.org/x/sync v0.6.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	golang.org/x/time v0.5.0 // indirect
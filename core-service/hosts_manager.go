@@ -22,13 +22,18 @@ type HostsManager struct {
 	mutex          sync.RWMutex
 	originalHosts  string
 	blockedDomains map[string]bool
+	budgetDomains  map[string]bool // Domains blocked because their daily time budget is spent
+	suspended      bool            // Protection disabled by the parent: keep the KidSafe section out
 	backupPath     string
+	hostsPath      string // WindowsHostsPath, a temporary file in tests
 }
 
 func NewHostsManager() *HostsManager {
 	return &HostsManager{
 		blockedDomains: make(map[string]bool),
+		budgetDomains:  make(map[string]bool),
 		backupPath:     WindowsHostsPath + BackupSuffix,
+		hostsPath:      WindowsHostsPath,
 	}
 }
 
@@ -116,6 +121,40 @@ func (hm *HostsManager) UpdateBlockedDomains(domains []string) error {
 	return hm.updateHostsFile()
 }
 
+// SetSuspended removes the KidSafe section while protection is disabled and
+// writes it back (with the current lists) when protection is enabled again
+func (hm *HostsManager) SetSuspended(suspended bool) error {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+
+	if hm.suspended == suspended {
+		return nil
+	}
+	hm.suspended = suspended
+	return hm.updateHostsFile()
+}
+
+// SetBudgetBlockedDomains replaces the domains blocked by site time budgets.
+// They are kept apart from the rule list so rule syncs don't unblock them.
+func (hm *HostsManager) SetBudgetBlockedDomains(domains []string) error {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+
+	hm.budgetDomains = make(map[string]bool)
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" {
+			hm.budgetDomains[domain] = true
+			if !strings.HasPrefix(domain, "www.") {
+				hm.budgetDomains["www."+domain] = true
+			}
+		}
+	}
+
+	log.Printf("Updated budget blocked domains: %d domains", len(domains))
+	return hm.updateHostsFile()
+}
+
 // GetBlockedDomains returns list of currently blocked domains
 func (hm *HostsManager) GetBlockedDomains() []string {
 	hm.mutex.RLock()
@@ -137,7 +176,7 @@ func (hm *HostsManager) IsBlocked(domain string) bool {
 	defer hm.mutex.RUnlock()
 
 	domain = strings.ToLower(strings.TrimSpace(domain))
-	return hm.blockedDomains[domain]
+	return hm.blockedDomains[domain] || hm.budgetDomains[domain]
 }
 
 // RestoreOriginal restores the original hosts file from backup
@@ -149,7 +188,7 @@ func (hm *HostsManager) RestoreOriginal() error {
 
 	// If we have backup, restore from it
 	if _, err := os.Stat(hm.backupPath); err == nil {
-		if err := hm.copyFile(hm.backupPath, WindowsHostsPath); err != nil {
+		if err := hm.copyFile(hm.backupPath, hm.hostsPath); err != nil {
 			return fmt.Errorf("failed to restore from backup: %v", err)
 		}
 		// Remove backup file
@@ -171,7 +210,7 @@ func (hm *HostsManager) RestoreOriginal() error {
 // Private methods
 
 func (hm *HostsManager) readHostsFile() (string, error) {
-	content, err := os.ReadFile(WindowsHostsPath)
+	content, err := os.ReadFile(hm.hostsPath)
 	if err != nil {
 		return "", err
 	}
@@ -182,7 +221,7 @@ func (hm *HostsManager) writeHostsFile(content string) error {
 	log.Printf("📝 Attempting to write hosts file (%d bytes)", len(content))
 
 	// Strategy 1: Try direct write first (works if already elevated)
-	if err := os.WriteFile(WindowsHostsPath, []byte(content), 0644); err == nil {
+	if err := os.WriteFile(hm.hostsPath, []byte(content), 0644); err == nil {
 		log.Println("✅ Direct hosts file write successful")
 		go hm.flushDNSCache()
 		return nil
@@ -191,9 +230,9 @@ func (hm *HostsManager) writeHostsFile(content string) error {
 	log.Println("⚠️ Direct write failed, trying elevated methods...")
 
 	// Strategy 2: Try temp file approach
-	tempPath := WindowsHostsPath + ".tmp"
+	tempPath := hm.hostsPath + ".tmp"
 	if err := os.WriteFile(tempPath, []byte(content), 0644); err == nil {
-		if err := os.Rename(tempPath, WindowsHostsPath); err == nil {
+		if err := os.Rename(tempPath, hm.hostsPath); err == nil {
 			log.Println("✅ Temp file approach successful")
 			go hm.flushDNSCache()
 			return nil
@@ -229,7 +268,7 @@ func (hm *HostsManager) writeHostsWithPowerShell(content string) error {
 
 	cmd := fmt.Sprintf(`$content = @'
 %s
-'@; $content | Out-File -FilePath '%s' -Encoding UTF8 -Force`, escapedContent, WindowsHostsPath)
+'@; $content | Out-File -FilePath '%s' -Encoding UTF8 -Force`, escapedContent, hm.hostsPath)
 
 	// Try with PowerShell
 	if _, err := hm.runCommand("powershell", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command", cmd); err != nil {
@@ -255,7 +294,7 @@ func (hm *HostsManager) writeHostsWithRobocopy(content string) error {
 	defer os.Remove(tempFile)
 
 	// Use robocopy to copy with system permissions
-	hostsDir := filepath.Dir(WindowsHostsPath)
+	hostsDir := filepath.Dir(hm.hostsPath)
 	_, err := hm.runCommand("robocopy", tempDir, hostsDir, "hosts_temp", "hosts", "/Y", "/R:3", "/W:1")
 
 	// Robocopy exit codes 0-7 are considered success
@@ -273,17 +312,17 @@ func (hm *HostsManager) writeHostsWithIcacls(content string) error {
 	log.Println("🔧 Trying icacls permission approach...")
 
 	// First, try to take ownership and modify permissions
-	_, err1 := hm.runCommand("takeown", "/f", WindowsHostsPath)
-	_, err2 := hm.runCommand("icacls", WindowsHostsPath, "/grant", "Everyone:F")
+	_, err1 := hm.runCommand("takeown", "/f", hm.hostsPath)
+	_, err2 := hm.runCommand("icacls", hm.hostsPath, "/grant", "Everyone:F")
 
 	if err1 != nil || err2 != nil {
 		log.Printf("⚠️ icacls permission change failed: %v, %v", err1, err2)
 	}
 
 	// Try direct write again after permission change
-	if err := os.WriteFile(WindowsHostsPath, []byte(content), 0644); err == nil {
+	if err := os.WriteFile(hm.hostsPath, []byte(content), 0644); err == nil {
 		// Restore permissions
-		hm.runCommand("icacls", WindowsHostsPath, "/reset")
+		hm.runCommand("icacls", hm.hostsPath, "/reset")
 		go hm.flushDNSCache()
 		return nil
 	}
@@ -325,6 +364,12 @@ func (hm *HostsManager) updateHostsFile() error {
 	// Clean existing KidSafe section from current content
 	content := hm.cleanKidSafeSection(currentContent)
 
+	// While suspended the domain lists are kept but nothing is written
+	if hm.suspended {
+		log.Println("Hosts blocking is suspended, KidSafe section removed")
+		return hm.writeHostsFile(content)
+	}
+
 	// Add marker comments
 	content += "\n\n# === KidSafe PC Blocked Domains - START ===\n"
 
@@ -336,6 +381,16 @@ func (hm *HostsManager) updateHostsFile() error {
 		log.Printf("Adding to hosts: %s -> %s", domain, BlockedIP)
 	}
 
+	// Add domains whose daily time budget is spent
+	for domain := range hm.budgetDomains {
+		if hm.blockedDomains[domain] {
+			continue
+		}
+		content += fmt.Sprintf("%s %s\n", BlockedIP, domain)
+		domainCount++
+		log.Printf("Adding to hosts (budget): %s -> %s", domain, BlockedIP)
+	}
+
 	content += "# === KidSafe PC Blocked Domains - END ===\n"
 
 	log.Printf("Updating hosts file with %d blocked domains", domainCount)
@@ -350,7 +405,7 @@ func (hm *HostsManager) updateHostsFile() error {
 }
 
 func (hm *HostsManager) createBackup() error {
-	return hm.copyFile(WindowsHostsPath, hm.backupPath)
+	return hm.copyFile(hm.hostsPath, hm.backupPath)
 }
 
 func (hm *HostsManager) copyFile(src, dst string) error {
@@ -0,0 +1,249 @@
+// core-service/ics.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sự kiện đọc từ file iCalendar, đã quy về khoảng ngày
+type icsEvent struct {
+	UID       string
+	Summary   string
+	StartDate time.Time // 00:00 ngày bắt đầu (giờ địa phương)
+	EndDate   time.Time // 00:00 ngày kết thúc (bao gồm)
+	Recurring bool      // Có RRULE: chỉ lần xuất hiện đầu tiên được nhập
+}
+
+// Thuộc tính iCalendar: NAME;PARAM=VALUE:value
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+var icsDurationPattern = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseICSEvents đọc các VEVENT trong file .ics (RFC 5545). Chỉ dùng ngày bắt đầu
+// và kết thúc; giờ trong ngày được bỏ qua vì ngoại lệ áp dụng cho cả ngày.
+func parseICSEvents(r io.Reader) ([]icsEvent, []string, error) {
+	lines, err := unfoldICSLines(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var events []icsEvent
+	var warnings []string
+	var current []icsProperty
+	inEvent := false
+	sawCalendar := false
+
+	for _, line := range lines {
+		prop, ok := parseICSProperty(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VCALENDAR"):
+			sawCalendar = true
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT"):
+			inEvent = true
+			current = nil
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT"):
+			inEvent = false
+			event, err := buildICSEvent(current)
+			if err != nil {
+				warnings = append(warnings, err.Error())
+				continue
+			}
+			events = append(events, event)
+		case inEvent:
+			current = append(current, prop)
+		}
+	}
+
+	if !sawCalendar {
+		return nil, nil, fmt.Errorf("not an iCalendar file (missing BEGIN:VCALENDAR)")
+	}
+	return events, warnings, nil
+}
+
+// Ghép các dòng bị gập (dòng tiếp theo bắt đầu bằng dấu cách hoặc tab)
+func unfoldICSLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func parseICSProperty(line string) (icsProperty, bool) {
+	// Dấu ':' đầu tiên không nằm trong tham số có ngoặc kép
+	colon := -1
+	quoted := false
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return icsProperty{}, false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop := icsProperty{
+		name:   strings.ToUpper(parts[0]),
+		params: make(map[string]string),
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		if key, value, ok := strings.Cut(param, "="); ok {
+			prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return prop, true
+}
+
+func buildICSEvent(props []icsProperty) (icsEvent, error) {
+	var event icsEvent
+	var start, end *icsProperty
+	var duration string
+
+	for i := range props {
+		prop := &props[i]
+		switch prop.name {
+		case "UID":
+			event.UID = prop.value
+		case "SUMMARY":
+			event.Summary = unescapeICSText(prop.value)
+		case "DTSTART":
+			start = prop
+		case "DTEND":
+			end = prop
+		case "DURATION":
+			duration = prop.value
+		case "RRULE":
+			event.Recurring = true
+		}
+	}
+
+	if start == nil {
+		return event, fmt.Errorf("event '%s' has no DTSTART, skipped", event.Summary)
+	}
+
+	startTime, startIsDate, err := parseICSDate(*start)
+	if err != nil {
+		return event, fmt.Errorf("event '%s': %v", event.Summary, err)
+	}
+	event.StartDate = startOfDay(startTime)
+
+	// DTEND không bao gồm: với ngày thì lùi 1 ngày, với giờ thì lùi 1 nano giây
+	endTime := startTime
+	switch {
+	case end != nil:
+		if endTime, _, err = parseICSDate(*end); err != nil {
+			return event, fmt.Errorf("event '%s': %v", event.Summary, err)
+		}
+		endTime = exclusiveICSEnd(startTime, endTime, startIsDate)
+	case duration != "":
+		d, err := parseICSDuration(duration)
+		if err != nil {
+			return event, fmt.Errorf("event '%s': %v", event.Summary, err)
+		}
+		endTime = exclusiveICSEnd(startTime, startTime.Add(d), startIsDate)
+	}
+	event.EndDate = startOfDay(endTime)
+
+	if event.EndDate.Before(event.StartDate) {
+		event.EndDate = event.StartDate
+	}
+	if event.Summary == "" {
+		event.Summary = event.StartDate.Format(usageDateLayout)
+	}
+	return event, nil
+}
+
+func exclusiveICSEnd(start, end time.Time, isDate bool) time.Time {
+	if !end.After(start) {
+		return start
+	}
+	if isDate {
+		return end.AddDate(0, 0, -1)
+	}
+	return end.Add(-time.Nanosecond)
+}
+
+// parseICSDate đọc DATE (20250101) hoặc DATE-TIME (20250101T080000[Z]), trả về
+// thời điểm theo giờ địa phương và cho biết giá trị có phải chỉ là ngày không
+func parseICSDate(prop icsProperty) (time.Time, bool, error) {
+	value := strings.TrimSpace(prop.value)
+
+	if prop.params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, time.Local)
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("invalid date '%s'", value)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid date-time '%s'", value)
+		}
+		return t.Local(), false, nil
+	}
+
+	location := time.Local
+	if tzid := prop.params["TZID"]; tzid != "" {
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			location = loc
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date-time '%s'", value)
+	}
+	return t.Local(), false, nil
+}
+
+// parseICSDuration đọc DURATION dạng P1W, P2D, PT8H, P1DT12H...
+func parseICSDuration(value string) (time.Duration, error) {
+	match := icsDurationPattern.FindStringSubmatch(strings.TrimPrefix(strings.TrimSpace(value), "+"))
+	if match == nil {
+		return 0, fmt.Errorf("unsupported duration '%s'", value)
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total time.Duration
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		n, _ := strconv.Atoi(match[i+1])
+		total += time.Duration(n) * unit
+	}
+	return total, nil
+}
+
+func unescapeICSText(value string) string {
+	replacer := strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return strings.TrimSpace(replacer.Replace(value))
+}
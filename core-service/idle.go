@@ -0,0 +1,174 @@
+// core-service/idle.go
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Ngưỡng mặc định để coi máy là không được sử dụng
+const defaultIdleThreshold = 5 * time.Minute
+
+// IdleSource cho biết người dùng đã không thao tác (bàn phím/chuột) bao lâu
+type IdleSource interface {
+	IdleDuration() (time.Duration, error)
+}
+
+// Khoảng thời gian không sử dụng trong một session
+type IdleGap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// FakeIdleSource là nguồn idle giả lập dùng cho kiểm thử
+type FakeIdleSource struct {
+	mutex sync.Mutex
+	idle  time.Duration
+	err   error
+}
+
+func NewFakeIdleSource() *FakeIdleSource {
+	return &FakeIdleSource{}
+}
+
+// SetIdle đặt thời gian idle sẽ được trả về
+func (f *FakeIdleSource) SetIdle(idle time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.idle = idle
+}
+
+// SetError đặt lỗi sẽ được trả về (nil để xóa)
+func (f *FakeIdleSource) SetError(err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.err = err
+}
+
+func (f *FakeIdleSource) IdleDuration() (time.Duration, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.idle, f.err
+}
+
+// Thay nguồn idle (nil = tắt tính năng phát hiện idle)
+func (tm *TimeManager) SetIdleSource(source IdleSource) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.idleSource = source
+}
+
+// Ngưỡng idle theo quy tắc hiện tại (yêu cầu đã giữ mutex)
+func (tm *TimeManager) idleThresholdLocked() time.Duration {
+	if tm.rules != nil && tm.rules.IdleThresholdMinutes > 0 {
+		return time.Duration(tm.rules.IdleThresholdMinutes) * time.Minute
+	}
+	return defaultIdleThreshold
+}
+
+// Cập nhật trạng thái idle của session đang chạy. Khi máy không được dùng quá
+// ngưỡng, thời gian kể từ lần thao tác cuối không được tính vào usage.
+func (tm *TimeManager) updateIdleState(now time.Time) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if tm.idleSource == nil || tm.sessionStartTime.IsZero() {
+		return
+	}
+
+	idle, err := tm.idleSource.IdleDuration()
+	if err != nil {
+		if !tm.idleErrorLogged {
+			log.Printf("⚠️ Không đọc được thời gian idle: %v", err)
+			tm.idleErrorLogged = true
+		}
+		return
+	}
+	tm.idleErrorLogged = false
+
+	lastInput := now.Add(-idle)
+	if lastInput.Before(tm.sessionStartTime) {
+		lastInput = tm.sessionStartTime
+	}
+
+	if idle >= tm.idleThresholdLocked() {
+		if tm.idleSince.IsZero() {
+			tm.idleSince = lastInput
+			log.Printf("💤 Máy không được sử dụng từ %s, tạm dừng tính giờ", lastInput.Format("15:04:05"))
+		}
+		return
+	}
+
+	if !tm.idleSince.IsZero() {
+		tm.closeIdleGapLocked(lastInput)
+		log.Printf("▶️ Máy được sử dụng lại, tiếp tục tính giờ")
+	}
+}
+
+// Đóng khoảng idle đang mở tại thời điểm end (yêu cầu đã giữ mutex)
+func (tm *TimeManager) closeIdleGapLocked(end time.Time) {
+	if tm.idleSince.IsZero() {
+		return
+	}
+	if end.After(tm.idleSince) {
+		tm.idleGaps = append(tm.idleGaps, IdleGap{Start: tm.idleSince, End: end})
+	}
+	tm.idleSince = time.Time{}
+}
+
+// Tổng thời gian idle của session hiện tại trong khoảng [from, to] (yêu cầu đã giữ mutex)
+func (tm *TimeManager) idleDurationLocked(from, to time.Time) time.Duration {
+	total := idleOverlap(tm.idleGaps, from, to)
+	if !tm.idleSince.IsZero() {
+		total += idleOverlap([]IdleGap{{Start: tm.idleSince, End: to}}, from, to)
+	}
+	return total
+}
+
+// Tổng thời gian của các khoảng idle nằm trong [from, to]
+func idleOverlap(gaps []IdleGap, from, to time.Time) time.Duration {
+	var total time.Duration
+	for _, gap := range clipIdleGaps(gaps, from, to) {
+		total += gap.End.Sub(gap.Start)
+	}
+	return total
+}
+
+// Cắt các khoảng idle theo [from, to], bỏ các khoảng nằm ngoài
+func clipIdleGaps(gaps []IdleGap, from, to time.Time) []IdleGap {
+	var clipped []IdleGap
+	for _, gap := range gaps {
+		start, end := gap.Start, gap.End
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			clipped = append(clipped, IdleGap{Start: start, End: end})
+		}
+	}
+	return clipped
+}
+
+// Thời gian thực sự sử dụng của session hiện tại trong khoảng [from, to] (yêu cầu đã giữ mutex)
+func (tm *TimeManager) activeDurationLocked(from, to time.Time) time.Duration {
+	if !to.After(from) {
+		return 0
+	}
+	return to.Sub(from) - tm.idleDurationLocked(from, to)
+}
+
+// Thời điểm bắt đầu tính giờ cho nghỉ ngơi bắt buộc: một khoảng idle đủ dài
+// được coi như đã nghỉ (yêu cầu đã giữ mutex)
+func (tm *TimeManager) breakCounterStartLocked(breakDuration time.Duration) time.Time {
+	start := tm.sessionStartTime
+	for _, gap := range tm.idleGaps {
+		if gap.End.Sub(gap.Start) >= breakDuration && gap.End.After(start) {
+			start = gap.End
+		}
+	}
+	return start
+}
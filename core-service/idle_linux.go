@@ -0,0 +1,94 @@
+//go:build linux
+
+// core-service/idle_linux.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// linuxIdleSource dùng xprintidle khi có X11, nếu không thì dùng
+// IdleHint/IdleSinceHint của systemd-logind
+type linuxIdleSource struct{}
+
+func newPlatformIdleSource() IdleSource {
+	return &linuxIdleSource{}
+}
+
+func (s *linuxIdleSource) IdleDuration() (time.Duration, error) {
+	if os.Getenv("DISPLAY") != "" {
+		if idle, err := s.x11Idle(); err == nil {
+			return idle, nil
+		}
+	}
+	return s.logindIdle()
+}
+
+// x11Idle đọc số mili giây kể từ lần thao tác cuối qua xprintidle
+func (s *linuxIdleSource) x11Idle() (time.Duration, error) {
+	output, err := exec.Command("xprintidle").Output()
+	if err != nil {
+		return 0, err
+	}
+
+	ms, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected xprintidle output: %v", err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// logindIdle trả về thời gian idle ngắn nhất của các session đăng nhập.
+// Nếu có session chưa idle thì coi như máy đang được sử dụng.
+func (s *linuxIdleSource) logindIdle() (time.Duration, error) {
+	output, err := exec.Command("loginctl", "list-sessions", "--no-legend").Output()
+	if err != nil {
+		return 0, fmt.Errorf("loginctl list-sessions failed: %v", err)
+	}
+
+	var idle time.Duration
+	found := false
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		props, err := exec.Command("loginctl", "show-session", fields[0], "-p", "IdleHint", "-p", "IdleSinceHint").Output()
+		if err != nil {
+			continue
+		}
+
+		values := make(map[string]string)
+		for _, prop := range strings.Split(string(props), "\n") {
+			if key, value, ok := strings.Cut(strings.TrimSpace(prop), "="); ok {
+				values[key] = value
+			}
+		}
+
+		if values["IdleHint"] != "yes" {
+			return 0, nil
+		}
+
+		usec, err := strconv.ParseInt(values["IdleSinceHint"], 10, 64)
+		if err != nil || usec == 0 {
+			continue
+		}
+
+		sessionIdle := time.Since(time.UnixMicro(usec))
+		if !found || sessionIdle < idle {
+			idle = sessionIdle
+			found = true
+		}
+	}
+
+	if !found {
+		return 0, fmt.Errorf("no logind session with idle information")
+	}
+	return idle, nil
+}
@@ -0,0 +1,9 @@
+//go:build !windows && !linux
+
+// core-service/idle_other.go
+package main
+
+// Nền tảng khác chưa hỗ trợ phát hiện idle
+func newPlatformIdleSource() IdleSource {
+	return nil
+}
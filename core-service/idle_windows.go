@@ -0,0 +1,46 @@
+//go:build windows
+
+// core-service/idle_windows.go
+package main
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	idleUser32           = windows.NewLazySystemDLL("user32.dll")
+	idleKernel32         = windows.NewLazySystemDLL("kernel32.dll")
+	procGetLastInputInfo = idleUser32.NewProc("GetLastInputInfo")
+	procGetTickCount     = idleKernel32.NewProc("GetTickCount")
+)
+
+// LASTINPUTINFO trong WinAPI
+type lastInputInfo struct {
+	cbSize uint32
+	dwTime uint32
+}
+
+// windowsIdleSource đọc thời điểm thao tác cuối qua GetLastInputInfo.
+// Lưu ý: API này chỉ thấy input của session hiện tại, nên cần chạy trong
+// session của người dùng (chế độ console/Electron), không phải session 0.
+type windowsIdleSource struct{}
+
+func newPlatformIdleSource() IdleSource {
+	return &windowsIdleSource{}
+}
+
+func (s *windowsIdleSource) IdleDuration() (time.Duration, error) {
+	info := lastInputInfo{cbSize: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	ret, _, err := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		return 0, fmt.Errorf("GetLastInputInfo failed: %v", err)
+	}
+
+	// GetTickCount quay vòng sau ~49 ngày, phép trừ uint32 vẫn đúng
+	tick, _, _ := procGetTickCount.Call()
+	return time.Duration(uint32(tick)-info.dwTime) * time.Millisecond, nil
+}
@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -16,6 +17,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -34,6 +36,9 @@ const (
 	ServiceName        = "ParentalControlService"
 	ServiceDisplayName = "Parental Control DNS Service"
 	ServiceDescription = "DNS filtering service for parental control"
+
+	// Database used when running as a Windows service
+	ServiceDatabasePath = "C:\\ProgramData\\ParentalControl\\parental_control.db"
 )
 
 // SSE Client represents a connected SSE client
@@ -51,10 +56,16 @@ type CoreService struct {
 	firebaseService *FirebaseService
 	authService     *AuthService
 	timeManager     *TimeManager
+	siteBudgets     *SiteBudgetManager
 	blocklist       sync.Map
 	whitelist       sync.Map
 	profiles        sync.Map
 	config          *Config
+	// Fail-closed enforcement state, restored at startup
+	protection      ProtectionState
+	protectionMutex sync.Mutex
+	// Serializes rule_sync writes: local edits, Firebase merges and pushes
+	ruleSyncMutex sync.Mutex
 	// SSE support for real-time updates
 	sseClients map[string]*SSEClient
 	sseMutex   sync.RWMutex
@@ -95,6 +106,16 @@ type DNSLog struct {
 	ProfileID int    `json:"profile_id"`
 }
 
+type TimeAuditEntry struct {
+	ID        int    `json:"id"`
+	Action    string `json:"action"`
+	UsageDate string `json:"usage_date"`
+	Minutes   int64  `json:"minutes"`
+	Reason    string `json:"reason"`
+	Actor     string `json:"actor"`
+	CreatedAt string `json:"created_at"`
+}
+
 type Profile struct {
 	ID          int    `json:"id"`
 	Name        string `json:"name"`
@@ -128,10 +149,15 @@ func main() {
 			}
 			return
 		case "--uninstall":
+			// Protection can only be removed by the parent account linked to this PC
+			if err := authorizeUninstall(); err != nil {
+				log.Fatalf("Uninstall not authorized: %v", err)
+			}
 			err := uninstallService()
 			if err != nil {
 				log.Fatalf("Failed to uninstall service: %v", err)
 			}
+			removeEnforcement()
 			return
 		case "--start":
 			err := startService()
@@ -234,6 +260,7 @@ func runConsole() {
 	// Start TimeManager
 	log.Println("🕐 Starting time management service...")
 	go service.timeManager.StartMonitoring()
+	go service.siteBudgets.Start()
 
 	log.Println("✅ KidSafe PC started successfully using hosts-based blocking")
 	log.Printf("📡 API Server: http://localhost:%s", config.APIPort)
@@ -330,7 +357,7 @@ func (m *parentalControlService) Execute(args []string, r <-chan svc.ChangeReque
 	config := &Config{
 		APIPort:      "8081",
 		LogLevel:     "INFO",
-		DatabasePath: "C:\\ProgramData\\ParentalControl\\parental_control.db",
+		DatabasePath: ServiceDatabasePath,
 	}
 
 	coreService, err := NewCoreService(config)
@@ -364,6 +391,7 @@ func (m *parentalControlService) Execute(args []string, r <-chan svc.ChangeReque
 
 	// Start TimeManager
 	go coreService.timeManager.StartMonitoring()
+	go coreService.siteBudgets.Start()
 
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 
@@ -399,28 +427,62 @@ func NewCoreService(config *Config) (*CoreService, error) {
 		return nil, fmt.Errorf("failed to initialize hosts manager: %v", err)
 	}
 
-	// Initialize TimeManager
-	timeManager := NewTimeManager()
-
 	service := &CoreService{
 		db:           db,
 		config:       config,
 		hostsManager: hostsManager,
-		timeManager:  timeManager,
 		sseClients:   make(map[string]*SSEClient),
 	}
 
+	// Initialize database tables
+	if err := service.initDB(); err != nil {
+		return nil, err
+	}
+
+	// Initialize TimeManager (usage is stored in the main database)
+	timeManager := NewTimeManager(db)
+	service.timeManager = timeManager
+
+	// Load the last saved time rules (local or from Firebase) before monitoring starts
+	if err := timeManager.LoadStoredRules(); err != nil {
+		log.Printf("Warning: could not load saved time rules: %v", err)
+	}
+
 	// Set callback for time manager status changes
 	timeManager.SetStatusChangeCallback(func(blocked bool, reason string) {
 		log.Printf("🕐 TimeManager status change: blocked=%v, reason=%s", blocked, reason)
+		// Remember the block so a restart after a stop or crash can put it back
+		service.updateProtectionState("", func(state *ProtectionState) {
+			state.NetworkBlocked = blocked
+			state.BlockReason = reason
+		})
+		// Keep the event for the parent app's usage report
+		service.recordBlockEvent(blocked, reason)
 		// Broadcast to SSE clients if needed
 		go service.broadcastTimeStatusUpdate(blocked, reason)
 	})
 
-	// Initialize database tables
-	if err := service.initDB(); err != nil {
-		return nil, err
-	}
+	// Forward advance warnings to SSE clients before time-based blocking
+	timeManager.SetWarningCallback(func(event TimeEvent, leadMinutes int) {
+		service.broadcastTimeWarning(event, leadMinutes)
+	})
+
+	// Audit system clock changes and alert the parent according to policy
+	timeManager.SetClockTamperCallback(func(event ClockTamperEvent) {
+		service.handleClockTamperEvent(event)
+	})
+
+	// Restore saved enforcement state before any rule is evaluated
+	service.reconcileProtection()
+
+	// Use the allowed-during-block list of the child who owns this PC
+	timeManager.SetActiveProfile(loadDeviceInfo(db, loadDeviceID(db)).ProfileID)
+
+	// Initialize per-site time budgets (blocks spent budgets through the hosts file)
+	service.siteBudgets = NewSiteBudgetManager(db, hostsManager)
+	service.siteBudgets.SetExhaustedCallback(func(status SiteBudgetStatus) {
+		service.broadcastSiteBudgetExhausted(status)
+	})
 
 	// Load rules into memory
 	if err := service.loadRules(); err != nil {
@@ -775,6 +837,28 @@ func (s *CoreService) initDB() error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (profile_id) REFERENCES profiles(id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS rule_sync (
+			firebase_key TEXT PRIMARY KEY,
+			domain TEXT NOT NULL,
+			url TEXT,
+			status TEXT NOT NULL,
+			added_at INTEGER DEFAULT 0,
+			added_by TEXT,
+			updated_at INTEGER DEFAULT 0,
+			pending BOOLEAN DEFAULT 0,
+			devices TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_rule_sync_domain ON rule_sync(domain)`,
+		`CREATE TABLE IF NOT EXISTS remote_commands (
+			id TEXT PRIMARY KEY,
+			type TEXT,
+			issued_by TEXT,
+			status TEXT NOT NULL,
+			result TEXT,
+			error TEXT,
+			received_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME
+		)`,
 		`CREATE TABLE IF NOT EXISTS dns_logs (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			domain TEXT NOT NULL,
@@ -791,6 +875,97 @@ func (s *CoreService) initDB() error {
 			profile_id INTEGER DEFAULT 1,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`CREATE TABLE IF NOT EXISTS time_audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			action TEXT NOT NULL,
+			usage_date TEXT,
+			minutes INTEGER DEFAULT 0,
+			reason TEXT,
+			actor TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS usage_days (
+			date TEXT PRIMARY KEY,
+			total_minutes INTEGER DEFAULT 0,
+			adjustment_minutes INTEGER DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS usage_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			usage_date TEXT NOT NULL,
+			start_time TEXT NOT NULL,
+			end_time TEXT NOT NULL,
+			duration_minutes INTEGER DEFAULT 0,
+			idle_minutes INTEGER DEFAULT 0,
+			idle_gaps TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_usage_sessions_date ON usage_sessions(usage_date)`,
+		`CREATE TABLE IF NOT EXISTS time_block_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			usage_date TEXT NOT NULL,
+			blocked BOOLEAN NOT NULL,
+			reason TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_time_block_events_date ON time_block_events(usage_date)`,
+		`CREATE TABLE IF NOT EXISTS usage_upload_queue (
+			usage_date TEXT PRIMARY KEY,
+			revision INTEGER DEFAULT 1,
+			attempts INTEGER DEFAULT 0,
+			last_error TEXT,
+			queued_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS time_grants (
+			id TEXT PRIMARY KEY,
+			grant_date TEXT NOT NULL,
+			minutes INTEGER NOT NULL,
+			reason TEXT,
+			granted_by TEXT,
+			created_at INTEGER DEFAULT 0,
+			source TEXT NOT NULL DEFAULT 'local'
+		)`,
+		`CREATE TABLE IF NOT EXISTS time_rules (
+			version INTEGER PRIMARY KEY,
+			source TEXT NOT NULL,
+			rules TEXT NOT NULL,
+			source_updated_at INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS time_rule_overrides (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			start_date TEXT NOT NULL,
+			end_date TEXT NOT NULL,
+			rule TEXT NOT NULL,
+			source TEXT DEFAULT 'manual',
+			uid TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS site_budgets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			category TEXT,
+			domains TEXT NOT NULL,
+			daily_limit_minutes INTEGER DEFAULT 0,
+			enabled BOOLEAN DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS site_activity (
+			usage_date TEXT NOT NULL,
+			domain TEXT NOT NULL,
+			minute INTEGER NOT NULL,
+			source TEXT,
+			PRIMARY KEY (usage_date, domain, minute)
+		)`,
+		`CREATE TABLE IF NOT EXISTS service_state (
+			key TEXT PRIMARY KEY,
+			value TEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS usage_checkpoint (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			data TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
 		`INSERT OR IGNORE INTO profiles (id, name, description) VALUES (1, 'Default', 'Default profile')`,
 	}
 
@@ -799,6 +974,14 @@ func (s *CoreService) initDB() error {
 			return err
 		}
 	}
+
+	// Columns added to existing tables; fails harmlessly when already present
+	migrations := []string{
+		`ALTER TABLE rule_sync ADD COLUMN devices TEXT`,
+	}
+	for _, query := range migrations {
+		s.db.Exec(query)
+	}
 	return nil
 }
 
@@ -904,6 +1087,7 @@ func (s *CoreService) StartAPIServer(ctx context.Context) error {
 	// Block rules
 	api.HandleFunc("/rules", s.handleGetRules).Methods("GET")
 	api.HandleFunc("/rules", s.handleAddRule).Methods("POST")
+	api.HandleFunc("/rules/{id}", s.handleUpdateRule).Methods("PUT")
 	api.HandleFunc("/rules/{id}", s.handleDeleteRule).Methods("DELETE")
 
 	// Whitelist rules
@@ -949,6 +1133,10 @@ func (s *CoreService) StartAPIServer(ctx context.Context) error {
 	api.HandleFunc("/firebase/force-sync", s.handleFirebaseForceSync).Methods("POST")
 	api.HandleFunc("/firebase/status", s.handleFirebaseStatus).Methods("GET")
 
+	// This PC under the family's devices
+	api.HandleFunc("/device", s.handleGetDevice).Methods("GET")
+	api.HandleFunc("/device", s.handleUpdateDevice).Methods("PUT")
+
 	// Real-time updates endpoint using Server-Sent Events
 	api.HandleFunc("/events/rules", s.handleRulesSSE).Methods("GET")
 
@@ -957,8 +1145,36 @@ func (s *CoreService) StartAPIServer(ctx context.Context) error {
 	api.HandleFunc("/time/rules", s.handleUpdateTimeRules).Methods("POST")
 	api.HandleFunc("/time/status", s.handleGetTimeStatus).Methods("GET")
 	api.HandleFunc("/time/usage", s.handleGetTimeUsage).Methods("GET")
+	api.HandleFunc("/time/usage/hourly", s.handleGetHourlyTimeUsage).Methods("GET")
 	api.HandleFunc("/time/reset", s.handleResetTimeUsage).Methods("POST")
+	api.HandleFunc("/time/adjust", s.handleAdjustTimeUsage).Methods("POST")
+	api.HandleFunc("/time/audit", s.handleGetTimeAudit).Methods("GET")
+	api.HandleFunc("/time/grants", s.handleGetTimeGrants).Methods("GET")
+	api.HandleFunc("/time/grants", s.handleAddTimeGrant).Methods("POST")
+	api.HandleFunc("/time/grants/{id}", s.handleDeleteTimeGrant).Methods("DELETE")
 	api.HandleFunc("/time/toggle", s.handleToggleTimeBlocking).Methods("POST")
+	api.HandleFunc("/time/next-change", s.handleGetNextTimeChange).Methods("GET")
+	api.HandleFunc("/time/overrides", s.handleGetTimeOverrides).Methods("GET")
+	api.HandleFunc("/time/overrides", s.handleAddTimeOverride).Methods("POST")
+	api.HandleFunc("/time/overrides/import", s.handleImportTimeOverrides).Methods("POST")
+	api.HandleFunc("/time/overrides/{id}", s.handleDeleteTimeOverride).Methods("DELETE")
+	api.HandleFunc("/time/allowed-destinations", s.handleGetAllowedDestinations).Methods("GET")
+
+	// Fail-closed enforcement (disabling protection needs the parent account)
+	api.HandleFunc("/protection", s.handleGetProtection).Methods("GET")
+	api.HandleFunc("/protection/disable", s.handleDisableProtection).Methods("POST")
+	api.HandleFunc("/protection/enable", s.handleEnableProtection).Methods("POST")
+	api.HandleFunc("/protection/mode", s.handleSetProtectionMode).Methods("POST")
+	api.HandleFunc("/time/clock", s.handleGetClockState).Methods("GET")
+	api.HandleFunc("/time/clock/acknowledge", s.handleAcknowledgeClockChange).Methods("POST")
+
+	// Per-site time budgets and activity reports
+	api.HandleFunc("/budgets", s.handleGetSiteBudgets).Methods("GET")
+	api.HandleFunc("/budgets", s.handleAddSiteBudget).Methods("POST")
+	api.HandleFunc("/budgets/{id}", s.handleUpdateSiteBudget).Methods("PUT")
+	api.HandleFunc("/budgets/{id}", s.handleDeleteSiteBudget).Methods("DELETE")
+	api.HandleFunc("/activity/sites", s.handleGetSiteActivity).Methods("GET")
+	api.HandleFunc("/activity/visits", s.handleReportVisits).Methods("POST")
 
 	// Firebase Time Rules endpoints
 	api.HandleFunc("/time/firebase-rules", s.handleGetFirebaseTimeRules).Methods("GET")
@@ -1026,6 +1242,16 @@ func installService() error {
 	}
 	defer s.Close()
 
+	// Restart automatically after a crash or kill so protection comes back
+	recoveryActions := []mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+	}
+	if err := s.SetRecoveryActions(recoveryActions, 24*60*60); err != nil {
+		log.Printf("Warning: failed to set service recovery actions: %v", err)
+	}
+
 	eventlog.InstallAsEventCreate(ServiceName, eventlog.Error|eventlog.Warning|eventlog.Info)
 	log.Printf("Service %s installed successfully", ServiceName)
 	return nil
@@ -1217,7 +1443,18 @@ func (s *CoreService) handleSystemConfigure(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Rules applied to hosts file"})
 }
 
+// Removes every KidSafe hosts entry, so only the parent may do it
 func (s *CoreService) handleSystemRestore(w http.ResponseWriter, r *http.Request) {
+	var request parentAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !s.authorizeParent(w, request) {
+		return
+	}
+
 	err := s.hostsManager.RestoreOriginal()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -1278,6 +1515,9 @@ func (s *CoreService) handleAddRule(w http.ResponseWriter, r *http.Request) {
 
 	s.blocklist.Store(strings.ToLower(nd), rule.Category)
 
+	// Share with the parent app
+	s.recordLocalRuleChange(nd, blockedUrlActive)
+
 	// Broadcast update to SSE clients
 	go s.broadcastRulesUpdate()
 
@@ -1296,6 +1536,16 @@ func (s *CoreService) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The last rule of a domain blocked on every device by the parent app stays
+	var others int
+	s.db.QueryRow("SELECT COUNT(*) FROM block_rules WHERE domain = ? AND id != ?", domain, id).Scan(&others)
+	if others == 0 {
+		if err := s.checkLocalRuleRemoval(domain); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
 	_, err = s.db.Exec("DELETE FROM block_rules WHERE id = ?", id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -1309,6 +1559,13 @@ func (s *CoreService) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
 
 	s.blocklist.Delete(strings.ToLower(normalizeDomain(domain)))
 
+	// Remove from the parent app too, unless another rule still blocks the domain
+	var remaining int
+	s.db.QueryRow("SELECT COUNT(*) FROM block_rules WHERE domain = ?", domain).Scan(&remaining)
+	if remaining == 0 {
+		s.recordLocalRuleChange(domain, blockedUrlDeleted)
+	}
+
 	// Broadcast update to SSE clients
 	go s.broadcastRulesUpdate()
 
@@ -1316,6 +1573,59 @@ func (s *CoreService) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
+// handleUpdateRule enables or disables a rule without deleting it
+func (s *CoreService) handleUpdateRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var request struct {
+		IsActive *bool `json:"is_active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.IsActive == nil {
+		http.Error(w, "is_active is required", http.StatusBadRequest)
+		return
+	}
+
+	var domain, category string
+	err := s.db.QueryRow("SELECT domain, COALESCE(category, '') FROM block_rules WHERE id = ?", id).Scan(&domain, &category)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !*request.IsActive {
+		if err := s.checkLocalRuleRemoval(domain); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	// Every rule of the domain changes together, as on the parent app
+	_, err = s.db.Exec("UPDATE block_rules SET is_active = ? WHERE domain = ?", *request.IsActive, domain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.syncRulesToHosts(); err != nil {
+		log.Printf("Warning: Failed to update hosts file: %v", err)
+	}
+
+	status := blockedUrlInactive
+	if *request.IsActive {
+		status = blockedUrlActive
+		s.blocklist.Store(strings.ToLower(domain), category)
+	} else {
+		s.blocklist.Delete(strings.ToLower(domain))
+	}
+	s.recordLocalRuleChange(domain, status)
+
+	// Broadcast update to SSE clients
+	go s.broadcastRulesUpdate()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
 func (s *CoreService) handleGetWhitelist(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode([]WhitelistRule{})
@@ -1479,18 +1789,93 @@ func (s *CoreService) handleFirebaseStatus(w http.ResponseWriter, r *http.Reques
 	})
 }
 
+// handleGetDevice returns how this PC is registered under the family's devices
+func (s *CoreService) handleGetDevice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	info := loadDeviceInfo(s.db, loadDeviceID(s.db))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"device":  info,
+	})
+}
+
+// handleUpdateDevice sets the name and owner profile of this PC and registers it again
+func (s *CoreService) handleUpdateDevice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		Name      string `json:"name"`
+		ProfileID int    `json:"profile_id"`
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil || json.Unmarshal(body, &request) != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	current := loadDeviceInfo(s.db, loadDeviceID(s.db))
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		name = current.Name
+	}
+	profileID := request.ProfileID
+	if profileID == 0 {
+		profileID = current.ProfileID
+	}
+	var exists int
+	if s.db.QueryRow("SELECT COUNT(*) FROM profiles WHERE id = ?", profileID).Scan(&exists); exists == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("unknown profile %d", profileID),
+		})
+		return
+	}
+
+	// The owner profile decides which sites stay reachable during a block, so
+	// only the parent may switch it when linked
+	if profileID != current.ProfileID && !s.authorizeParentBody(w, body) {
+		return
+	}
+
+	if err := saveDeviceSettings(s.db, name, profileID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	s.timeManager.SetActiveProfile(profileID)
+
+	if s.firebaseService != nil {
+		go s.firebaseService.registerDevice()
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"device":  loadDeviceInfo(s.db, loadDeviceID(s.db)),
+	})
+}
+
 // DNS preparation methods removed - using hosts file approach
 
 // Shutdown method - clean hosts file and close resources
 func (s *CoreService) Shutdown() {
 	log.Println("Shutting down KidSafe PC...")
 
-	// Stop TimeManager first (this will unblock network)
+	// Stop TimeManager first: it ends the session and lifts the network block,
+	// unless persistent enforcement keeps the block until the service runs again
 	if s.timeManager != nil {
 		log.Println("Stopping TimeManager...")
 		s.timeManager.Stop()
 	}
 
+	if s.siteBudgets != nil {
+		s.siteBudgets.Stop()
+	}
+
 	// Stop Firebase service
 	if s.firebaseService != nil {
 		log.Println("Stopping Firebase service...")
@@ -1505,8 +1890,10 @@ func (s *CoreService) Shutdown() {
 		s.authService.Stop()
 	}
 
-	// Restore original hosts file
-	if s.hostsManager != nil {
+	// Restore original hosts file (persistent mode keeps the blocks until an authorized uninstall)
+	if protection := s.GetProtectionState(); protection.Mode == EnforcementPersistent && !protection.Disabled {
+		log.Println("Persistent enforcement: keeping hosts file blocks in place")
+	} else if s.hostsManager != nil {
 		log.Println("Restoring original hosts file...")
 		if err := s.hostsManager.Cleanup(); err != nil {
 			log.Printf("Warning: Failed to cleanup hosts file: %v", err)
@@ -1603,7 +1990,7 @@ OPTIONS:
   --ui           Force open web UI after starting
   --no-ui        Console mode only (no UI)
   --install      Install as Windows Service
-  --uninstall    Uninstall Windows Service
+  --uninstall    Uninstall Windows Service and remove all blocks (asks for the parent account)
   --start        Start Windows Service
   --help, -h     Show this help
 
@@ -1765,31 +2152,15 @@ func (s *CoreService) handleManualFirebaseSync(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Update hosts file
-	if err := s.hostsManager.UpdateBlockedDomains(domains); err != nil {
+	// Merge with the local rules (keeps changes made on the PC) and update hosts file
+	if err := s.firebaseService.syncBlockedUrls("manual sync", blockedUrls); err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Failed to update hosts file: " + err.Error(),
+			"error":   "Failed to sync rules: " + err.Error(),
 		})
 		return
 	}
 
-	// Update database - remove existing firebase-sync rules
-	_, err := s.db.Exec("DELETE FROM block_rules WHERE category = 'firebase-sync'")
-	if err != nil {
-		log.Printf("Warning: Failed to clear existing firebase-sync rules: %v", err)
-	}
-
-	// Add new firebase-sync rules to database
-	for _, domain := range domains {
-		_, err := s.db.Exec(
-			"INSERT INTO block_rules (domain, category, profile_id, reason, is_active) VALUES (?, ?, ?, ?, ?)",
-			domain, "firebase-sync", 1, "Synced from Android app", true)
-		if err != nil {
-			log.Printf("Warning: Failed to insert firebase-sync rule for %s: %v", domain, err)
-		}
-	}
-
 	log.Printf("📱 Manual sync completed: %d URLs synced to database", len(domains))
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1965,6 +2336,73 @@ func (s *CoreService) broadcastTimeStatusUpdate(blocked bool, reason string) {
 	}
 }
 
+// Broadcast an advance warning before time-based blocking to SSE clients
+func (s *CoreService) broadcastTimeWarning(event TimeEvent, leadMinutes int) {
+	message, _ := json.Marshal(map[string]interface{}{
+		"type":         "time_warning",
+		"event":        event,
+		"lead_minutes": leadMinutes,
+	})
+
+	s.broadcastSSE(string(message))
+}
+
+// handleClockTamperEvent records a system clock change in the audit trail and,
+// unless the policy is "ignore", notifies SSE clients and the parent app
+func (s *CoreService) handleClockTamperEvent(event ClockTamperEvent) {
+	// Parent acknowledgements are audited by the API handler with their reason
+	if event.Source != "parent" {
+		action := "clock_tamper"
+		if event.Type == "clock_tamper_cleared" {
+			action = "clock_corrected"
+		}
+		s.recordTimeAudit(action, event.ExpectedTime.Format(usageDateLayout), event.OffsetSeconds/60,
+			fmt.Sprintf("%s (source: %s, offset: %ds, policy: %s)", event.Message, event.Source, event.OffsetSeconds, event.Policy), "system")
+	}
+
+	if event.Policy == ClockPolicyIgnore {
+		return
+	}
+
+	message, _ := json.Marshal(map[string]interface{}{
+		"type":  "clock_tamper",
+		"event": event,
+	})
+	s.broadcastSSE(string(message))
+
+	if s.firebaseService != nil {
+		go s.firebaseService.updatePCStatus()
+	}
+}
+
+// Notify SSE clients that a site budget has been used up for today
+func (s *CoreService) broadcastSiteBudgetExhausted(status SiteBudgetStatus) {
+	message, _ := json.Marshal(map[string]interface{}{
+		"type":   "site_budget_exhausted",
+		"budget": status,
+	})
+
+	s.broadcastSSE(string(message))
+}
+
+// broadcastSSE sends a raw message to every connected SSE client
+func (s *CoreService) broadcastSSE(message string) {
+	s.sseMutex.Lock()
+	defer s.sseMutex.Unlock()
+
+	for clientID, client := range s.sseClients {
+		select {
+		case client.channel <- message:
+			// Message sent successfully
+		default:
+			// Channel is full, client might be slow - remove it
+			log.Printf("⚠️ Removing slow SSE client: %s", clientID)
+			delete(s.sseClients, clientID)
+			close(client.channel)
+		}
+	}
+}
+
 // === TIME MANAGEMENT API HANDLERS ===
 
 // Get current time rules
@@ -1980,10 +2418,16 @@ func (s *CoreService) handleGetTimeRules(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	response := map[string]interface{}{
 		"status": "success",
 		"rules":  rules,
-	})
+	}
+	if stored := s.timeManager.GetStoredRules(); stored != nil {
+		response["version"] = stored.Version
+		response["source"] = stored.Source
+		response["updatedAt"] = stored.UpdatedAt
+	}
+	json.NewEncoder(w).Encode(response)
 }
 
 // Update time rules
@@ -1991,11 +2435,18 @@ func (s *CoreService) handleUpdateTimeRules(w http.ResponseWriter, r *http.Reque
 	w.Header().Set("Content-Type", "application/json")
 
 	var newRules TimeRules
-	if err := json.NewDecoder(r.Body).Decode(&newRules); err != nil {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || json.Unmarshal(body, &newRules) != nil {
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
 
+	// Local rules win over Firebase until the parent edits them again, so the
+	// parent must confirm when linked
+	if !s.authorizeParentBody(w, body) {
+		return
+	}
+
 	// Validate rules
 	if err := s.validateTimeRules(&newRules); err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -2005,13 +2456,23 @@ func (s *CoreService) handleUpdateTimeRules(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Update rules
-	s.timeManager.UpdateRules(newRules)
+	// Save and apply; rules configured here win over older rules from Firebase
+	stored, err := s.timeManager.SaveLocalRules(newRules)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Failed to save time rules: %v", err),
+		})
+		return
+	}
+	s.recordTimeAudit("update_rules", "", 0, fmt.Sprintf("version %d", stored.Version), "pc-admin")
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"message": "Time rules updated successfully",
 		"rules":   newRules,
+		"version": stored.Version,
+		"source":  stored.Source,
 	})
 }
 
@@ -2036,72 +2497,79 @@ func (s *CoreService) handleGetTimeStatus(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// Get time usage statistics
-func (s *CoreService) handleGetTimeUsage(w http.ResponseWriter, r *http.Request) {
+// Get the fail-closed enforcement state
+func (s *CoreService) handleGetProtection(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get days parameter (default 7)
-	days := r.URL.Query().Get("days")
-	if days == "" {
-		days = "7"
-	}
-
-	// For now, just return today's usage
-	// You can extend this to return multiple days
-	todayUsage := s.timeManager.getTodayUsage()
-
+	state := s.GetProtectionState()
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":        true,
-		"today_usage":    todayUsage,
-		"requested_days": days,
-		"message":        "Time usage data retrieved",
+		"mode":           state.Mode,
+		"disabled":       state.Disabled,
+		"networkBlocked": state.NetworkBlocked,
+		"blockReason":    state.BlockReason,
+		"parentLinked":   state.ParentUID != "",
+		"changedBy":      state.ChangedBy,
+		"updatedAt":      state.UpdatedAt,
 	})
 }
 
-// Reset time usage (admin function)
-func (s *CoreService) handleResetTimeUsage(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// This would reset usage data - implement if needed
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Time usage reset (feature not implemented yet)",
-	})
+// Parent credentials sent with actions that lower protection
+type parentAuthRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Reason   string `json:"reason"`
+	Mode     string `json:"mode"`
 }
 
-// Toggle time blocking manually (emergency override)
-func (s *CoreService) handleToggleTimeBlocking(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// Check the parent credentials of a request, writing the error response on failure
+func (s *CoreService) authorizeParent(w http.ResponseWriter, request parentAuthRequest) bool {
+	parentUID := s.GetProtectionState().ParentUID
+	if uid := s.linkedParentUID(); uid != "" {
+		parentUID = uid
+	}
 
-	var request struct {
-		Action string `json:"action"` // "block" or "unblock"
-		Reason string `json:"reason"`
+	if err := verifyParentCredentials(parentUID, strings.TrimSpace(request.Email), request.Password); err != nil {
+		log.Printf("🛡️ Parent authorization failed: %v", err)
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Parent authorization failed: %v", err),
+		})
+		return false
+	}
+	return true
+}
+
+// Check the parent credentials ("email", "password") sent in a JSON body along
+// with an action that lowers protection
+func (s *CoreService) authorizeParentBody(w http.ResponseWriter, body []byte) bool {
+	var request parentAuthRequest
+	if len(body) > 0 {
+		json.Unmarshal(body, &request)
 	}
+	return s.authorizeParent(w, request)
+}
+
+// Turn off all blocking until the parent enables protection again
+func (s *CoreService) handleDisableProtection(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
+	var request parentAuthRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
 
-	var err error
-	var message string
-
-	switch request.Action {
-	case "block":
-		err = s.timeManager.blockNetwork()
-		message = "Network blocked manually"
-	case "unblock":
-		err = s.timeManager.unblockNetwork()
-		message = "Network unblocked manually"
-	default:
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Invalid action. Use 'block' or 'unblock'",
-		})
+	if !s.authorizeParent(w, request) {
 		return
 	}
 
-	if err != nil {
+	actor := "parent"
+	if request.Email != "" {
+		actor = strings.TrimSpace(request.Email)
+	}
+	if err := s.setProtectionDisabled(true, actor, request.Reason); err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
 			"error":   err.Error(),
@@ -2111,15 +2579,1072 @@ func (s *CoreService) handleToggleTimeBlocking(w http.ResponseWriter, r *http.Re
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
-		"message": message,
-		"action":  request.Action,
+		"message": "Protection disabled",
 	})
 }
 
-// Validate time rules
-func (s *CoreService) validateTimeRules(rules *TimeRules) error {
-	// Validate weekdays rules
-	if err := s.validateDayRule(&rules.Weekdays); err != nil {
+// Turn protection back on (no credentials needed to raise protection)
+func (s *CoreService) handleEnableProtection(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := s.setProtectionDisabled(false, "pc-admin", ""); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Protection enabled",
+	})
+}
+
+// Switch between standard and persistent enforcement; leaving persistent mode needs the parent
+func (s *CoreService) handleSetProtectionMode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request parentAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	actor := "pc-admin"
+	if request.Mode == EnforcementStandard && s.GetProtectionState().Mode != EnforcementStandard {
+		if !s.authorizeParent(w, request) {
+			return
+		}
+		actor = "parent"
+		if request.Email != "" {
+			actor = strings.TrimSpace(request.Email)
+		}
+	}
+
+	if err := s.setEnforcementMode(request.Mode, actor); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Protection mode set to " + request.Mode,
+	})
+}
+
+// Get the destinations that stay reachable while the network is blocked, with resolved IPs
+func (s *CoreService) handleGetAllowedDestinations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"destinations": s.timeManager.GetAllowedDestinations(),
+	})
+}
+
+// Get the system clock tampering state
+func (s *CoreService) handleGetClockState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"clock":       s.timeManager.GetClockState(),
+		"server_time": time.Now(),
+	})
+}
+
+// Accept the current system time as correct after a detected clock change
+func (s *CoreService) handleAcknowledgeClockChange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		Reason string `json:"reason"`
+		Actor  string `json:"actor"`
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil || (len(body) > 0 && json.Unmarshal(body, &request) != nil) {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if !s.timeManager.IsClockTampered() {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "System clock is not flagged as changed",
+			"clock":   s.timeManager.GetClockState(),
+		})
+		return
+	}
+
+	// Accepting the clock lifts the clock-tamper policy, the parent must confirm when linked
+	if !s.authorizeParentBody(w, body) {
+		return
+	}
+
+	s.timeManager.AcknowledgeClockChange()
+
+	reason := request.Reason
+	if reason == "" {
+		reason = "Current system time accepted as correct"
+	}
+	s.recordTimeAudit("clock_acknowledge", time.Now().Format(usageDateLayout), 0, reason, request.Actor)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Current system time accepted",
+		"clock":   s.timeManager.GetClockState(),
+	})
+}
+
+// Get the next time-based state change (child-facing, polled by the UI and extension)
+func (s *CoreService) handleGetNextTimeChange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	next := s.timeManager.GetNextChange()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"next_change": next,
+		"server_time": time.Now(),
+	})
+}
+
+// Get time usage statistics
+// Query: days=N (default 7) or from/to=YYYY-MM-DD, group=day|week|month, sessions=true|false
+func (s *CoreService) handleGetTimeUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	from, to, err := parseUsageRange(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// Individual sessions are only loaded when requested
+	includeSessions := r.URL.Query().Get("sessions") == "true"
+	history, err := s.timeManager.GetUsageHistory(from, to, includeSessions)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Failed to load usage history: " + err.Error(),
+		})
+		return
+	}
+
+	var total int64
+	for i := range history {
+		total += history[i].Total
+		if !includeSessions {
+			history[i].Sessions = nil
+		}
+	}
+
+	response := map[string]interface{}{
+		"success":       true,
+		"today_usage":   s.timeManager.getTodayUsage(),
+		"from":          from.Format(usageDateLayout),
+		"to":            to.Format(usageDateLayout),
+		"days":          history,
+		"total_minutes": total,
+		"message":       "Time usage data retrieved",
+	}
+	if len(history) > 0 {
+		response["average_daily_minutes"] = float64(total) / float64(len(history))
+	}
+
+	switch group := r.URL.Query().Get("group"); group {
+	case "", "day":
+	case "week", "month":
+		summary, err := s.timeManager.GetUsageSummary(from, to, group)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "Failed to load usage summary: " + err.Error(),
+			})
+			return
+		}
+		response["summary"] = summary
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Invalid group. Use 'day', 'week' or 'month'",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// Get hourly usage breakdown for a date range (same query parameters as /time/usage)
+func (s *CoreService) handleGetHourlyTimeUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	if date := query.Get("date"); date != "" && query.Get("from") == "" && query.Get("to") == "" {
+		query.Set("from", date)
+		query.Set("to", date)
+		r.URL.RawQuery = query.Encode()
+	} else if query.Get("days") == "" && query.Get("from") == "" {
+		query.Set("days", "1")
+		r.URL.RawQuery = query.Encode()
+	}
+
+	from, to, err := parseUsageRange(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	hours, err := s.timeManager.GetHourlyUsage(from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Failed to load usage history: " + err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"from":    from.Format(usageDateLayout),
+		"to":      to.Format(usageDateLayout),
+		"hours":   hours,
+	})
+}
+
+// parseUsageRange reads from/to (YYYY-MM-DD) or days from the query string.
+// Without explicit dates the range ends today and covers the last N days.
+func parseUsageRange(r *http.Request) (time.Time, time.Time, error) {
+	const maxUsageRangeDays = 3660
+
+	query := r.URL.Query()
+	today := startOfDay(time.Now())
+	from, to := today, today
+
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.ParseInLocation(usageDateLayout, value, time.Local)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid 'to' date '%s' (use YYYY-MM-DD)", value)
+		}
+		to = parsed
+	}
+
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.ParseInLocation(usageDateLayout, value, time.Local)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid 'from' date '%s' (use YYYY-MM-DD)", value)
+		}
+		from = parsed
+	} else {
+		days := 7
+		if value := query.Get("days"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxUsageRangeDays {
+				return from, to, fmt.Errorf("days must be between 1 and %d", maxUsageRangeDays)
+			}
+			days = n
+		}
+		from = to.AddDate(0, 0, -(days - 1))
+	}
+
+	if from.After(to) {
+		return from, to, fmt.Errorf("'from' must not be after 'to'")
+	}
+	if to.Sub(from) > maxUsageRangeDays*24*time.Hour {
+		return from, to, fmt.Errorf("date range must not exceed %d days", maxUsageRangeDays)
+	}
+
+	return from, to, nil
+}
+
+// Reset time usage (admin function)
+// Body (optional): {"date": "YYYY-MM-DD", "reason": "...", "actor": "..."}; date defaults to today
+func (s *CoreService) handleResetTimeUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		Date   string `json:"date"`
+		Reason string `json:"reason"`
+		Actor  string `json:"actor"`
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil || (len(body) > 0 && json.Unmarshal(body, &request) != nil) {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	// Resetting usage gives time back, the parent must confirm when linked
+	if !s.authorizeParentBody(w, body) {
+		return
+	}
+
+	if request.Date == "" {
+		request.Date = time.Now().Format(usageDateLayout)
+	}
+	if request.Reason == "" {
+		request.Reason = "Manual reset"
+	}
+
+	previous, err := s.timeManager.ResetUsage(request.Date)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	s.recordTimeAudit("reset", request.Date, -previous, request.Reason, request.Actor)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":          true,
+		"message":          fmt.Sprintf("Time usage for %s reset", request.Date),
+		"date":             request.Date,
+		"previous_minutes": previous,
+	})
+}
+
+// Adjust time usage by adding or subtracting minutes
+// Body: {"date": "YYYY-MM-DD", "minutes": -15, "reason": "...", "actor": "..."}; reason is required
+func (s *CoreService) handleAdjustTimeUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		Date    string `json:"date"`
+		Minutes int64  `json:"minutes"`
+		Reason  string `json:"reason"`
+		Actor   string `json:"actor"`
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil || json.Unmarshal(body, &request) != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	// Subtracting minutes gives time back, the parent must confirm when linked
+	if request.Minutes < 0 && !s.authorizeParentBody(w, body) {
+		return
+	}
+
+	if strings.TrimSpace(request.Reason) == "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "A reason is required for usage adjustments",
+		})
+		return
+	}
+	if request.Minutes < -1440 || request.Minutes > 1440 {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Adjustment must be between -1440 and 1440 minutes",
+		})
+		return
+	}
+	if request.Date == "" {
+		request.Date = time.Now().Format(usageDateLayout)
+	}
+
+	total, applied, err := s.timeManager.AdjustUsage(request.Date, request.Minutes)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	s.recordTimeAudit("adjust", request.Date, applied, request.Reason, request.Actor)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"message":       fmt.Sprintf("Time usage for %s adjusted by %+d minutes", request.Date, applied),
+		"date":          request.Date,
+		"total_minutes": total,
+	})
+}
+
+// Get the time usage audit trail
+func (s *CoreService) handleGetTimeAudit(w http.ResponseWriter, r *http.Request) {
+	limit := r.URL.Query().Get("limit")
+	if limit == "" {
+		limit = "100"
+	}
+
+	rows, err := s.db.Query("SELECT id, action, usage_date, minutes, reason, actor, created_at FROM time_audit_log ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []TimeAuditEntry{}
+	for rows.Next() {
+		var entry TimeAuditEntry
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.UsageDate, &entry.Minutes, &entry.Reason, &entry.Actor, &entry.CreatedAt); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"entries": entries,
+	})
+}
+
+// recordTimeAudit stores a time-management action in the audit trail
+func (s *CoreService) recordTimeAudit(action, date string, minutes int64, reason, actor string) {
+	if actor == "" {
+		actor = "pc-admin"
+	}
+
+	_, err := s.db.Exec("INSERT INTO time_audit_log (action, usage_date, minutes, reason, actor) VALUES (?, ?, ?, ?, ?)",
+		action, date, minutes, reason, actor)
+	if err != nil {
+		log.Printf("Warning: Failed to record time audit entry: %v", err)
+	}
+}
+
+// Get bonus time grants (optional ?date=YYYY-MM-DD filter)
+func (s *CoreService) handleGetTimeGrants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	date := r.URL.Query().Get("date")
+	grants := s.timeManager.GetGrants(date)
+
+	total := 0
+	for _, grant := range grants {
+		total += grant.Minutes
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"grants":        grants,
+		"total_minutes": total,
+	})
+}
+
+// Grant bonus minutes for a day
+// Body: {"minutes": 30, "date": "YYYY-MM-DD", "reason": "...", "grantedBy": "..."}; date defaults to today
+func (s *CoreService) handleAddTimeGrant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request TimeGrant
+	body, err := io.ReadAll(r.Body)
+	if err != nil || json.Unmarshal(body, &request) != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	// Bonus time lifts the daily limit, the parent must confirm when linked
+	if !s.authorizeParentBody(w, body) {
+		return
+	}
+
+	// ID and source are assigned by the service
+	request.ID = ""
+	request.Source = ""
+	if request.GrantedBy == "" {
+		request.GrantedBy = "pc-admin"
+	}
+
+	grant, err := s.timeManager.AddGrant(request)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	s.recordTimeAudit("grant", grant.Date, int64(grant.Minutes), grant.Reason, grant.GrantedBy)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Granted %d bonus minutes for %s", grant.Minutes, grant.Date),
+		"grant":   grant,
+	})
+}
+
+// Revoke a bonus time grant
+func (s *CoreService) handleDeleteTimeGrant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	if !s.timeManager.RemoveGrant(id) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Grant not found",
+		})
+		return
+	}
+
+	s.recordTimeAudit("revoke_grant", "", 0, id, "pc-admin")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Grant revoked",
+	})
+}
+
+// Get date-specific rule overrides (holidays, exam weeks)
+func (s *CoreService) handleGetTimeOverrides(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"overrides": s.timeManager.GetOverrides(),
+	})
+}
+
+// Add an override for a single date or a date range
+func (s *CoreService) handleAddTimeOverride(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		Name      string  `json:"name"`
+		Date      string  `json:"date"`
+		StartDate string  `json:"startDate"`
+		EndDate   string  `json:"endDate"`
+		Rule      DayRule `json:"rule"`
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil || json.Unmarshal(body, &request) != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	// An override can disable or raise today's limits, the parent must confirm when linked
+	if !s.authorizeParentBody(w, body) {
+		return
+	}
+
+	if request.Date != "" {
+		request.StartDate = request.Date
+		request.EndDate = request.Date
+	}
+	if strings.TrimSpace(request.Name) == "" {
+		request.Name = request.StartDate
+	}
+
+	if err := s.validateDayRule(&request.Rule); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Invalid rule: %v", err),
+		})
+		return
+	}
+
+	override, err := s.timeManager.AddOverride(TimeRuleOverride{
+		Name:      request.Name,
+		StartDate: request.StartDate,
+		EndDate:   request.EndDate,
+		Rule:      request.Rule,
+	})
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	s.recordTimeAudit("add_override", override.StartDate, 0,
+		fmt.Sprintf("%s (%s → %s)", override.Name, override.StartDate, override.EndDate), "pc-admin")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"message":  "Override added",
+		"override": override,
+	})
+}
+
+// Import school holidays from a local iCalendar (.ics) file
+func (s *CoreService) handleImportTimeOverrides(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		Path    string  `json:"path"`
+		Rule    DayRule `json:"rule"`
+		Replace bool    `json:"replace"`
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil || json.Unmarshal(body, &request) != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	// Imported holidays replace the usual limits, the parent must confirm when linked
+	if !s.authorizeParentBody(w, body) {
+		return
+	}
+
+	if strings.TrimSpace(request.Path) == "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Path to the .ics file is required",
+		})
+		return
+	}
+
+	if err := s.validateDayRule(&request.Rule); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Invalid rule: %v", err),
+		})
+		return
+	}
+
+	result, err := s.timeManager.ImportICS(request.Path, request.Rule, request.Replace)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	s.recordTimeAudit("import_overrides", "", 0,
+		fmt.Sprintf("%d events imported from %s", result.Imported, request.Path), "pc-admin")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Imported %d overrides", result.Imported),
+		"result":  result,
+	})
+}
+
+// Delete an override
+func (s *CoreService) handleDeleteTimeOverride(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid override ID", http.StatusBadRequest)
+		return
+	}
+
+	// Removing an override restores other limits, possibly looser ones
+	var request parentAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeParent(w, request) {
+		return
+	}
+
+	removed, err := s.timeManager.RemoveOverride(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !removed {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Override not found",
+		})
+		return
+	}
+
+	s.recordTimeAudit("remove_override", "", 0, strconv.FormatInt(id, 10), "pc-admin")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Override removed",
+	})
+}
+
+// Get per-site budgets with today's (or ?date=) usage
+func (s *CoreService) handleGetSiteBudgets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().Format(usageDateLayout)
+	}
+	if _, err := time.Parse(usageDateLayout, date); err != nil {
+		http.Error(w, "Invalid date (use YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+
+	statuses, err := s.siteBudgets.GetBudgetStatuses(date)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"date":    date,
+		"budgets": statuses,
+	})
+}
+
+// Add a daily time budget for a site or a category of sites
+func (s *CoreService) handleAddSiteBudget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var budget SiteBudget
+	budget.Enabled = true
+	if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	created, err := s.siteBudgets.AddBudget(budget)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	s.recordTimeAudit("add_site_budget", "", int64(created.DailyLimitMinutes),
+		fmt.Sprintf("%s (%s)", created.Name, strings.Join(created.Domains, ", ")), "pc-admin")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Budget added",
+		"budget":  created,
+	})
+}
+
+// Update a site budget
+func (s *CoreService) handleUpdateSiteBudget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid budget ID", http.StatusBadRequest)
+		return
+	}
+
+	var budget SiteBudget
+	body, err := io.ReadAll(r.Body)
+	if err != nil || json.Unmarshal(body, &budget) != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	budget.ID = id
+
+	// Tightening a budget is always allowed; loosening one may unblock its
+	// domains, so the parent must confirm when linked
+	if current := s.siteBudgets.GetBudget(id); current != nil && current.loosenedBy(budget) &&
+		!s.authorizeParentBody(w, body) {
+		return
+	}
+
+	updated, err := s.siteBudgets.UpdateBudget(budget)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if updated == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Budget not found",
+		})
+		return
+	}
+
+	s.recordTimeAudit("update_site_budget", "", int64(updated.DailyLimitMinutes),
+		fmt.Sprintf("%s (%s)", updated.Name, strings.Join(updated.Domains, ", ")), "pc-admin")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Budget updated",
+		"budget":  updated,
+	})
+}
+
+// Delete a site budget (its domains are unblocked if the budget was spent)
+func (s *CoreService) handleDeleteSiteBudget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid budget ID", http.StatusBadRequest)
+		return
+	}
+
+	// Removing a budget unblocks its domains, the parent must confirm when linked
+	var request parentAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeParent(w, request) {
+		return
+	}
+
+	removed, err := s.siteBudgets.RemoveBudget(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !removed {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Budget not found",
+		})
+		return
+	}
+
+	s.recordTimeAudit("remove_site_budget", "", 0, strconv.FormatInt(id, 10), "pc-admin")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Budget removed",
+	})
+}
+
+// Get minutes spent per budgeted site on a date
+func (s *CoreService) handleGetSiteActivity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().Format(usageDateLayout)
+	}
+	if _, err := time.Parse(usageDateLayout, date); err != nil {
+		http.Error(w, "Invalid date (use YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+
+	activity, err := s.siteBudgets.GetSiteActivity(date)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"date":     date,
+		"activity": activity,
+	})
+}
+
+// Receive page visit reports from the browser extension
+func (s *CoreService) handleReportVisits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		Visits []struct {
+			URL     string `json:"url"`
+			Domain  string `json:"domain"`
+			Start   int64  `json:"start"` // Unix milliseconds
+			Seconds int    `json:"seconds"`
+		} `json:"visits"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	recorded := 0
+	for _, visit := range request.Visits {
+		host := visit.Domain
+		if host == "" {
+			parsed, err := url.Parse(visit.URL)
+			if err != nil {
+				continue
+			}
+			host = parsed.Hostname()
+		}
+		if host == "" || visit.Seconds <= 0 {
+			continue
+		}
+
+		end := now
+		start := end.Add(-time.Duration(visit.Seconds) * time.Second)
+		if visit.Start > 0 {
+			start = time.UnixMilli(visit.Start)
+			end = start.Add(time.Duration(visit.Seconds) * time.Second)
+		}
+		// Reports from the future (skewed browser clock) are clamped to now
+		if end.After(now) {
+			start = start.Add(now.Sub(end))
+			end = now
+		}
+
+		ok, err := s.siteBudgets.RecordActivity(host, start, end, "extension")
+		if err != nil {
+			log.Printf("⚠️ Failed to record visit to %s: %v", host, err)
+			continue
+		}
+		if ok {
+			recorded++
+		}
+	}
+
+	if recorded > 0 {
+		go s.siteBudgets.evaluate()
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"recorded": recorded,
+	})
+}
+
+// Manual override of the time rules with an expiry: block now for N minutes,
+// allow until HH:MM, pause all time rules for the rest of today, or clear
+func (s *CoreService) handleToggleTimeBlocking(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		Action  string `json:"action"`  // "block", "allow", "pause" or "clear" ("unblock" = "pause")
+		Minutes int    `json:"minutes"` // For "block"
+		Until   string `json:"until"`   // HH:MM, for "allow"
+		Reason  string `json:"reason"`
+		Actor   string `json:"actor"`
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil || json.Unmarshal(body, &request) != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if request.Action == "unblock" {
+		request.Action = ManualPause
+	}
+
+	// Only blocking raises protection; allow, pause and clear (which may end a
+	// manual block) need the parent when one is linked, and so does a block
+	// that would end an active one early (checked below)
+	if request.Action != ManualBlock && !s.authorizeParentBody(w, body) {
+		return
+	}
+
+	if request.Action == "clear" {
+		cleared, err := s.timeManager.ClearManualOverride()
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		if cleared {
+			s.recordTimeAudit("manual_clear", time.Now().Format(usageDateLayout), 0, request.Reason, request.Actor)
+			s.broadcastManualOverride(nil)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Time rules apply again",
+			"action":  request.Action,
+			"cleared": cleared,
+		})
+		return
+	}
+
+	now := time.Now()
+	override, err := newManualOverride(request.Action, request.Minutes, request.Until, now)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("%v. Use 'block' (minutes), 'allow' (until HH:MM), 'pause' or 'clear'", err),
+		})
+		return
+	}
+	if override.Mode == ManualBlock {
+		active := s.timeManager.GetManualOverride()
+		if active != nil && active.Mode == ManualBlock && override.ExpiresAt.Before(active.ExpiresAt) &&
+			!s.authorizeParentBody(w, body) {
+			return
+		}
+	}
+	override.Reason = request.Reason
+	override.Actor = request.Actor
+	if override.Actor == "" {
+		override.Actor = "pc-admin"
+	}
+
+	if err := s.timeManager.SetManualOverride(*override); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	s.recordTimeAudit("manual_"+override.Mode, now.Format(usageDateLayout),
+		int64(override.ExpiresAt.Sub(now).Minutes()), request.Reason, override.Actor)
+	s.broadcastManualOverride(override)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"message":  override.describe(),
+		"action":   request.Action,
+		"override": override,
+	})
+}
+
+// Notify SSE clients that a manual override was set or cleared
+func (s *CoreService) broadcastManualOverride(override *ManualOverride) {
+	message, _ := json.Marshal(map[string]interface{}{
+		"type":     "manual_override_changed",
+		"override": override,
+	})
+
+	s.broadcastSSE(string(message))
+}
+
+// Validate time rules
+func (s *CoreService) validateTimeRules(rules *TimeRules) error {
+	// Validate weekdays rules
+	if err := s.validateDayRule(&rules.Weekdays); err != nil {
 		return fmt.Errorf("weekdays rules invalid: %v", err)
 	}
 
@@ -2128,6 +3653,83 @@ func (s *CoreService) validateTimeRules(rules *TimeRules) error {
 		return fmt.Errorf("weekends rules invalid: %v", err)
 	}
 
+	// Validate idle threshold
+	if rules.IdleThresholdMinutes < 0 || rules.IdleThresholdMinutes > 120 {
+		return fmt.Errorf("idle threshold must be between 0 and 120 minutes")
+	}
+
+	// Validate warning lead times
+	if len(rules.WarningMinutes) > 10 {
+		return fmt.Errorf("at most 10 warning lead times are allowed")
+	}
+	for _, minutes := range rules.WarningMinutes {
+		if minutes < 1 || minutes > 120 {
+			return fmt.Errorf("warning lead times must be between 1 and 120 minutes")
+		}
+	}
+
+	// Validate clock tampering policy
+	switch rules.ClockTamperPolicy {
+	case "", ClockPolicyIgnore, ClockPolicyBlock, ClockPolicyAlert:
+	default:
+		return fmt.Errorf("clock tamper policy must be 'ignore', 'block' or 'alert'")
+	}
+
+	// Validate destinations allowed during a block
+	profiles := make(map[int]bool)
+	for i := range rules.AllowedDuringBlock {
+		list := &rules.AllowedDuringBlock[i]
+		if profiles[list.ProfileID] {
+			return fmt.Errorf("allowed destinations listed twice for profile %d", list.ProfileID)
+		}
+		profiles[list.ProfileID] = true
+
+		if err := s.validateBlockAllowList(list); err != nil {
+			return fmt.Errorf("allowed destinations for profile %d invalid: %v", list.ProfileID, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate and normalize the destinations of one profile that stay reachable during a block
+func (s *CoreService) validateBlockAllowList(list *BlockAllowList) error {
+	if list.ProfileID < 0 {
+		return fmt.Errorf("profile ID must not be negative")
+	}
+	if list.ProfileID != 0 {
+		if _, ok := s.profiles.Load(list.ProfileID); !ok {
+			return fmt.Errorf("unknown profile")
+		}
+	}
+
+	if len(list.Domains) > 50 || len(list.CIDRs) > 50 {
+		return fmt.Errorf("at most 50 domains and 50 CIDRs are allowed")
+	}
+
+	domains := make([]string, 0, len(list.Domains))
+	for _, raw := range list.Domains {
+		domain := normalizeDomain(raw)
+		if domain == "" || !strings.Contains(domain, ".") {
+			return fmt.Errorf("invalid domain '%s'", raw)
+		}
+		domains = append(domains, domain)
+	}
+	list.Domains = domains
+
+	cidrs := make([]string, 0, len(list.CIDRs))
+	for _, raw := range list.CIDRs {
+		prefix, err := parseAllowedCIDR(raw)
+		if err != nil {
+			return err
+		}
+		if prefix.Bits() < 8 || (prefix.Addr().Is6() && prefix.Bits() < 16) {
+			return fmt.Errorf("CIDR '%s' is too broad", raw)
+		}
+		cidrs = append(cidrs, prefix.String())
+	}
+	list.CIDRs = cidrs
+
 	return nil
 }
 
@@ -2148,15 +3750,38 @@ func (s *CoreService) validateDayRule(rule *DayRule) error {
 	}
 
 	// Validate time slots
-	for i, slot := range rule.AllowedSlots {
+	if err := s.validateTimeSlots("slot", rule.AllowedSlots); err != nil {
+		return err
+	}
+	if err := s.validateTimeSlots("blocked slot", rule.BlockedSlots); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Validate a list of time slots. Slots may wrap past midnight (e.g. 21:30-06:30)
+// but must not be zero-length or overlap each other.
+func (s *CoreService) validateTimeSlots(label string, slots []TimeSlot) error {
+	for i, slot := range slots {
 		if !s.isValidTimeFormat(slot.StartTime) {
-			return fmt.Errorf("slot %d: invalid start time format '%s' (use HH:MM)", i+1, slot.StartTime)
+			return fmt.Errorf("%s %d: invalid start time format '%s' (use HH:MM)", label, i+1, slot.StartTime)
 		}
 		if !s.isValidTimeFormat(slot.EndTime) {
-			return fmt.Errorf("slot %d: invalid end time format '%s' (use HH:MM)", i+1, slot.EndTime)
+			return fmt.Errorf("%s %d: invalid end time format '%s' (use HH:MM)", label, i+1, slot.EndTime)
 		}
-		if slot.StartTime >= slot.EndTime {
-			return fmt.Errorf("slot %d: start time must be before end time", i+1)
+		start, _ := parseClock(slot.StartTime)
+		end, _ := parseClock(slot.EndTime)
+		if start == end {
+			return fmt.Errorf("%s %d: start and end time must differ", label, i+1)
+		}
+	}
+
+	for i := 0; i < len(slots); i++ {
+		for j := i + 1; j < len(slots); j++ {
+			if slotsOverlap(slots[i], slots[j]) {
+				return fmt.Errorf("%s %d overlaps %s %d", label, i+1, label, j+1)
+			}
 		}
 	}
 
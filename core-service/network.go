@@ -0,0 +1,294 @@
+// core-service/network.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"sync"
+)
+
+// Khi cắt mạng, mọi kết nối TCP và UDP ra ngoài đều bị chặn ở mọi port (cả proxy,
+// VPN và QUIC), trừ đích được phép, loopback và các port để mạng vẫn hoạt động:
+// DNS và DHCP/DHCPv6. ICMP không bị chặn (IPv6 cần nó để tìm router và hàng xóm).
+// Quy tắc áp dụng cho cả IPv4 và IPv6.
+var (
+	openTCPPorts = []int{53}
+	openUDPPorts = []int{53, 67, 547}
+
+	loopbackPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("127.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}
+)
+
+// NetworkEnforcer cắt và mở lại kết nối ra ngoài ở tầng firewall của hệ điều hành
+type NetworkEnforcer interface {
+	Name() string
+	// Block chặn kết nối ra ngoài, trừ các địa chỉ thuộc allowed (cùng loopback, DNS, DHCP)
+	Block(allowed []netip.Prefix) error
+	Unblock() error
+	// IsBlocked đọc trạng thái thật của firewall (rule còn đủ hay không)
+	IsBlocked() (bool, error)
+}
+
+// FakeNetworkEnforcer giữ trạng thái chặn trong bộ nhớ, dùng cho kiểm thử
+type FakeNetworkEnforcer struct {
+	mutex   sync.Mutex
+	blocked bool
+	allowed []netip.Prefix
+	err     error
+}
+
+func NewFakeNetworkEnforcer() *FakeNetworkEnforcer {
+	return &FakeNetworkEnforcer{}
+}
+
+func (f *FakeNetworkEnforcer) Name() string {
+	return "fake"
+}
+
+func (f *FakeNetworkEnforcer) Block(allowed []netip.Prefix) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.blocked = true
+	f.allowed = append([]netip.Prefix(nil), allowed...)
+	return nil
+}
+
+func (f *FakeNetworkEnforcer) Unblock() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.blocked = false
+	f.allowed = nil
+	return nil
+}
+
+func (f *FakeNetworkEnforcer) IsBlocked() (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.blocked, nil
+}
+
+// Allowed trả về các địa chỉ được miễn chặn trong lần Block gần nhất
+func (f *FakeNetworkEnforcer) Allowed() []netip.Prefix {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]netip.Prefix(nil), f.allowed...)
+}
+
+// SetBlocked giả lập rule bị thêm/xóa từ bên ngoài
+func (f *FakeNetworkEnforcer) SetBlocked(blocked bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.blocked = blocked
+}
+
+// SetError làm mọi thao tác sau đó trả về err (nil = hoạt động bình thường)
+func (f *FakeNetworkEnforcer) SetError(err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.err = err
+}
+
+// Thay backend chặn mạng (nil = chỉ ghi nhận trạng thái trong bộ nhớ)
+func (tm *TimeManager) SetNetworkEnforcer(enforcer NetworkEnforcer) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.networkEnforcer = enforcer
+}
+
+// Chế độ chặn bền vững: khi dừng service, rule chặn mạng được giữ nguyên
+func (tm *TimeManager) SetPersistentEnforcement(persistent bool) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.persistentEnforcement = persistent
+}
+
+// Bật/tắt việc chặn mạng theo quy tắc thời gian (phụ huynh tắt bảo vệ)
+func (tm *TimeManager) SetProtectionEnabled(enabled bool) {
+	tm.mutex.Lock()
+	tm.protectionDisabled = !enabled
+	tm.mutex.Unlock()
+
+	go tm.checkTimeRules()
+}
+
+func (tm *TimeManager) isProtectionDisabled() bool {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return tm.protectionDisabled
+}
+
+// Tên backend chặn mạng ("none" nếu nền tảng không hỗ trợ)
+func networkBackendName(enforcer NetworkEnforcer) string {
+	if enforcer == nil {
+		return "none"
+	}
+	return enforcer.Name()
+}
+
+// Chặn kết nối ra ngoài (TCP, UDP), trừ đích được phép
+func (tm *TimeManager) blockNetwork() error {
+	log.Println("🚫 Chặn truy cập internet...")
+
+	tm.mutex.RLock()
+	enforcer := tm.networkEnforcer
+	allowed := append([]netip.Prefix(nil), tm.allowedPrefixes...)
+	tm.mutex.RUnlock()
+
+	if enforcer == nil {
+		log.Println("⚠️ Không có backend chặn mạng trên nền tảng này, chỉ ghi nhận trạng thái")
+	} else if err := enforcer.Block(allowed); err != nil {
+		log.Printf("❌ Lỗi khi chặn mạng (%s): %v", enforcer.Name(), err)
+		return fmt.Errorf("%s: %v", enforcer.Name(), err)
+	}
+
+	tm.mutex.Lock()
+	tm.isBlocked = true
+	tm.mutex.Unlock()
+
+	if len(allowed) > 0 {
+		log.Printf("✅ Đã chặn truy cập internet (TCP/UDP), trừ %d địa chỉ được phép", len(allowed))
+	} else {
+		log.Println("✅ Đã chặn truy cập internet (TCP/UDP)")
+	}
+	return nil
+}
+
+// Mở lại truy cập web
+func (tm *TimeManager) unblockNetwork() error {
+	log.Println("🔓 Mở lại truy cập internet...")
+
+	tm.mutex.RLock()
+	enforcer := tm.networkEnforcer
+	tm.mutex.RUnlock()
+
+	if enforcer != nil {
+		if err := enforcer.Unblock(); err != nil {
+			log.Printf("❌ Lỗi khi mở lại mạng (%s): %v", enforcer.Name(), err)
+			return fmt.Errorf("%s: %v", enforcer.Name(), err)
+		}
+	}
+
+	tm.mutex.Lock()
+	tm.isBlocked = false
+	tm.mutex.Unlock()
+
+	log.Println("✅ Đã mở lại truy cập internet")
+	return nil
+}
+
+// Kiểm tra xem mạng có đang bị chặn không. Trạng thái được đọc từ firewall nên
+// rule bị xóa/thêm từ bên ngoài cũng được phát hiện; nếu không đọc được thì
+// dùng trạng thái đã biết.
+func (tm *TimeManager) isNetworkBlocked() bool {
+	tm.mutex.RLock()
+	enforcer := tm.networkEnforcer
+	cached := tm.isBlocked
+	tm.mutex.RUnlock()
+
+	if enforcer == nil {
+		return cached
+	}
+
+	blocked, err := enforcer.IsBlocked()
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if err != nil {
+		if !tm.networkErrorLogged {
+			log.Printf("⚠️ Không thể đọc trạng thái firewall (%s): %v", enforcer.Name(), err)
+			tm.networkErrorLogged = true
+		}
+		return tm.isBlocked
+	}
+	tm.networkErrorLogged = false
+
+	if blocked != tm.isBlocked {
+		log.Printf("⚠️ Trạng thái firewall thực tế (chặn=%v) khác trạng thái đã biết (chặn=%v)", blocked, tm.isBlocked)
+		tm.isBlocked = blocked
+	}
+	return blocked
+}
+
+// Địa chỉ cuối cùng của prefix (vd 10.0.0.0/8 → 10.255.255.255)
+func prefixLastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Masked().Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
+
+// Các khoảng port ("đầu-cuối") không thuộc open, vd [53] → 1-52, 54-65535. Dùng
+// cho firewall không có rule "trừ" port.
+func excludedPortRanges(open []int) []string {
+	ports := append([]int(nil), open...)
+	sort.Ints(ports)
+
+	var ranges []string
+	next := 1
+	for _, port := range ports {
+		if port < next {
+			continue
+		}
+		if port > next {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", next, port-1))
+		}
+		next = port + 1
+	}
+	if next <= 65535 {
+		ranges = append(ranges, fmt.Sprintf("%d-65535", next))
+	}
+	return ranges
+}
+
+// Các khoảng địa chỉ ("đầu-cuối") của một họ địa chỉ không thuộc allowed. Dùng cho
+// firewall không có rule "trừ", vd Windows Firewall (rule chặn luôn thắng rule cho phép).
+func excludedAddrRanges(allowed []netip.Prefix, ipv6 bool) []string {
+	first := netip.IPv4Unspecified()
+	last := netip.AddrFrom4([4]byte{255, 255, 255, 255})
+	if ipv6 {
+		first = netip.IPv6Unspecified()
+		last = netip.AddrFrom16([16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	}
+
+	type span struct{ from, to netip.Addr }
+	var spans []span
+	for _, prefix := range allowed {
+		if prefix.Addr().Is6() != ipv6 {
+			continue
+		}
+		spans = append(spans, span{prefix.Masked().Addr(), prefixLastAddr(prefix)})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].from.Less(spans[j].from) })
+
+	var ranges []string
+	next := first
+	for _, s := range spans {
+		if next.Less(s.from) {
+			ranges = append(ranges, next.String()+"-"+s.from.Prev().String())
+		}
+		if !s.to.Less(next) {
+			next = s.to.Next()
+			if !next.IsValid() {
+				return ranges // Đã tới địa chỉ cuối cùng
+			}
+		}
+	}
+	return append(ranges, next.String()+"-"+last.String())
+}
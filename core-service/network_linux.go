@@ -0,0 +1,100 @@
+//go:build linux
+
+// core-service/network_linux.go
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Bảng nftables riêng của KidSafe; họ "inet" áp dụng cho cả IPv4 và IPv6
+const nftTimeBlockTable = "kidsafe_time"
+
+// nftablesEnforcer chặn kết nối TCP/UDP ra ngoài bằng một bảng nftables riêng,
+// nên thêm/xóa không ảnh hưởng tới rule khác của hệ thống
+type nftablesEnforcer struct{}
+
+func newPlatformNetworkEnforcer() NetworkEnforcer {
+	return &nftablesEnforcer{}
+}
+
+func (e *nftablesEnforcer) Name() string {
+	return "nftables"
+}
+
+func (e *nftablesEnforcer) Block(allowed []netip.Prefix) error {
+	// Loopback, DNS, DHCP và địa chỉ được phép được chấp nhận trước các rule chặn
+	var allowRules strings.Builder
+	var ipv4, ipv6 []string
+	for _, prefix := range allowed {
+		if prefix.Addr().Is4() {
+			ipv4 = append(ipv4, prefix.String())
+		} else {
+			ipv6 = append(ipv6, prefix.String())
+		}
+	}
+	if len(ipv4) > 0 {
+		fmt.Fprintf(&allowRules, "\t\tip daddr { %s } accept\n", strings.Join(ipv4, ", "))
+	}
+	if len(ipv6) > 0 {
+		fmt.Fprintf(&allowRules, "\t\tip6 daddr { %s } accept\n", strings.Join(ipv6, ", "))
+	}
+
+	// "add table" rồi "delete table" để xóa bảng cũ (nếu có) trong cùng một transaction
+	script := fmt.Sprintf(`add table inet %[1]s
+delete table inet %[1]s
+table inet %[1]s {
+	chain output {
+		type filter hook output priority 0; policy accept;
+		oifname "lo" accept
+		meta l4proto tcp th dport { %[2]s } accept
+		meta l4proto udp th dport { %[3]s } accept
+%[4]s		meta l4proto tcp reject with tcp reset
+		meta l4proto udp reject
+	}
+}
+`, nftTimeBlockTable, joinNftPorts(openTCPPorts), joinNftPorts(openUDPPorts), allowRules.String())
+
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (e *nftablesEnforcer) Unblock() error {
+	blocked, err := e.IsBlocked()
+	if err != nil || !blocked {
+		return err
+	}
+
+	if output, err := exec.Command("nft", "delete", "table", "inet", nftTimeBlockTable).CombinedOutput(); err != nil {
+		return fmt.Errorf("nft: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// nft báo "No such file or directory" khi bảng không tồn tại
+func (e *nftablesEnforcer) IsBlocked() (bool, error) {
+	output, err := exec.Command("nft", "list", "chain", "inet", nftTimeBlockTable, "output").CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "No such file or directory") {
+			return false, nil
+		}
+		return false, fmt.Errorf("nft: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return strings.Contains(string(output), "reject"), nil
+}
+
+func joinNftPorts(ports []int) string {
+	values := make([]string, len(ports))
+	for i, port := range ports {
+		values[i] = strconv.Itoa(port)
+	}
+	return strings.Join(values, ", ")
+}
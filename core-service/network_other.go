@@ -0,0 +1,9 @@
+//go:build !windows && !linux
+
+// core-service/network_other.go
+package main
+
+// Nền tảng khác chưa hỗ trợ chặn mạng, trạng thái chỉ được ghi nhận trong bộ nhớ
+func newPlatformNetworkEnforcer() NetworkEnforcer {
+	return nil
+}
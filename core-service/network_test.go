@@ -0,0 +1,135 @@
+// core-service/network_test.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TimeManager dùng FakeNetworkEnforcer, DNS giả và giới hạn 1 phút/ngày đã dùng hết
+func newBlockingTimeManager(t *testing.T) (*TimeManager, *FakeNetworkEnforcer, map[string]string) {
+	t.Helper()
+
+	core, _, _ := newTestServices(t)
+	tm := core.timeManager
+	enforcer := tm.networkEnforcer.(*FakeNetworkEnforcer)
+
+	// Mỗi host được phân giải thành một IP riêng trong dải TEST-NET-3
+	addrs := make(map[string]string)
+	for i, host := range append(append([]string{}, tm.serviceHosts...), "school.edu") {
+		addrs[host] = fmt.Sprintf("203.0.113.%d", i+1)
+	}
+	tm.lookupIP = func(host string) ([]net.IP, error) {
+		if addr, ok := addrs[host]; ok {
+			return []net.IP{net.ParseIP(addr)}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	rule := DayRule{Enabled: true, DailyLimitMinutes: 1, AllowedSlots: []TimeSlot{{StartTime: "00:00", EndTime: "23:59"}}}
+	tm.UpdateRules(TimeRules{
+		Weekdays:           rule,
+		Weekends:           rule,
+		AllowedDuringBlock: []BlockAllowList{{Domains: []string{"school.edu"}}},
+	})
+	if _, _, err := tm.AdjustUsage(time.Now().Format(usageDateLayout), 5); err != nil {
+		t.Fatal(err)
+	}
+	return tm, enforcer, addrs
+}
+
+func TestBlockKeepsServiceHostsReachable(t *testing.T) {
+	tm, enforcer, addrs := newBlockingTimeManager(t)
+
+	tm.refreshAllowedDestinations()
+	tm.checkTimeRules()
+	if blocked, _ := enforcer.IsBlocked(); !blocked {
+		t.Fatal("network not blocked after the daily limit")
+	}
+
+	allowed := make(map[netip.Prefix]bool)
+	for _, prefix := range enforcer.Allowed() {
+		allowed[prefix] = true
+	}
+	for host, addr := range addrs {
+		if !allowed[netip.MustParsePrefix(addr+"/32")] {
+			t.Errorf("%s (%s) not reachable during the block, allowed: %v", host, addr, enforcer.Allowed())
+		}
+	}
+}
+
+func TestFirewallRuleRemovedOutsideIsRestored(t *testing.T) {
+	tm, enforcer, _ := newBlockingTimeManager(t)
+
+	tm.checkTimeRules()
+	enforcer.SetBlocked(false) // Rule bị xóa bằng tay khỏi firewall
+	if tm.isNetworkBlocked() {
+		t.Fatal("removed firewall rule not detected")
+	}
+
+	tm.checkTimeRules()
+	if blocked, _ := enforcer.IsBlocked(); !blocked {
+		t.Fatal("block not restored after the firewall rule was removed")
+	}
+}
+
+func TestBlockRetriedAfterFirewallError(t *testing.T) {
+	tm, enforcer, _ := newBlockingTimeManager(t)
+
+	enforcer.SetError(errors.New("access denied"))
+	if err := tm.blockNetwork(); err == nil {
+		t.Fatal("blockNetwork succeeded while the firewall fails")
+	}
+	tm.checkTimeRules()
+	if tm.isNetworkBlocked() {
+		t.Fatal("network reported blocked although the firewall failed")
+	}
+
+	enforcer.SetError(nil)
+	tm.checkTimeRules()
+	if blocked, _ := enforcer.IsBlocked(); !blocked {
+		t.Fatal("block not applied once the firewall works again")
+	}
+}
+
+func TestExcludedAddrRanges(t *testing.T) {
+	allowed := []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	}
+
+	got := excludedAddrRanges(allowed, false)
+	want := []string{"0.0.0.0-9.255.255.255", "11.0.0.0-192.0.2.0", "192.0.2.2-255.255.255.255"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("IPv4 ranges %v, want %v", got, want)
+	}
+
+	got = excludedAddrRanges(nil, false)
+	if want := []string{"0.0.0.0-255.255.255.255"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ranges without allowed addresses %v, want %v", got, want)
+	}
+
+	got = excludedAddrRanges(allowed, true)
+	want = []string{"::-2001:db8::", "2001:db8::2-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("IPv6 ranges %v, want %v", got, want)
+	}
+}
+
+func TestExcludedPortRanges(t *testing.T) {
+	got := excludedPortRanges([]int{547, 53, 67})
+	want := []string{"1-52", "54-66", "68-546", "548-65535"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("port ranges %v, want %v", got, want)
+	}
+
+	if got := excludedPortRanges(nil); !reflect.DeepEqual(got, []string{"1-65535"}) {
+		t.Fatalf("port ranges without open ports %v, want 1-65535", got)
+	}
+}
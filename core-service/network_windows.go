@@ -0,0 +1,151 @@
+//go:build windows
+
+// core-service/network_windows.go
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"strings"
+)
+
+// Firewall rule name constant
+const FIREWALL_RULE_NAME = "KidSafe Time Block"
+
+// Tên rule của các phiên bản cũ (chặn nhầm localport), chỉ còn dùng để dọn dẹp
+var legacyFirewallRuleNames = []string{FIREWALL_RULE_NAME + " HTTP", FIREWALL_RULE_NAME + " HTTPS"}
+
+// windowsFirewallEnforcer chặn kết nối TCP/UDP ra ngoài bằng Windows Defender
+// Firewall. remoteip gồm cả dải IPv4 và IPv6.
+type windowsFirewallEnforcer struct{}
+
+func newPlatformNetworkEnforcer() NetworkEnforcer {
+	return &windowsFirewallEnforcer{}
+}
+
+func (e *windowsFirewallEnforcer) Name() string {
+	return "windows-firewall"
+}
+
+// Rule chặn có hai bộ tên dùng luân phiên: bộ mới được thêm xong rồi mới xóa bộ
+// cũ, nên khi cập nhật danh sách được phép mạng không bị mở ra giữa chừng
+func (e *windowsFirewallEnforcer) ruleNames(set int) []string {
+	suffix := ""
+	if set == 1 {
+		suffix = " (2)"
+	}
+	return []string{FIREWALL_RULE_NAME + " TCP" + suffix, FIREWALL_RULE_NAME + " UDP" + suffix}
+}
+
+func (e *windowsFirewallEnforcer) Block(allowed []netip.Prefix) error {
+	current, err := e.activeRuleSet()
+	if err != nil {
+		return err
+	}
+	next := 0
+	if current == 0 {
+		next = 1
+	}
+	names := e.ruleNames(next)
+
+	// Dọn phần còn sót của một lần cập nhật bị gián đoạn để không bị trùng
+	if err := deleteFirewallRules(names); err != nil {
+		return err
+	}
+
+	// Rule chặn luôn thắng rule cho phép, nên địa chỉ và port được phép được loại
+	// khỏi remoteip/remoteport của rule chặn thay vì thêm rule cho phép riêng
+	allowed = append(append([]netip.Prefix(nil), allowed...), loopbackPrefixes...)
+	remoteIP := strings.Join(append(excludedAddrRanges(allowed, false), excludedAddrRanges(allowed, true)...), ",")
+
+	rules := []struct {
+		name     string
+		protocol string
+		ports    []string
+	}{
+		{names[0], "TCP", excludedPortRanges(openTCPPorts)},
+		{names[1], "UDP", excludedPortRanges(openUDPPorts)},
+	}
+
+	for _, rule := range rules {
+		output, err := runCommand("netsh", "advfirewall", "firewall", "add", "rule",
+			"name="+rule.name,
+			"dir=out",
+			"action=block",
+			"enable=yes",
+			"profile=any",
+			"protocol="+rule.protocol,
+			"remoteport="+strings.Join(rule.ports, ","),
+			"remoteip="+remoteIP).CombinedOutput()
+		if err != nil {
+			// Bộ rule cũ (nếu có) vẫn chặn, chỉ bỏ bộ mới chưa đủ
+			deleteFirewallRules(names)
+			return fmt.Errorf("add rule '%s': %v: %s", rule.name, err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	// Bộ mới đã có hiệu lực, giờ mới xóa bộ cũ và rule của phiên bản cũ
+	return deleteFirewallRules(append(e.ruleNames(1-next), legacyFirewallRuleNames...))
+}
+
+func (e *windowsFirewallEnforcer) Unblock() error {
+	return deleteFirewallRules(append(append(e.ruleNames(0), e.ruleNames(1)...), legacyFirewallRuleNames...))
+}
+
+// Chỉ coi là đang chặn khi đủ tất cả rule của một bộ
+func (e *windowsFirewallEnforcer) IsBlocked() (bool, error) {
+	set, err := e.activeRuleSet()
+	return set >= 0, err
+}
+
+// Bộ rule đang có đủ trên firewall (-1 nếu không có bộ nào đủ)
+func (e *windowsFirewallEnforcer) activeRuleSet() (int, error) {
+	for set := 0; set < 2; set++ {
+		complete := true
+		for _, name := range e.ruleNames(set) {
+			exists, err := firewallRuleExists(name)
+			if err != nil {
+				return -1, err
+			}
+			if !exists {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			return set, nil
+		}
+	}
+	return -1, nil
+}
+
+// Xóa các rule theo tên, bỏ qua rule không tồn tại
+func deleteFirewallRules(names []string) error {
+	var failed []string
+	for _, name := range names {
+		exists, err := firewallRuleExists(name)
+		if err != nil || !exists {
+			continue
+		}
+		if err := runCommand("netsh", "advfirewall", "firewall", "delete", "rule", "name="+name).Run(); err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("cannot delete rules: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// netsh trả về exit code 1 khi không có rule nào khớp tên
+func firewallRuleExists(name string) (bool, error) {
+	err := runCommand("netsh", "advfirewall", "firewall", "show", "rule", "name="+name).Run()
+	if err == nil {
+		return true, nil
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,161 @@
+// core-service/power.go
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Khoảng cách giữa hai lần kiểm tra lớn hơn mức này thì coi là máy vừa ngủ dậy
+// (ticker chạy mỗi 30 giây)
+const suspendGapThreshold = 2 * time.Minute
+
+// Loại sự kiện nguồn điện
+const (
+	PowerEventSuspend = "suspend" // Máy chuẩn bị ngủ / ngủ đông
+	PowerEventResume  = "resume"  // Máy vừa thức dậy
+)
+
+// Sự kiện nguồn điện từ hệ điều hành
+type PowerEvent struct {
+	Type string
+	At   time.Time
+}
+
+// PowerEventSource gửi các sự kiện suspend/resume của hệ điều hành
+type PowerEventSource interface {
+	Start(handler func(PowerEvent)) error
+	Stop()
+}
+
+// FakePowerEventSource là nguồn sự kiện giả lập dùng cho kiểm thử
+type FakePowerEventSource struct {
+	mutex   sync.Mutex
+	handler func(PowerEvent)
+}
+
+func NewFakePowerEventSource() *FakePowerEventSource {
+	return &FakePowerEventSource{}
+}
+
+func (f *FakePowerEventSource) Start(handler func(PowerEvent)) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.handler = handler
+	return nil
+}
+
+func (f *FakePowerEventSource) Stop() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.handler = nil
+}
+
+// Emit gửi một sự kiện giả lập tại thời điểm at
+func (f *FakePowerEventSource) Emit(eventType string, at time.Time) {
+	f.mutex.Lock()
+	handler := f.handler
+	f.mutex.Unlock()
+
+	if handler != nil {
+		handler(PowerEvent{Type: eventType, At: at})
+	}
+}
+
+// Thay nguồn sự kiện nguồn điện (nil = chỉ dựa vào khoảng cách giữa các lần kiểm tra).
+// Cần gọi trước StartMonitoring.
+func (tm *TimeManager) SetPowerEventSource(source PowerEventSource) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.powerSource = source
+}
+
+// Bắt đầu nhận sự kiện nguồn điện
+func (tm *TimeManager) startPowerEvents() {
+	tm.mutex.RLock()
+	source := tm.powerSource
+	tm.mutex.RUnlock()
+
+	if source == nil {
+		return
+	}
+	if err := source.Start(tm.handlePowerEvent); err != nil {
+		log.Printf("⚠️ Không nhận được sự kiện suspend/resume, chỉ dựa vào ticker: %v", err)
+	}
+}
+
+// Dừng nhận sự kiện nguồn điện
+func (tm *TimeManager) stopPowerEvents() {
+	tm.mutex.RLock()
+	source := tm.powerSource
+	tm.mutex.RUnlock()
+
+	if source != nil {
+		source.Stop()
+	}
+}
+
+// Xử lý sự kiện nguồn điện: đóng session khi máy ngủ, kiểm tra lại ngay khi thức dậy
+func (tm *TimeManager) handlePowerEvent(event PowerEvent) {
+	switch event.Type {
+	case PowerEventSuspend:
+		log.Printf("😴 Máy chuẩn bị ngủ lúc %s", event.At.Format("15:04:05"))
+		tm.mutex.Lock()
+		tm.suspendedAt = event.At.Round(0)
+		tm.mutex.Unlock()
+		tm.endSessionAt(event.At.Round(0))
+
+	case PowerEventResume:
+		log.Printf("🌅 Máy thức dậy lúc %s", event.At.Format("15:04:05"))
+		tm.mutex.Lock()
+		// Không nhận được sự kiện suspend: máy ngủ không sớm hơn lần kiểm tra cuối
+		if tm.suspendedAt.IsZero() && !tm.lastTickAt.IsZero() {
+			tm.suspendedAt = tm.lastTickAt.Round(0)
+		}
+		tm.mutex.Unlock()
+		go tm.checkTimeRules()
+	}
+}
+
+// Phát hiện máy vừa thức dậy, dựa trên sự kiện suspend đã nhận hoặc khoảng cách
+// bất thường giữa hai lần kiểm tra. Session được đóng tại thời điểm máy bắt đầu ngủ
+// để thời gian ngủ không bị tính là thời gian sử dụng.
+func (tm *TimeManager) detectResume(now time.Time) {
+	tm.mutex.Lock()
+	last := tm.lastTickAt
+	suspendedAt := tm.suspendedAt
+	tm.lastTickAt = now
+	tm.suspendedAt = time.Time{}
+
+	if last.IsZero() {
+		tm.mutex.Unlock()
+		return
+	}
+
+	// Trên Windows đồng hồ đơn điệu vẫn chạy khi ngủ; trên Linux thì không,
+	// nên khi đã biết máy ngủ thì phần chênh lệch với đồng hồ thực là thời gian ngủ.
+	// Nếu không nhận được sự kiện suspend, đồng hồ thực nhảy xa trong khi đồng hồ
+	// đơn điệu gần như đứng yên cũng là dấu hiệu máy đã ngủ chứ không phải bị chỉnh giờ.
+	monoGap := now.Sub(last)
+	wallGap := now.Round(0).Sub(last.Round(0))
+	sleptUnnoticed := suspendedAt.IsZero() && monotonicPausesInSuspend &&
+		monoGap <= suspendGapThreshold && wallGap-monoGap > suspendGapThreshold
+	if suspendedAt.IsZero() && monoGap <= suspendGapThreshold && !sleptUnnoticed {
+		tm.mutex.Unlock()
+		return
+	}
+	if (!suspendedAt.IsZero() || sleptUnnoticed) && wallGap-monoGap > clockTamperThreshold {
+		tm.acceptSuspendClockJumpLocked(wallGap - monoGap)
+	}
+	tm.mutex.Unlock()
+
+	sleepStart := suspendedAt
+	if sleepStart.IsZero() {
+		sleepStart = last.Round(0)
+	}
+
+	log.Printf("🌅 Máy vừa thức dậy, đã ngủ từ %s (khoảng %s)",
+		sleepStart.Format("2006-01-02 15:04:05"), now.Round(0).Sub(sleepStart).Round(time.Second))
+	tm.endSessionAt(sleepStart)
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+// core-service/power_linux.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CLOCK_MONOTONIC dừng khi máy ngủ: chỉ đồng hồ thực cho thấy thời gian đã ngủ
+const monotonicPausesInSuspend = true
+
+// linuxPowerEventSource theo dõi tín hiệu PrepareForSleep của systemd-logind
+// qua dbus-monitor (true = chuẩn bị ngủ, false = vừa thức dậy)
+type linuxPowerEventSource struct {
+	mutex sync.Mutex
+	cmd   *exec.Cmd
+}
+
+func newPlatformPowerEventSource() PowerEventSource {
+	return &linuxPowerEventSource{}
+}
+
+func (s *linuxPowerEventSource) Start(handler func(PowerEvent)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cmd != nil {
+		return nil
+	}
+
+	cmd := exec.Command("dbus-monitor", "--system",
+		"type='signal',interface='org.freedesktop.login1.Manager',member='PrepareForSleep'")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("dbus-monitor not available: %v", err)
+	}
+	s.cmd = cmd
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			switch strings.TrimSpace(scanner.Text()) {
+			case "boolean true":
+				handler(PowerEvent{Type: PowerEventSuspend, At: time.Now()})
+			case "boolean false":
+				handler(PowerEvent{Type: PowerEventResume, At: time.Now()})
+			}
+		}
+		cmd.Wait()
+	}()
+	return nil
+}
+
+func (s *linuxPowerEventSource) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	s.cmd = nil
+}
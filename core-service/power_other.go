@@ -0,0 +1,12 @@
+//go:build !windows && !linux
+
+// core-service/power_other.go
+package main
+
+// macOS và BSD: đồng hồ đơn điệu của Go cũng dừng khi máy ngủ
+const monotonicPausesInSuspend = true
+
+// Nền tảng khác chưa hỗ trợ sự kiện suspend/resume, chỉ dựa vào ticker
+func newPlatformPowerEventSource() PowerEventSource {
+	return nil
+}
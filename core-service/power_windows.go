@@ -0,0 +1,107 @@
+//go:build windows
+
+// core-service/power_windows.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Trên Windows đồng hồ đơn điệu vẫn chạy khi máy ngủ
+const monotonicPausesInSuspend = false
+
+const (
+	deviceNotifyCallback  = 2    // DEVICE_NOTIFY_CALLBACK
+	pbtAPMSuspend         = 0x4  // PBT_APMSUSPEND
+	pbtAPMResumeSuspend   = 0x7  // PBT_APMRESUMESUSPEND
+	pbtAPMResumeAutomatic = 0x12 // PBT_APMRESUMEAUTOMATIC
+)
+
+var (
+	powerPowrprof                                = windows.NewLazySystemDLL("powrprof.dll")
+	procPowerRegisterSuspendResumeNotification   = powerPowrprof.NewProc("PowerRegisterSuspendResumeNotification")
+	procPowerUnregisterSuspendResumeNotification = powerPowrprof.NewProc("PowerUnregisterSuspendResumeNotification")
+)
+
+// DEVICE_NOTIFY_SUBSCRIBE_PARAMETERS trong WinAPI
+type deviceNotifySubscribeParameters struct {
+	callback uintptr
+	context  uintptr
+}
+
+// windowsPowerEventSource nhận PBT_APMSUSPEND/PBT_APMRESUME* qua
+// PowerRegisterSuspendResumeNotification (Windows 8 trở lên), không cần cửa sổ
+// hay service handler.
+type windowsPowerEventSource struct {
+	mutex   sync.Mutex
+	handle  uintptr
+	params  *deviceNotifySubscribeParameters // Giữ tham chiếu khi Windows còn dùng
+	handler func(PowerEvent)
+}
+
+func newPlatformPowerEventSource() PowerEventSource {
+	return &windowsPowerEventSource{}
+}
+
+func (s *windowsPowerEventSource) Start(handler func(PowerEvent)) error {
+	if err := procPowerRegisterSuspendResumeNotification.Find(); err != nil {
+		return fmt.Errorf("power notifications not supported: %v", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.handle != 0 {
+		return nil
+	}
+
+	s.handler = handler
+	s.params = &deviceNotifySubscribeParameters{callback: windows.NewCallback(s.notify)}
+	ret, _, _ := procPowerRegisterSuspendResumeNotification.Call(
+		deviceNotifyCallback,
+		uintptr(unsafe.Pointer(s.params)),
+		uintptr(unsafe.Pointer(&s.handle)),
+	)
+	if ret != 0 {
+		return fmt.Errorf("PowerRegisterSuspendResumeNotification failed: error %d", ret)
+	}
+	return nil
+}
+
+func (s *windowsPowerEventSource) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.handle != 0 {
+		procPowerUnregisterSuspendResumeNotification.Call(s.handle)
+		s.handle = 0
+	}
+	s.handler = nil
+}
+
+// notify là DEVICE_NOTIFY_CALLBACK_ROUTINE, được Windows gọi trên thread riêng
+func (s *windowsPowerEventSource) notify(context, eventType, setting uintptr) uintptr {
+	var event string
+	switch eventType {
+	case pbtAPMSuspend:
+		event = PowerEventSuspend
+	case pbtAPMResumeSuspend, pbtAPMResumeAutomatic:
+		event = PowerEventResume
+	default:
+		return 0
+	}
+
+	s.mutex.Lock()
+	handler := s.handler
+	s.mutex.Unlock()
+
+	if handler != nil {
+		handler(PowerEvent{Type: event, At: time.Now()})
+	}
+	return 0
+}
@@ -0,0 +1,270 @@
+// core-service/protection.go
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Enforcement modes
+const (
+	EnforcementStandard   = "standard"   // Blocks are lifted when the service stops
+	EnforcementPersistent = "persistent" // Blocks stay in place across stop and crash (fail-closed)
+)
+
+// Key in service_state holding the saved protection state
+const protectionStateKey = "protection_state"
+
+// ProtectionState is saved on every change so a restarted service (or a new one
+// after a crash) can put the same blocks back before anything else runs
+type ProtectionState struct {
+	Mode           string    `json:"mode"`
+	Disabled       bool      `json:"disabled"`       // Parent turned protection off
+	NetworkBlocked bool      `json:"networkBlocked"` // Time-based block in place at the last change
+	BlockReason    string    `json:"blockReason,omitempty"`
+	ParentUID      string    `json:"parentUid,omitempty"` // Account that may disable protection or uninstall
+	ChangedBy      string    `json:"changedBy,omitempty"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+func loadProtectionState(db *sql.DB) ProtectionState {
+	state := ProtectionState{Mode: EnforcementPersistent}
+
+	var value string
+	err := db.QueryRow("SELECT value FROM service_state WHERE key = ?", protectionStateKey).Scan(&value)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Warning: could not load protection state: %v", err)
+		}
+		return state
+	}
+
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		log.Printf("Warning: protection state is corrupted, using defaults: %v", err)
+		return ProtectionState{Mode: EnforcementPersistent}
+	}
+	if state.Mode != EnforcementStandard {
+		state.Mode = EnforcementPersistent
+	}
+	return state
+}
+
+func saveProtectionState(db *sql.DB, state ProtectionState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT INTO service_state (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		protectionStateKey, string(data))
+	return err
+}
+
+// The Firebase account this PC is linked to, if any
+func (s *CoreService) linkedParentUID() string {
+	if s.firebaseService != nil && s.firebaseService.familyID != "" {
+		return s.firebaseService.familyID
+	}
+	if s.authService != nil {
+		return s.authService.GetUserUID()
+	}
+	return ""
+}
+
+// updateProtectionState applies a change to the protection state and saves it
+func (s *CoreService) updateProtectionState(actor string, update func(state *ProtectionState)) ProtectionState {
+	s.protectionMutex.Lock()
+	defer s.protectionMutex.Unlock()
+
+	update(&s.protection)
+	if uid := s.linkedParentUID(); uid != "" {
+		s.protection.ParentUID = uid
+	}
+	if actor != "" {
+		s.protection.ChangedBy = actor
+	}
+	s.protection.UpdatedAt = time.Now()
+
+	if err := saveProtectionState(s.db, s.protection); err != nil {
+		log.Printf("Warning: could not save protection state: %v", err)
+	}
+	return s.protection
+}
+
+// GetProtectionState returns a copy of the current protection state
+func (s *CoreService) GetProtectionState() ProtectionState {
+	s.protectionMutex.Lock()
+	defer s.protectionMutex.Unlock()
+	return s.protection
+}
+
+// reconcileProtection restores the saved state at startup: a parent-disabled PC
+// stays unprotected, otherwise (in persistent mode) the last network block is put
+// back before the first rule check
+func (s *CoreService) reconcileProtection() {
+	s.protectionMutex.Lock()
+	s.protection = loadProtectionState(s.db)
+	state := s.protection
+	s.protectionMutex.Unlock()
+
+	log.Printf("🛡️ Protection mode: %s (disabled=%v, network blocked at last change=%v)",
+		state.Mode, state.Disabled, state.NetworkBlocked)
+
+	s.timeManager.SetPersistentEnforcement(state.Mode == EnforcementPersistent)
+
+	if state.Disabled {
+		log.Println("🛡️ Protection was disabled by the parent, removing blocks")
+		s.hostsManager.SetSuspended(true)
+		s.timeManager.SetProtectionEnabled(false)
+		s.timeManager.unblockNetwork()
+		return
+	}
+
+	if state.Mode == EnforcementPersistent && state.NetworkBlocked && !s.timeManager.isNetworkBlocked() {
+		log.Printf("🛡️ Re-applying network block from before restart: %s", state.BlockReason)
+		if err := s.timeManager.blockNetwork(); err != nil {
+			log.Printf("Warning: could not re-apply network block: %v", err)
+		}
+	}
+}
+
+// setProtectionDisabled turns all blocking off (parent action) or back on
+func (s *CoreService) setProtectionDisabled(disabled bool, actor, reason string) error {
+	s.updateProtectionState(actor, func(state *ProtectionState) {
+		state.Disabled = disabled
+	})
+
+	if err := s.hostsManager.SetSuspended(disabled); err != nil {
+		log.Printf("Warning: could not update hosts file: %v", err)
+	}
+	s.timeManager.SetProtectionEnabled(!disabled)
+
+	action := "protection_enabled"
+	if disabled {
+		action = "protection_disabled"
+	}
+	s.recordTimeAudit(action, "", 0, reason, actor)
+	s.broadcastProtectionState()
+
+	log.Printf("🛡️ %s by %s", action, actor)
+	return nil
+}
+
+// setEnforcementMode switches between standard and persistent enforcement
+func (s *CoreService) setEnforcementMode(mode, actor string) error {
+	if mode != EnforcementStandard && mode != EnforcementPersistent {
+		return fmt.Errorf("mode must be '%s' or '%s'", EnforcementStandard, EnforcementPersistent)
+	}
+
+	s.updateProtectionState(actor, func(state *ProtectionState) {
+		state.Mode = mode
+	})
+	s.timeManager.SetPersistentEnforcement(mode == EnforcementPersistent)
+
+	s.recordTimeAudit("protection_mode", "", 0, mode, actor)
+	s.broadcastProtectionState()
+	return nil
+}
+
+// Notify SSE clients that the protection state changed
+func (s *CoreService) broadcastProtectionState() {
+	state := s.GetProtectionState()
+	message, _ := json.Marshal(map[string]interface{}{
+		"type":     "protection_changed",
+		"mode":     state.Mode,
+		"disabled": state.Disabled,
+	})
+
+	s.broadcastSSE(string(message))
+}
+
+// verifyParentCredentials checks the password against Firebase and that the account
+// is the one this PC is linked to. A PC that was never linked has nobody to ask.
+func verifyParentCredentials(parentUID, email, password string) error {
+	if parentUID == "" {
+		return nil
+	}
+	if email == "" || password == "" {
+		return fmt.Errorf("parent email and password are required")
+	}
+
+	uid, err := (&AuthService{}).authenticateWithFirebaseAPI(email, password)
+	if err != nil {
+		return err
+	}
+	if uid != parentUID {
+		return fmt.Errorf("this account is not the parent account linked to this PC")
+	}
+	return nil
+}
+
+// authorizeUninstall asks for the parent's credentials before the service is removed
+func authorizeUninstall() error {
+	if _, err := os.Stat(ServiceDatabasePath); err != nil {
+		return nil // Service never ran, nothing is protected yet
+	}
+
+	db, err := sql.Open("sqlite3", ServiceDatabasePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	state := loadProtectionState(db)
+	if state.ParentUID == "" {
+		return nil
+	}
+
+	email := os.Getenv("KIDSAFE_PARENT_EMAIL")
+	password := os.Getenv("KIDSAFE_PARENT_PASSWORD")
+	if email == "" || password == "" {
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Println("🔐 Uninstalling requires the parent account linked to this PC")
+		fmt.Print("📧 Email: ")
+		email, _ = reader.ReadString('\n')
+		fmt.Print("🔑 Password: ")
+		enablePasswordMode()
+		password, _ = reader.ReadString('\n')
+		disablePasswordMode()
+		fmt.Println()
+	}
+
+	return verifyParentCredentials(state.ParentUID, strings.TrimSpace(email), strings.TrimSpace(password))
+}
+
+// removeEnforcement lifts every block left by the service (hosts entries and firewall
+// rules) after an authorized uninstall
+func removeEnforcement() {
+	if err := NewHostsManager().Cleanup(); err != nil {
+		log.Printf("Warning: could not clean hosts file: %v", err)
+	}
+
+	if enforcer := newPlatformNetworkEnforcer(); enforcer != nil {
+		if err := enforcer.Unblock(); err != nil {
+			log.Printf("Warning: could not remove firewall rules: %v", err)
+		}
+	}
+
+	if _, err := os.Stat(ServiceDatabasePath); err != nil {
+		log.Println("All KidSafe blocks removed")
+		return
+	}
+	if db, err := sql.Open("sqlite3", ServiceDatabasePath); err == nil {
+		state := loadProtectionState(db)
+		state.NetworkBlocked = false
+		state.BlockReason = ""
+		state.ChangedBy = "uninstall"
+		state.UpdatedAt = time.Now()
+		saveProtectionState(db, state)
+		db.Close()
+	}
+
+	log.Println("All KidSafe blocks removed")
+}
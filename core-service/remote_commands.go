@@ -0,0 +1,360 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Commands the parent app can send to the PC
+const (
+	CommandLockInternet  = "lock_internet"  // params: minutes (default 60)
+	CommandAllowInternet = "allow_internet" // params: until (HH:MM)
+	CommandClearOverride = "clear_override" // Back to the time rules
+	CommandGrantTime     = "grant_time"     // params: minutes, reason
+	CommandSyncNow       = "sync_now"       // Re-read Firebase, push pending changes and usage
+	CommandReloadRules   = "reload_rules"   // Reload blocked sites and time rules from the database
+)
+
+// Acknowledgement states written back to commands/{id}/ack
+const (
+	CommandReceived = "received"
+	CommandDone     = "done"
+	CommandFailed   = "failed"
+	CommandRejected = "rejected" // Expired or created in the future, not executed
+)
+
+// A command without expiresAt is valid for this long after createdAt
+const defaultCommandTTL = 10 * time.Minute
+
+// Commands created further in the future than this are rejected (clock skew allowance)
+const maxCommandClockSkew = 5 * time.Minute
+
+// Executed command IDs are remembered this long for replay protection; no
+// command stays valid longer than that after its createdAt
+const commandHistoryRetention = 30 * 24 * time.Hour
+
+// RemoteCommand is written by the parent app to
+// kidsafe/families/{uid}/devices/{deviceId}/commands/{commandId}
+type RemoteCommand struct {
+	Type      string          `json:"type"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	IssuedBy  string          `json:"issuedBy,omitempty"`
+	CreatedAt int64           `json:"createdAt"`           // Milliseconds
+	ExpiresAt int64           `json:"expiresAt,omitempty"` // Milliseconds, default createdAt + 10 minutes
+	Ack       *CommandAck     `json:"ack,omitempty"`
+}
+
+// CommandAck is written by the PC when a command is received and when it finishes
+type CommandAck struct {
+	Status      string      `json:"status"`
+	DeviceID    string      `json:"deviceId"`
+	ReceivedAt  int64       `json:"receivedAt"`
+	CompletedAt int64       `json:"completedAt,omitempty"`
+	Result      interface{} `json:"result,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// commandsPath is the command queue of this PC
+func (fs *FirebaseService) commandsPath() string {
+	return fmt.Sprintf("kidsafe/families/%s/devices/%s/commands", fs.familyID, fs.deviceID)
+}
+
+// listenForCommands follows the command queue of this PC
+func (fs *FirebaseService) listenForCommands() {
+	path := fs.commandsPath()
+	log.Printf("📨 Starting remote command listener at: %s", path)
+
+	fs.followPath("Remote commands", path, func(data json.RawMessage) {
+		var commands map[string]*RemoteCommand
+		if err := json.Unmarshal(data, &commands); err != nil {
+			log.Printf("❌ Invalid remote commands data: %v", err)
+			return
+		}
+		go fs.processCommands(commands)
+	})
+	log.Println("📨 Remote command listener stopped")
+}
+
+// processCommands runs the commands that have no acknowledgement yet, oldest
+// first. Commands only acknowledged as received get their final ack again.
+func (fs *FirebaseService) processCommands(commands map[string]*RemoteCommand) {
+	fs.remoteCommandMutex.Lock()
+	defer fs.remoteCommandMutex.Unlock()
+
+	ids := make([]string, 0, len(commands))
+	for id, command := range commands {
+		if command != nil && (command.Ack == nil || command.Ack.Status == CommandReceived) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if commands[ids[i]].CreatedAt != commands[ids[j]].CreatedAt {
+			return commands[ids[i]].CreatedAt < commands[ids[j]].CreatedAt
+		}
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		fs.processCommand(id, commands[id])
+	}
+}
+
+func (fs *FirebaseService) processCommand(id string, command *RemoteCommand) {
+	now := time.Now()
+
+	// Replay protection: every command ID is executed at most once
+	fresh, err := fs.claimCommand(id, command)
+	if err != nil {
+		log.Printf("❌ Could not record remote command %s: %v", id, err)
+		return
+	}
+	if !fresh {
+		// Executed before but the acknowledgement was lost (e.g. offline)
+		fs.resendCommandAck(id)
+		return
+	}
+
+	ack := &CommandAck{Status: CommandReceived, DeviceID: fs.deviceID, ReceivedAt: now.UnixMilli()}
+	if err := validateCommandTime(command, now); err != nil {
+		fs.finishCommand(id, command, ack, nil, err, CommandRejected)
+		return
+	}
+	fs.writeCommandAck(id, ack)
+
+	log.Printf("📨 Remote command %s: %s (from %s)", id, command.Type, command.IssuedBy)
+	result, err := fs.executeCommand(command)
+	status := CommandDone
+	if err != nil {
+		status = CommandFailed
+	}
+	fs.finishCommand(id, command, ack, result, err, status)
+}
+
+// validateCommandTime rejects commands that expired or claim to come from the future
+func validateCommandTime(command *RemoteCommand, now time.Time) error {
+	if command.CreatedAt <= 0 {
+		return fmt.Errorf("command has no createdAt")
+	}
+	created := time.UnixMilli(command.CreatedAt)
+	if created.After(now.Add(maxCommandClockSkew)) {
+		return fmt.Errorf("command created in the future (%s)", created.Format(time.RFC3339))
+	}
+
+	expires := created.Add(defaultCommandTTL)
+	if command.ExpiresAt > 0 {
+		expires = time.UnixMilli(command.ExpiresAt)
+	}
+	// Its ID is forgotten after the retention, so it must not be replayable by then
+	if limit := created.Add(commandHistoryRetention); expires.After(limit) {
+		expires = limit
+	}
+	if !now.Before(expires) {
+		return fmt.Errorf("command expired at %s", expires.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// executeCommand dispatches a command to the TimeManager, the hosts file or the sync
+func (fs *FirebaseService) executeCommand(command *RemoteCommand) (interface{}, error) {
+	s := fs.coreService
+	if s == nil || s.timeManager == nil {
+		return nil, fmt.Errorf("core service not available")
+	}
+
+	actor := command.IssuedBy
+	if actor == "" {
+		actor = "parent-app"
+	}
+
+	switch command.Type {
+	case CommandLockInternet, CommandAllowInternet:
+		var params struct {
+			Minutes int    `json:"minutes"`
+			Until   string `json:"until"`
+			Reason  string `json:"reason"`
+		}
+		if err := decodeCommandParams(command, &params); err != nil {
+			return nil, err
+		}
+		mode := ManualBlock
+		if command.Type == CommandAllowInternet {
+			mode = ManualAllow
+		}
+
+		now := time.Now()
+		override, err := newManualOverride(mode, params.Minutes, params.Until, now)
+		if err != nil {
+			return nil, err
+		}
+		override.Reason = params.Reason
+		override.Actor = actor
+		if err := s.timeManager.SetManualOverride(*override); err != nil {
+			return nil, err
+		}
+
+		s.recordTimeAudit("manual_"+override.Mode, now.Format(usageDateLayout),
+			int64(override.ExpiresAt.Sub(now).Minutes()), params.Reason, actor)
+		s.broadcastManualOverride(override)
+		return map[string]interface{}{"mode": override.Mode, "expiresAt": override.ExpiresAt.UnixMilli()}, nil
+
+	case CommandClearOverride:
+		cleared, err := s.timeManager.ClearManualOverride()
+		if err != nil {
+			return nil, err
+		}
+		if cleared {
+			s.recordTimeAudit("manual_clear", time.Now().Format(usageDateLayout), 0, "", actor)
+			s.broadcastManualOverride(nil)
+		}
+		return map[string]interface{}{"cleared": cleared}, nil
+
+	case CommandGrantTime:
+		var params struct {
+			Minutes int    `json:"minutes"`
+			Reason  string `json:"reason"`
+		}
+		if err := decodeCommandParams(command, &params); err != nil {
+			return nil, err
+		}
+		grant, err := s.timeManager.AddGrant(TimeGrant{
+			Minutes:   params.Minutes,
+			Reason:    params.Reason,
+			GrantedBy: actor,
+			Source:    "command",
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.recordTimeAudit("grant", grant.Date, int64(grant.Minutes), grant.Reason, grant.GrantedBy)
+		return map[string]interface{}{"grantId": grant.ID, "date": grant.Date, "minutes": grant.Minutes}, nil
+
+	case CommandSyncNow:
+		if err := fs.ForceSync(); err != nil {
+			return nil, err
+		}
+		fs.pushRuleChanges()
+		fs.queuePendingUsageDays()
+		fs.flushUsageQueue()
+		fs.publishDeviceUsage()
+		return map[string]interface{}{"blockedUrls": len(fs.GetBlockedUrls())}, nil
+
+	case CommandReloadRules:
+		if err := s.loadRules(); err != nil {
+			return nil, err
+		}
+		if err := s.syncRulesToHosts(); err != nil {
+			return nil, fmt.Errorf("failed to update hosts file: %v", err)
+		}
+		if err := s.timeManager.LoadStoredRules(); err != nil {
+			return nil, err
+		}
+		go s.broadcastRulesUpdate()
+		go s.timeManager.checkTimeRules()
+		return map[string]interface{}{"blockedDomains": len(s.hostsManager.GetBlockedDomains())}, nil
+	}
+
+	return nil, fmt.Errorf("unknown command type '%s'", command.Type)
+}
+
+func decodeCommandParams(command *RemoteCommand, params interface{}) error {
+	if len(command.Params) == 0 || string(command.Params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(command.Params, params); err != nil {
+		return fmt.Errorf("invalid params for %s: %v", command.Type, err)
+	}
+	return nil
+}
+
+// claimCommand records a command ID; returns false when it was seen before
+func (fs *FirebaseService) claimCommand(id string, command *RemoteCommand) (bool, error) {
+	if fs.database == nil {
+		return false, fmt.Errorf("database not available")
+	}
+
+	// A command received before its createdAt (clock skew) keeps its ID until it expires
+	fs.database.Exec("DELETE FROM remote_commands WHERE received_at < ?", time.Now().Add(-commandHistoryRetention-maxCommandClockSkew))
+
+	result, err := fs.database.Exec("INSERT OR IGNORE INTO remote_commands (id, type, issued_by, status, received_at) VALUES (?, ?, ?, ?, ?)",
+		id, command.Type, command.IssuedBy, CommandReceived, time.Now())
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted > 0, err
+}
+
+// failInterruptedCommands marks the commands claimed but never finished by an
+// earlier run of the service (e.g. a crash while executing) as failed, so the
+// parent app gets an ack. They are not run again: a grant may already apply.
+func (fs *FirebaseService) failInterruptedCommands() {
+	if fs.database == nil {
+		return
+	}
+
+	fs.remoteCommandMutex.Lock()
+	defer fs.remoteCommandMutex.Unlock()
+
+	result, err := fs.database.Exec("UPDATE remote_commands SET status = ?, error = ?, completed_at = ? WHERE completed_at IS NULL",
+		CommandFailed, "interrupted by a service restart, send the command again", time.Now())
+	if err != nil {
+		log.Printf("❌ Could not close interrupted remote commands: %v", err)
+		return
+	}
+	if count, _ := result.RowsAffected(); count > 0 {
+		log.Printf("⚠️ %d remote command(s) interrupted by a restart marked as failed", count)
+	}
+}
+
+// finishCommand stores and writes back the outcome of a command
+func (fs *FirebaseService) finishCommand(id string, command *RemoteCommand, ack *CommandAck, result interface{}, err error, status string) {
+	ack.Status = status
+	ack.CompletedAt = time.Now().UnixMilli()
+	ack.Result = result
+	if err != nil {
+		ack.Error = err.Error()
+		log.Printf("⚠️ Remote command %s (%s) %s: %v", id, command.Type, status, err)
+	} else {
+		log.Printf("✅ Remote command %s (%s) done", id, command.Type)
+	}
+
+	resultJSON, _ := json.Marshal(result)
+	fs.database.Exec("UPDATE remote_commands SET status = ?, result = ?, error = ?, completed_at = ? WHERE id = ?",
+		status, string(resultJSON), ack.Error, time.Now(), id)
+	fs.writeCommandAck(id, ack)
+}
+
+// resendCommandAck writes the stored outcome of a finished command again
+func (fs *FirebaseService) resendCommandAck(id string) {
+	var status string
+	var result, errorText sql.NullString
+	var receivedAt time.Time
+	var completedAt sql.NullTime
+	err := fs.database.QueryRow("SELECT status, result, error, received_at, completed_at FROM remote_commands WHERE id = ?", id).Scan(
+		&status, &result, &errorText, &receivedAt, &completedAt)
+	if err != nil || !completedAt.Valid {
+		return // Still running
+	}
+
+	ack := &CommandAck{
+		Status:      status,
+		DeviceID:    fs.deviceID,
+		ReceivedAt:  receivedAt.UnixMilli(),
+		CompletedAt: completedAt.Time.UnixMilli(),
+		Error:       errorText.String,
+	}
+	if result.Valid && result.String != "" && result.String != "null" {
+		ack.Result = json.RawMessage(result.String)
+	}
+	fs.writeCommandAck(id, ack)
+}
+
+func (fs *FirebaseService) writeCommandAck(id string, ack *CommandAck) {
+	if err := fs.backend.Set(fs.ctx, fs.commandsPath()+"/"+id+"/ack", ack); err != nil {
+		log.Printf("⚠️ Could not acknowledge remote command %s: %v", id, err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The server sends keep-alive events every 30 seconds; a stream silent for longer is dead
+const rtdbStreamIdleTimeout = 90 * time.Second
+
+var (
+	errStreamAuthRevoked = errors.New("stream credentials expired")
+	errStreamCanceled    = errors.New("stream canceled by the server")
+	errStreamIdle        = errors.New("no keep-alive from the server")
+)
+
+// RTDBStream follows one Realtime Database location over the REST streaming
+// protocol (text/event-stream with put, patch, keep-alive, cancel and
+// auth_revoked events). BaseURL can point at a local SSE server that speaks the
+// same protocol.
+type RTDBStream struct {
+	BaseURL     string                                    // e.g. https://<db>.firebasedatabase.app
+	Path        string                                    // e.g. kidsafe/families/<uid>/blockedUrls
+	Token       func(ctx context.Context) (string, error) // OAuth access token sent as a bearer header, nil for unauthenticated access
+	Query       url.Values                                // Extra query parameters (e.g. ns for the emulator)
+	Header      http.Header                               // Extra request headers
+	HTTPClient  *http.Client
+	IdleTimeout time.Duration // Longest silence before the stream is dropped, rtdbStreamIdleTimeout when zero
+
+	// OnChange receives the whole value at Path after every put or patch
+	OnChange func(data json.RawMessage)
+
+	mutex sync.Mutex
+	tree  interface{}
+}
+
+// streamEvent is the data of a put or patch event
+type streamEvent struct {
+	Path string          `json:"path"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Run connects and delivers changes until the stream fails or ctx is done.
+// It always returns a non-nil error.
+func (s *RTDBStream) Run(ctx context.Context) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	idleTimeout := s.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = rtdbStreamIdleTimeout
+	}
+
+	var idle atomic.Bool
+	watchdog := time.AfterFunc(idleTimeout, func() {
+		idle.Store(true)
+		cancel()
+	})
+	defer watchdog.Stop()
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, s.streamURL(), nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range s.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// The token goes in a header, never in the URL (errors and logs include the URL)
+	if s.Token != nil {
+		token, err := s.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("could not get access token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("stream returned HTTP %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		return fmt.Errorf("stream returned unexpected content type '%s'", contentType)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var event string
+	var data strings.Builder
+	for scanner.Scan() {
+		watchdog.Reset(idleTimeout)
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if event != "" {
+				if err := s.handleEvent(event, data.String()); err != nil {
+					return err
+				}
+			}
+			event = ""
+			data.Reset()
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+
+	switch {
+	case idle.Load():
+		return errStreamIdle
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case scanner.Err() != nil:
+		return scanner.Err()
+	}
+	return errors.New("stream closed by the server")
+}
+
+func (s *RTDBStream) streamURL() string {
+	base := strings.TrimRight(s.BaseURL, "/")
+	path := strings.Trim(s.Path, "/")
+	streamURL := fmt.Sprintf("%s/%s.json", base, path)
+	if len(s.Query) > 0 {
+		streamURL += "?" + s.Query.Encode()
+	}
+	return streamURL
+}
+
+func (s *RTDBStream) handleEvent(event, data string) error {
+	switch event {
+	case "put", "patch":
+		var change streamEvent
+		if err := json.Unmarshal([]byte(data), &change); err != nil {
+			return fmt.Errorf("invalid %s event: %v", event, err)
+		}
+
+		var value interface{}
+		if len(change.Data) > 0 {
+			if err := json.Unmarshal(change.Data, &value); err != nil {
+				return fmt.Errorf("invalid %s data: %v", event, err)
+			}
+		}
+
+		s.mutex.Lock()
+		if event == "put" {
+			s.tree = setTreeValue(s.tree, splitTreePath(change.Path), value)
+		} else if children, ok := value.(map[string]interface{}); ok {
+			for key, child := range children {
+				s.tree = setTreeValue(s.tree, append(splitTreePath(change.Path), splitTreePath(key)...), child)
+			}
+		}
+		snapshot, err := json.Marshal(s.tree)
+		s.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+
+		if s.OnChange != nil {
+			s.OnChange(snapshot)
+		}
+	case "keep-alive":
+	case "cancel":
+		return fmt.Errorf("%w: %s", errStreamCanceled, data)
+	case "auth_revoked":
+		return errStreamAuthRevoked
+	}
+	return nil
+}
+
+func splitTreePath(path string) []string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// setTreeValue stores value at path inside node; a nil value deletes the path
+func setTreeValue(node interface{}, path []string, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	children, ok := node.(map[string]interface{})
+	if !ok {
+		if value == nil {
+			return node
+		}
+		children = make(map[string]interface{})
+	}
+
+	child := setTreeValue(children[path[0]], path[1:], value)
+	if child == nil {
+		delete(children, path[0])
+	} else {
+		children[path[0]] = child
+	}
+
+	if len(children) == 0 {
+		return nil
+	}
+	return children
+}
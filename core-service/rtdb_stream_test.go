@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sseEvent is one event sent by the stand-in server
+type sseEvent struct {
+	name string
+	data string
+}
+
+// newSSEServer stands in for the Realtime Database streaming API: it checks the
+// bearer token, sends events and then keeps the connection open until the
+// client goes away
+func newSSEServer(t *testing.T, token string, events ...sseEvent) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != "" {
+			t.Errorf("access token sent in the URL: %s", r.URL)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, event := range events {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, event.data)
+			flusher.Flush()
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// runStream runs a stream against the server and returns every value passed
+// to OnChange and the error Run ended with
+func runStream(t *testing.T, server *httptest.Server, idleTimeout time.Duration) ([]string, error) {
+	t.Helper()
+
+	var mutex sync.Mutex
+	var changes []string
+	stream := &RTDBStream{
+		BaseURL:     server.URL,
+		Path:        "kidsafe/families/fam/blockedUrls",
+		Token:       func(ctx context.Context) (string, error) { return "test-token", nil },
+		IdleTimeout: idleTimeout,
+		OnChange: func(data json.RawMessage) {
+			mutex.Lock()
+			changes = append(changes, string(data))
+			mutex.Unlock()
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := stream.Run(ctx)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return changes, err
+}
+
+func assertJSON(t *testing.T, got, want string) {
+	t.Helper()
+
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		t.Fatalf("invalid JSON %q: %v", got, err)
+	}
+	json.Unmarshal([]byte(want), &wantValue)
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestRTDBStreamMergesPutAndPatch(t *testing.T) {
+	server := newSSEServer(t, "test-token",
+		sseEvent{"put", `{"path":"/","data":{"a":{"url":"a.com"},"b":{"url":"b.com"}}}`},
+		sseEvent{"keep-alive", "null"},
+		sseEvent{"patch", `{"path":"/","data":{"b":null,"c":{"url":"c.com"}}}`},
+		sseEvent{"put", `{"path":"/a/url","data":"a.org"}`},
+		sseEvent{"patch", `{"path":"/c","data":{"status":"inactive"}}`},
+		sseEvent{"cancel", "permission denied"},
+	)
+
+	changes, err := runStream(t, server, 0)
+	if !errors.Is(err, errStreamCanceled) {
+		t.Fatalf("Run returned %v, want errStreamCanceled", err)
+	}
+	if len(changes) != 4 {
+		t.Fatalf("got %d changes, want 4: %v", len(changes), changes)
+	}
+	assertJSON(t, changes[0], `{"a":{"url":"a.com"},"b":{"url":"b.com"}}`)
+	assertJSON(t, changes[1], `{"a":{"url":"a.com"},"c":{"url":"c.com"}}`)
+	assertJSON(t, changes[3], `{"a":{"url":"a.org"},"c":{"url":"c.com","status":"inactive"}}`)
+}
+
+func TestRTDBStreamDeletesWholeTree(t *testing.T) {
+	server := newSSEServer(t, "test-token",
+		sseEvent{"put", `{"path":"/","data":{"a":{"url":"a.com"}}}`},
+		sseEvent{"put", `{"path":"/a","data":null}`},
+		sseEvent{"cancel", ""},
+	)
+
+	changes, _ := runStream(t, server, 0)
+	if len(changes) != 2 || changes[1] != "null" {
+		t.Fatalf("got changes %v, want the tree to end as null", changes)
+	}
+}
+
+func TestRTDBStreamIdleTimeout(t *testing.T) {
+	server := newSSEServer(t, "test-token",
+		sseEvent{"put", `{"path":"/","data":{"a":{"url":"a.com"}}}`},
+		sseEvent{"keep-alive", "null"},
+	)
+
+	started := time.Now()
+	changes, err := runStream(t, server, 200*time.Millisecond)
+	if !errors.Is(err, errStreamIdle) {
+		t.Fatalf("Run returned %v, want errStreamIdle", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("idle stream dropped after %v", elapsed)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(changes))
+	}
+}
+
+func TestRTDBStreamAuthRevoked(t *testing.T) {
+	server := newSSEServer(t, "test-token",
+		sseEvent{"put", `{"path":"/","data":true}`},
+		sseEvent{"auth_revoked", "credential is no longer valid"},
+	)
+
+	if _, err := runStream(t, server, 0); !errors.Is(err, errStreamAuthRevoked) {
+		t.Fatalf("Run returned %v, want errStreamAuthRevoked", err)
+	}
+}
+
+func TestRTDBStreamRejectsWrongToken(t *testing.T) {
+	server := newSSEServer(t, "other-token")
+
+	_, err := runStream(t, server, 0)
+	if err == nil || errors.Is(err, errStreamCanceled) {
+		t.Fatalf("Run returned %v, want an HTTP error", err)
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Status of an entry in the family's blockedUrls list
+const (
+	blockedUrlActive   = "active"
+	blockedUrlInactive = "inactive"
+	blockedUrlDeleted  = "deleted" // Only kept locally as a tombstone, the Firebase entry is removed
+)
+
+// AddedBy value of the rules created on the PC
+const blockedUrlAddedByPC = "pc"
+
+// Category of the local rules created from Firebase entries
+const firebaseSyncCategory = "firebase-sync"
+
+// Tombstones of deletions are dropped once every device has had time to see them
+const ruleTombstoneRetention = 30 * 24 * time.Hour
+
+// How often local rule changes made while offline are retried
+const rulePushRetryInterval = time.Minute
+
+// syncedRule is the sync state of one entry of the family's blockedUrls list.
+//
+// Concurrent edits are resolved per entry by time: the PC change wins when it
+// is newer than the entry's updatedAt (or addedAt for entries that never had
+// an update), otherwise the Firebase entry wins. An entry that disappears from
+// Firebase was deleted on another device, unless the PC has an unpushed change
+// for it, in which case the PC change recreates it.
+//
+// Entries targeted at other devices are kept in the sync state but do not
+// change the local rules of this PC.
+type syncedRule struct {
+	Key       string
+	Domain    string
+	URL       string
+	Status    string
+	AddedAt   int64
+	AddedBy   string
+	UpdatedAt int64 // Milliseconds, last edit on either side
+	Pending   bool  // PC change not yet written to Firebase
+	Devices   []string
+}
+
+// editedAt is when the entry was last changed, in milliseconds
+func (u *BlockedUrl) editedAt() int64 {
+	if u.UpdatedAt > u.AddedAt {
+		return u.UpdatedAt
+	}
+	return u.AddedAt
+}
+
+func newRuleSyncKey() string {
+	return fmt.Sprintf("pc_%d", time.Now().UnixNano())
+}
+
+// recordLocalRuleChange records a rule added, enabled, disabled or deleted on
+// the PC so it is pushed to the family's blockedUrls list
+func (s *CoreService) recordLocalRuleChange(domain, status string) {
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return
+	}
+
+	if err := s.storeLocalRuleChange(domain, status); err != nil {
+		log.Printf("Warning: could not record rule change for %s: %v", domain, err)
+		return
+	}
+
+	if s.firebaseService != nil {
+		go s.firebaseService.pushRuleChanges()
+	}
+}
+
+func (s *CoreService) storeLocalRuleChange(domain, status string) error {
+	if status != blockedUrlActive {
+		if err := s.checkLocalRuleRemoval(domain); err != nil {
+			return err
+		}
+	}
+
+	s.ruleSyncMutex.Lock()
+	defer s.ruleSyncMutex.Unlock()
+
+	// Only the entries that apply to this PC change, those targeted at
+	// other devices are left alone
+	now := time.Now().UnixMilli()
+	deviceID := loadDeviceID(s.db)
+	rows, err := loadSyncedRules(s.db, "WHERE domain = ? AND status != ?", domain, blockedUrlDeleted)
+	if err != nil {
+		return err
+	}
+	updated := 0
+	for key, row := range rows {
+		if !appliesToDevice(row.Devices, deviceID) {
+			continue
+		}
+		// A delete or disable of an entry shared with other PCs only takes this PC
+		// off the entry, the others keep it
+		if status != blockedUrlActive && len(row.Devices) > 1 {
+			_, err = s.db.Exec("UPDATE rule_sync SET devices = ?, updated_at = ?, pending = 1 WHERE firebase_key = ?",
+				encodeDevices(withoutDevice(row.Devices, deviceID)), now, key)
+		} else {
+			_, err = s.db.Exec("UPDATE rule_sync SET status = ?, updated_at = ?, pending = 1 WHERE firebase_key = ?", status, now, key)
+		}
+		if err != nil {
+			return err
+		}
+		updated++
+	}
+	if updated > 0 {
+		return nil
+	}
+
+	// First change of this domain: reuse the entry Firebase already has for it
+	key, url, addedAt, addedBy := "", domain, now, blockedUrlAddedByPC
+	var devices []string
+	if s.firebaseService != nil {
+		if existing, existingKey := s.firebaseService.blockedUrlForDomain(domain); existing != nil {
+			key, url, addedAt, addedBy, devices = existingKey, existing.URL, existing.AddedAt, existing.AddedBy, existing.Devices
+			if status != blockedUrlActive && len(devices) > 1 {
+				devices, status = withoutDevice(devices, deviceID), blockedUrlActive
+				if existing.Status != "" {
+					status = existing.Status
+				}
+			}
+		}
+	}
+	if key == "" {
+		if status == blockedUrlDeleted {
+			return nil // Never synced, nothing to remove
+		}
+		// A rule added on the PC targets this PC only
+		key, devices = newRuleSyncKey(), []string{deviceID}
+	}
+
+	_, err = s.db.Exec(`INSERT INTO rule_sync (firebase_key, domain, url, status, added_at, added_by, updated_at, pending, devices)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?)
+		ON CONFLICT(firebase_key) DO UPDATE SET status = excluded.status, updated_at = excluded.updated_at, pending = 1,
+			devices = excluded.devices`,
+		key, domain, url, status, addedAt, addedBy, now, encodeDevices(devices))
+	return err
+}
+
+// checkLocalRuleRemoval refuses a local delete or disable of domain while an
+// entry blocks it on every device (no device list, "*" or "all"): only the
+// parent app can lift it
+func (s *CoreService) checkLocalRuleRemoval(domain string) error {
+	domain = normalizeDomain(domain)
+	rows, err := loadSyncedRules(s.db, "WHERE domain = ? AND status = ?", domain, blockedUrlActive)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if targetsAllDevices(row.Devices) {
+			return fmt.Errorf("%s is blocked on every device by the parent app, change it there", domain)
+		}
+	}
+	if s.firebaseService != nil {
+		if existing, _ := s.firebaseService.blockedUrlForDomain(domain); existing != nil &&
+			existing.Status != blockedUrlInactive && targetsAllDevices(existing.Devices) {
+			return fmt.Errorf("%s is blocked on every device by the parent app, change it there", domain)
+		}
+	}
+	return nil
+}
+
+// blockedUrlForDomain finds the entry of the last Firebase snapshot that blocks
+// domain on this PC
+func (fs *FirebaseService) blockedUrlForDomain(domain string) (*BlockedUrl, string) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	for key, entry := range fs.blockedUrls {
+		if entry != nil && normalizeDomain(entry.URL) == domain && fs.appliesToThisDevice(entry.Devices) {
+			copied := *entry
+			return &copied, key
+		}
+	}
+	return nil, ""
+}
+
+// rulesPath is the blockedUrls location followed by the listener
+func (fs *FirebaseService) rulesPath() string {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if fs.blockedUrlsPath != "" {
+		return fs.blockedUrlsPath
+	}
+	return fmt.Sprintf("kidsafe/families/%s/blockedUrls", fs.familyID)
+}
+
+// mergeBlockedUrls merges a Firebase snapshot into the sync state and the local
+// rules. Returns the number of domains whose local rules changed.
+func (fs *FirebaseService) mergeBlockedUrls(remote map[string]*BlockedUrl) (int, error) {
+	fs.coreService.ruleSyncMutex.Lock()
+	defer fs.coreService.ruleSyncMutex.Unlock()
+
+	local, err := loadSyncedRules(fs.database, "")
+	if err != nil {
+		return 0, err
+	}
+
+	touched := make(map[string]bool)
+	for key, entry := range remote {
+		if entry == nil {
+			continue
+		}
+		domain := normalizeDomain(entry.URL)
+		if domain == "" {
+			continue
+		}
+
+		row, known := local[key]
+		if known && row.UpdatedAt > entry.editedAt() {
+			// The PC change is newer, make sure it reaches Firebase
+			if !row.Pending && row.Status != entry.Status {
+				fs.database.Exec("UPDATE rule_sync SET pending = 1 WHERE firebase_key = ?", key)
+			}
+			continue
+		}
+		if known && !row.Pending && row.Domain == domain && row.Status == entry.Status && row.UpdatedAt == entry.editedAt() &&
+			encodeDevices(row.Devices) == encodeDevices(entry.Devices) {
+			continue
+		}
+
+		if err := storeSyncedRule(fs.database, key, domain, entry); err != nil {
+			log.Printf("❌ Error saving synced rule %s: %v", key, err)
+			continue
+		}
+		touched[domain] = true
+		if known && row.Domain != domain {
+			touched[row.Domain] = true
+		}
+	}
+
+	// Entries missing from the snapshot were deleted on another device
+	now := time.Now().UnixMilli()
+	for key, row := range local {
+		if _, exists := remote[key]; exists || row.Pending || row.Status == blockedUrlDeleted {
+			continue
+		}
+		fs.database.Exec("UPDATE rule_sync SET status = ?, updated_at = ? WHERE firebase_key = ?", blockedUrlDeleted, now, key)
+		touched[row.Domain] = true
+		log.Printf("🗑️ Rule %s was deleted on another device", row.Domain)
+	}
+
+	fs.database.Exec("DELETE FROM rule_sync WHERE status = ? AND pending = 0 AND updated_at < ?",
+		blockedUrlDeleted, time.Now().Add(-ruleTombstoneRetention).UnixMilli())
+
+	// Rules created on the PC before syncing existed are pushed like new ones
+	fs.database.Exec(`INSERT INTO rule_sync (firebase_key, domain, url, status, added_at, added_by, updated_at, pending)
+		SELECT 'pc_' || MIN(id), domain, domain, CASE WHEN MAX(is_active) THEN ? ELSE ? END, ?, ?, ?, 1
+		FROM block_rules WHERE COALESCE(category, '') != ? AND domain NOT IN (SELECT domain FROM rule_sync)
+		GROUP BY domain`,
+		blockedUrlActive, blockedUrlInactive, now, blockedUrlAddedByPC, now, firebaseSyncCategory)
+
+	for domain := range touched {
+		fs.applySyncedDomain(domain)
+	}
+
+	// Synced rules left over from before the sync state existed
+	changed := len(touched)
+	result, err := fs.database.Exec("DELETE FROM block_rules WHERE category = ? AND domain NOT IN (SELECT domain FROM rule_sync WHERE status != ?)",
+		firebaseSyncCategory, blockedUrlDeleted)
+	if err == nil {
+		removed, _ := result.RowsAffected()
+		changed += int(removed)
+	}
+	return changed, nil
+}
+
+// pushRuleChanges writes the PC changes not yet in Firebase. A change is dropped
+// when the Firebase entry was edited after it on another device.
+func (fs *FirebaseService) pushRuleChanges() {
+	if fs.database == nil || fs.coreService == nil {
+		return
+	}
+
+	fs.coreService.ruleSyncMutex.Lock()
+	defer fs.coreService.ruleSyncMutex.Unlock()
+
+	pending, err := loadSyncedRules(fs.database, "WHERE pending = 1")
+	if err != nil {
+		log.Printf("❌ Error reading pending rule changes: %v", err)
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	path := fs.rulesPath()
+	touched := make(map[string]bool)
+	pushed := 0
+	for key, row := range pending {
+		entryPath := path + "/" + key
+
+		var remote *BlockedUrl
+		if err := fs.backend.Get(fs.ctx, entryPath, &remote); err != nil {
+			log.Printf("⚠️ Rule changes not pushed, will retry: %v", err)
+			break
+		}
+		if remote != nil && remote.editedAt() > row.UpdatedAt {
+			log.Printf("🔀 Rule %s changed on another device after the PC change, keeping the newer edit", row.Domain)
+			if domain := normalizeDomain(remote.URL); domain != "" {
+				storeSyncedRule(fs.database, key, domain, remote)
+				touched[domain] = true
+			}
+			touched[row.Domain] = true
+			continue
+		}
+
+		var value interface{}
+		if row.Status != blockedUrlDeleted {
+			value = &BlockedUrl{
+				ID:        key,
+				URL:       row.URL,
+				AddedAt:   row.AddedAt,
+				AddedBy:   row.AddedBy,
+				Status:    row.Status,
+				UpdatedAt: row.UpdatedAt,
+				Devices:   row.Devices,
+			}
+		}
+		if err := fs.backend.Set(fs.ctx, entryPath, value); err != nil {
+			log.Printf("⚠️ Rule changes not pushed, will retry: %v", err)
+			break
+		}
+
+		// Changed again while pushing: stays pending
+		fs.database.Exec("UPDATE rule_sync SET pending = 0 WHERE firebase_key = ? AND updated_at = ?", key, row.UpdatedAt)
+		pushed++
+	}
+
+	if pushed > 0 {
+		log.Printf("[FIREBASE] Pushed %d rule change(s) to %s", pushed, path)
+	}
+
+	if len(touched) > 0 {
+		for domain := range touched {
+			fs.applySyncedDomain(domain)
+		}
+		if err := fs.updateHostsFile(); err != nil {
+			log.Printf("❌ Error updating hosts file: %v", err)
+		}
+	}
+}
+
+// pushRuleChangesPeriodically retries the changes made while offline
+func (fs *FirebaseService) pushRuleChangesPeriodically() {
+	ticker := time.NewTicker(rulePushRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fs.pushRuleChanges()
+		case <-fs.ctx.Done():
+			return
+		}
+	}
+}
+
+// applySyncedDomain updates the local rules of a domain from the entries that
+// apply to this PC: blocked while any entry is active, disabled while entries
+// exist but none is active, removed when there is none left
+func (fs *FirebaseService) applySyncedDomain(domain string) {
+	rows, err := loadSyncedRules(fs.database, "WHERE domain = ? AND status != ?", domain, blockedUrlDeleted)
+	if err != nil {
+		log.Printf("❌ Error reading sync state of %s: %v", domain, err)
+		return
+	}
+
+	var entries, active int
+	for _, row := range rows {
+		if !fs.appliesToThisDevice(row.Devices) {
+			continue
+		}
+		entries++
+		if row.Status == blockedUrlActive {
+			active++
+		}
+	}
+
+	switch {
+	case entries == 0:
+		_, err = fs.database.Exec("DELETE FROM block_rules WHERE domain = ?", domain)
+	case active == 0:
+		_, err = fs.database.Exec("UPDATE block_rules SET is_active = 0 WHERE domain = ?", domain)
+	default:
+		var result sql.Result
+		result, err = fs.database.Exec("UPDATE block_rules SET is_active = 1 WHERE domain = ?", domain)
+		if err == nil {
+			if updated, _ := result.RowsAffected(); updated == 0 {
+				_, err = fs.database.Exec(
+					"INSERT INTO block_rules (domain, category, profile_id, reason, is_active) VALUES (?, ?, ?, ?, ?)",
+					domain, firebaseSyncCategory, 1, "Synced from Android app", true)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("❌ Error applying synced rule %s: %v", domain, err)
+	}
+}
+
+func storeSyncedRule(db *sql.DB, key, domain string, entry *BlockedUrl) error {
+	_, err := db.Exec(`INSERT INTO rule_sync (firebase_key, domain, url, status, added_at, added_by, updated_at, pending, devices)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?)
+		ON CONFLICT(firebase_key) DO UPDATE SET domain = excluded.domain, url = excluded.url, status = excluded.status,
+			added_at = excluded.added_at, added_by = excluded.added_by, updated_at = excluded.updated_at, pending = 0,
+			devices = excluded.devices`,
+		key, domain, entry.URL, entry.Status, entry.AddedAt, entry.AddedBy, entry.editedAt(), encodeDevices(entry.Devices))
+	return err
+}
+
+func loadSyncedRules(db *sql.DB, where string, args ...interface{}) (map[string]*syncedRule, error) {
+	rows, err := db.Query(`SELECT firebase_key, domain, url, status, added_at, added_by, updated_at, pending, devices
+		FROM rule_sync `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make(map[string]*syncedRule)
+	for rows.Next() {
+		var rule syncedRule
+		var url, addedBy, devices sql.NullString
+		if err := rows.Scan(&rule.Key, &rule.Domain, &url, &rule.Status, &rule.AddedAt, &addedBy, &rule.UpdatedAt, &rule.Pending, &devices); err != nil {
+			continue
+		}
+		if devices.String != "" {
+			json.Unmarshal([]byte(devices.String), &rule.Devices)
+		}
+		rule.URL = url.String
+		if rule.URL == "" {
+			rule.URL = rule.Domain
+		}
+		rule.AddedBy = addedBy.String
+		rules[rule.Key] = &rule
+	}
+	return rules, rows.Err()
+}
+
+// encodeDevices stores the targeted devices as a JSON array, NULL for every device
+func encodeDevices(devices []string) interface{} {
+	if len(devices) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(devices)
+	return string(data)
+}
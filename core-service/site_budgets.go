@@ -0,0 +1,540 @@
+// core-service/site_budgets.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mỗi báo cáo hoạt động chỉ được tính tối đa 1 giờ
+const maxActivityReport = time.Hour
+
+// Số ngày giữ lại dữ liệu hoạt động theo trang
+const siteActivityRetentionDays = 90
+
+// Key trong service_state lưu id dns_logs đã xử lý
+const dnsLogCursorKey = "site_activity_dns_last_id"
+
+// Giới hạn thời gian hàng ngày cho một trang hoặc một nhóm trang (vd "YouTube 45 phút", "Game 1 giờ")
+type SiteBudget struct {
+	ID                int64     `json:"id"`
+	Name              string    `json:"name"`
+	Category          string    `json:"category,omitempty"`
+	Domains           []string  `json:"domains"`
+	DailyLimitMinutes int       `json:"dailyLimitMinutes"`
+	Enabled           bool      `json:"enabled"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// Trạng thái sử dụng của một budget trong ngày
+type SiteBudgetStatus struct {
+	SiteBudget
+	Date             string `json:"date"`
+	UsedMinutes      int    `json:"usedMinutes"`
+	RemainingMinutes int    `json:"remainingMinutes"`
+	Exhausted        bool   `json:"exhausted"`
+}
+
+// Thời gian sử dụng của một trang trong ngày
+type SiteActivity struct {
+	Domain  string `json:"domain"`
+	Minutes int    `json:"minutes"`
+}
+
+// SiteBudgetManager theo dõi thời gian dùng từng trang (từ DNS log và báo cáo của
+// extension) và chặn các trang của budget đã dùng hết qua hosts file.
+// Hoạt động được lưu theo từng phút nên cùng một phút từ hai nguồn chỉ tính một lần.
+type SiteBudgetManager struct {
+	db           *sql.DB
+	hostsManager *HostsManager
+	mutex        sync.RWMutex
+	budgets      []SiteBudget
+	exhausted    map[int64]bool // Budget đã hết trong lần kiểm tra gần nhất
+	blocked      []string       // Domain đang bị chặn vì hết budget
+	stopChan     chan bool
+	onExhausted  func(status SiteBudgetStatus)
+}
+
+func NewSiteBudgetManager(db *sql.DB, hostsManager *HostsManager) *SiteBudgetManager {
+	sbm := &SiteBudgetManager{
+		db:           db,
+		hostsManager: hostsManager,
+		exhausted:    make(map[int64]bool),
+		stopChan:     make(chan bool),
+	}
+
+	if err := sbm.loadBudgets(); err != nil {
+		log.Printf("⚠️ Không thể load budget theo trang: %v", err)
+	}
+	return sbm
+}
+
+// Set callback khi một budget vừa dùng hết
+func (sbm *SiteBudgetManager) SetExhaustedCallback(callback func(status SiteBudgetStatus)) {
+	sbm.onExhausted = callback
+}
+
+// Load danh sách budget từ SQLite
+func (sbm *SiteBudgetManager) loadBudgets() error {
+	rows, err := sbm.db.Query("SELECT id, name, category, domains, daily_limit_minutes, enabled, created_at FROM site_budgets ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var budgets []SiteBudget
+	for rows.Next() {
+		var budget SiteBudget
+		var category sql.NullString
+		var domains string
+		if err := rows.Scan(&budget.ID, &budget.Name, &category, &domains, &budget.DailyLimitMinutes,
+			&budget.Enabled, &budget.CreatedAt); err != nil {
+			continue
+		}
+		budget.Category = category.String
+		if err := json.Unmarshal([]byte(domains), &budget.Domains); err != nil {
+			log.Printf("⚠️ Bỏ qua budget %d bị hỏng: %v", budget.ID, err)
+			continue
+		}
+		budgets = append(budgets, budget)
+	}
+
+	sbm.mutex.Lock()
+	sbm.budgets = budgets
+	sbm.mutex.Unlock()
+	return nil
+}
+
+// Chuẩn hóa và kiểm tra budget trước khi lưu
+func normalizeSiteBudget(budget *SiteBudget) error {
+	budget.Name = strings.TrimSpace(budget.Name)
+	if budget.Name == "" {
+		return fmt.Errorf("budget name is required")
+	}
+	if budget.DailyLimitMinutes < 0 || budget.DailyLimitMinutes > 1440 {
+		return fmt.Errorf("daily limit must be between 0 and 1440 minutes")
+	}
+
+	seen := make(map[string]bool)
+	var domains []string
+	for _, raw := range budget.Domains {
+		domain := normalizeDomain(raw)
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		domains = append(domains, domain)
+	}
+	if len(domains) == 0 {
+		return fmt.Errorf("at least one domain is required")
+	}
+	budget.Domains = domains
+	return nil
+}
+
+// Thêm budget mới
+func (sbm *SiteBudgetManager) AddBudget(budget SiteBudget) (*SiteBudget, error) {
+	if err := normalizeSiteBudget(&budget); err != nil {
+		return nil, err
+	}
+
+	domains, _ := json.Marshal(budget.Domains)
+	budget.CreatedAt = time.Now()
+	result, err := sbm.db.Exec("INSERT INTO site_budgets (name, category, domains, daily_limit_minutes, enabled, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		budget.Name, budget.Category, string(domains), budget.DailyLimitMinutes, budget.Enabled, budget.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	budget.ID, _ = result.LastInsertId()
+
+	sbm.mutex.Lock()
+	sbm.budgets = append(sbm.budgets, budget)
+	sbm.mutex.Unlock()
+
+	log.Printf("⏳ Thêm budget '%s': %d phút/ngày cho %v", budget.Name, budget.DailyLimitMinutes, budget.Domains)
+
+	go sbm.evaluate()
+	return &budget, nil
+}
+
+// Cập nhật budget
+func (sbm *SiteBudgetManager) UpdateBudget(budget SiteBudget) (*SiteBudget, error) {
+	if err := normalizeSiteBudget(&budget); err != nil {
+		return nil, err
+	}
+
+	domains, _ := json.Marshal(budget.Domains)
+	result, err := sbm.db.Exec("UPDATE site_budgets SET name = ?, category = ?, domains = ?, daily_limit_minutes = ?, enabled = ? WHERE id = ?",
+		budget.Name, budget.Category, string(domains), budget.DailyLimitMinutes, budget.Enabled, budget.ID)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, nil
+	}
+
+	sbm.mutex.Lock()
+	for i := range sbm.budgets {
+		if sbm.budgets[i].ID == budget.ID {
+			budget.CreatedAt = sbm.budgets[i].CreatedAt
+			sbm.budgets[i] = budget
+			break
+		}
+	}
+	sbm.mutex.Unlock()
+
+	go sbm.evaluate()
+	return &budget, nil
+}
+
+// Lấy budget theo ID (nil nếu không có)
+func (sbm *SiteBudgetManager) GetBudget(id int64) *SiteBudget {
+	sbm.mutex.RLock()
+	defer sbm.mutex.RUnlock()
+
+	for _, budget := range sbm.budgets {
+		if budget.ID == id {
+			copied := budget
+			copied.Domains = append([]string(nil), budget.Domains...)
+			return &copied
+		}
+	}
+	return nil
+}
+
+// Bản cập nhật có nới lỏng budget không: tắt budget, tăng giới hạn hoặc bỏ bớt domain
+func (b *SiteBudget) loosenedBy(update SiteBudget) bool {
+	if b.Enabled && !update.Enabled {
+		return true
+	}
+	if update.DailyLimitMinutes > b.DailyLimitMinutes {
+		return true
+	}
+
+	kept := make(map[string]bool)
+	for _, raw := range update.Domains {
+		kept[normalizeDomain(raw)] = true
+	}
+	for _, domain := range b.Domains {
+		if !kept[domain] {
+			return true
+		}
+	}
+	return false
+}
+
+// Xóa budget
+func (sbm *SiteBudgetManager) RemoveBudget(id int64) (bool, error) {
+	result, err := sbm.db.Exec("DELETE FROM site_budgets WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	sbm.mutex.Lock()
+	for i := range sbm.budgets {
+		if sbm.budgets[i].ID == id {
+			sbm.budgets = append(sbm.budgets[:i], sbm.budgets[i+1:]...)
+			break
+		}
+	}
+	delete(sbm.exhausted, id)
+	sbm.mutex.Unlock()
+
+	go sbm.evaluate()
+	return true, nil
+}
+
+// Tìm domain của budget khớp với host (host là domain đó hoặc subdomain của nó).
+// Trả về "" nếu host không thuộc budget nào.
+func (sbm *SiteBudgetManager) matchBudgetDomain(host string) string {
+	host = strings.TrimSuffix(normalizeDomain(host), ".")
+	if host == "" {
+		return ""
+	}
+
+	sbm.mutex.RLock()
+	defer sbm.mutex.RUnlock()
+
+	match := ""
+	for _, budget := range sbm.budgets {
+		for _, domain := range budget.Domains {
+			if (host == domain || strings.HasSuffix(host, "."+domain)) && len(domain) > len(match) {
+				match = domain
+			}
+		}
+	}
+	return match
+}
+
+// Ghi nhận host được sử dụng trong khoảng [start, end). Chỉ các host thuộc một
+// budget mới được lưu, theo từng phút trong ngày.
+func (sbm *SiteBudgetManager) RecordActivity(host string, start, end time.Time, source string) (bool, error) {
+	domain := sbm.matchBudgetDomain(host)
+	if domain == "" {
+		return false, nil
+	}
+
+	if end.Sub(start) > maxActivityReport {
+		start = end.Add(-maxActivityReport)
+	}
+
+	tx, err := sbm.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Luôn tính ít nhất phút chứa start
+	for minute := start.Truncate(time.Minute); ; minute = minute.Add(time.Minute) {
+		if err := insertSiteActivity(tx, domain, minute, source); err != nil {
+			return false, err
+		}
+		if !minute.Add(time.Minute).Before(end) {
+			break
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+func insertSiteActivity(tx *sql.Tx, domain string, at time.Time, source string) error {
+	at = at.Local()
+	_, err := tx.Exec("INSERT OR IGNORE INTO site_activity (usage_date, domain, minute, source) VALUES (?, ?, ?, ?)",
+		at.Format(usageDateLayout), domain, at.Hour()*60+at.Minute(), source)
+	return err
+}
+
+// Đọc các truy vấn DNS mới từ dns_logs và ghi nhận phút hoạt động tương ứng.
+// Truy vấn bị chặn không được tính.
+func (sbm *SiteBudgetManager) ingestDNSLogs() error {
+	var cursor int64
+	var value string
+	err := sbm.db.QueryRow("SELECT value FROM service_state WHERE key = ?", dnsLogCursorKey).Scan(&value)
+	switch {
+	case err == sql.ErrNoRows:
+		// Lần chạy đầu tiên: bắt đầu từ các truy vấn mới
+		if err := sbm.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM dns_logs").Scan(&cursor); err != nil {
+			return err
+		}
+		return sbm.saveDNSLogCursor(cursor)
+	case err != nil:
+		return err
+	}
+	cursor, _ = strconv.ParseInt(value, 10, 64)
+
+	rows, err := sbm.db.Query("SELECT id, domain, timestamp FROM dns_logs WHERE id > ? AND COALESCE(action, '') != 'blocked' ORDER BY id LIMIT 5000", cursor)
+	if err != nil {
+		return err
+	}
+
+	type dnsQuery struct {
+		domain string
+		at     time.Time
+	}
+	var queries []dnsQuery
+	for rows.Next() {
+		var query dnsQuery
+		if err := rows.Scan(&cursor, &query.domain, &query.at); err != nil {
+			continue
+		}
+		queries = append(queries, query)
+	}
+	rows.Close()
+
+	if len(queries) == 0 {
+		return nil
+	}
+
+	tx, err := sbm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range queries {
+		if domain := sbm.matchBudgetDomain(query.domain); domain != "" {
+			if err := insertSiteActivity(tx, domain, query.at, "dns"); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return sbm.saveDNSLogCursor(cursor)
+}
+
+func (sbm *SiteBudgetManager) saveDNSLogCursor(cursor int64) error {
+	_, err := sbm.db.Exec(`INSERT INTO service_state (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		dnsLogCursorKey, strconv.FormatInt(cursor, 10))
+	return err
+}
+
+// Số phút đã dùng của các domain trong ngày (các domain cùng phút chỉ tính một lần)
+func (sbm *SiteBudgetManager) usedMinutes(domains []string, date string) (int, error) {
+	if len(domains) == 0 {
+		return 0, nil
+	}
+
+	args := []interface{}{date}
+	for _, domain := range domains {
+		args = append(args, domain)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(domains)), ",")
+
+	var used int
+	err := sbm.db.QueryRow("SELECT COUNT(DISTINCT minute) FROM site_activity WHERE usage_date = ? AND domain IN ("+placeholders+")", args...).Scan(&used)
+	return used, err
+}
+
+// Lấy trạng thái của tất cả budget trong ngày date
+func (sbm *SiteBudgetManager) GetBudgetStatuses(date string) ([]SiteBudgetStatus, error) {
+	sbm.mutex.RLock()
+	budgets := make([]SiteBudget, len(sbm.budgets))
+	copy(budgets, sbm.budgets)
+	sbm.mutex.RUnlock()
+
+	statuses := []SiteBudgetStatus{}
+	for _, budget := range budgets {
+		used, err := sbm.usedMinutes(budget.Domains, date)
+		if err != nil {
+			return nil, err
+		}
+
+		status := SiteBudgetStatus{SiteBudget: budget, Date: date, UsedMinutes: used}
+		if budget.Enabled {
+			status.RemainingMinutes = budget.DailyLimitMinutes - used
+			if status.RemainingMinutes < 0 {
+				status.RemainingMinutes = 0
+			}
+			status.Exhausted = used >= budget.DailyLimitMinutes
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Lấy thời gian sử dụng theo từng trang trong ngày
+func (sbm *SiteBudgetManager) GetSiteActivity(date string) ([]SiteActivity, error) {
+	rows, err := sbm.db.Query("SELECT domain, COUNT(*) FROM site_activity WHERE usage_date = ? GROUP BY domain", date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := []SiteActivity{}
+	for rows.Next() {
+		var site SiteActivity
+		if err := rows.Scan(&site.Domain, &site.Minutes); err != nil {
+			continue
+		}
+		activity = append(activity, site)
+	}
+
+	sort.Slice(activity, func(i, j int) bool { return activity[i].Minutes > activity[j].Minutes })
+	return activity, nil
+}
+
+// Kiểm tra các budget hôm nay và cập nhật danh sách domain bị chặn trong hosts file
+func (sbm *SiteBudgetManager) evaluate() {
+	statuses, err := sbm.GetBudgetStatuses(time.Now().Format(usageDateLayout))
+	if err != nil {
+		log.Printf("⚠️ Không thể kiểm tra budget theo trang: %v", err)
+		return
+	}
+
+	exhausted := make(map[int64]bool)
+	seen := make(map[string]bool)
+	var blocked []string
+	var newlyExhausted []SiteBudgetStatus
+
+	sbm.mutex.Lock()
+	for _, status := range statuses {
+		if !status.Exhausted {
+			continue
+		}
+		exhausted[status.ID] = true
+		if !sbm.exhausted[status.ID] {
+			newlyExhausted = append(newlyExhausted, status)
+		}
+		for _, domain := range status.Domains {
+			if !seen[domain] {
+				seen[domain] = true
+				blocked = append(blocked, domain)
+			}
+		}
+	}
+	sort.Strings(blocked)
+
+	changed := strings.Join(blocked, ",") != strings.Join(sbm.blocked, ",")
+	sbm.exhausted = exhausted
+	sbm.blocked = blocked
+	sbm.mutex.Unlock()
+
+	if changed {
+		log.Printf("⏳ Domain bị chặn vì hết budget: %v", blocked)
+		if err := sbm.hostsManager.SetBudgetBlockedDomains(blocked); err != nil {
+			log.Printf("⚠️ Không thể cập nhật hosts file cho budget: %v", err)
+		}
+	}
+
+	for _, status := range newlyExhausted {
+		log.Printf("⏳ Budget '%s' đã dùng hết %d phút", status.Name, status.DailyLimitMinutes)
+		if sbm.onExhausted != nil {
+			go sbm.onExhausted(status)
+		}
+	}
+}
+
+// Xóa dữ liệu hoạt động cũ
+func (sbm *SiteBudgetManager) pruneActivity() {
+	cutoff := time.Now().AddDate(0, 0, -siteActivityRetentionDays).Format(usageDateLayout)
+	if _, err := sbm.db.Exec("DELETE FROM site_activity WHERE usage_date < ?", cutoff); err != nil {
+		log.Printf("⚠️ Không thể xóa hoạt động cũ: %v", err)
+	}
+}
+
+// Bắt đầu theo dõi (mỗi phút đọc DNS log và kiểm tra budget)
+func (sbm *SiteBudgetManager) Start() {
+	log.Println("⏳ Bắt đầu theo dõi budget theo trang")
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	sbm.pruneActivity()
+	sbm.evaluate()
+
+	lastPrune := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			if err := sbm.ingestDNSLogs(); err != nil {
+				log.Printf("⚠️ Không thể đọc DNS log: %v", err)
+			}
+			sbm.evaluate()
+
+			if time.Since(lastPrune) > 24*time.Hour {
+				sbm.pruneActivity()
+				lastPrune = time.Now()
+			}
+		case <-sbm.stopChan:
+			return
+		}
+	}
+}
+
+// Dừng theo dõi
+func (sbm *SiteBudgetManager) Stop() {
+	close(sbm.stopChan)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// SyncBackend is the cloud store the PC syncs with: blocked URLs and time rules
+// are read and followed, PC status and usage are written. Paths are slash
+// separated locations in one JSON tree, as in the Realtime Database.
+type SyncBackend interface {
+	Name() string
+	// Get reads the value at path into v (JSON null when there is none)
+	Get(ctx context.Context, path string, v interface{}) error
+	// Set replaces the value at path with v
+	Set(ctx context.Context, path string, v interface{}) error
+	// Listen passes the value at path to onChange, then again after every
+	// change, until listening fails or ctx is done. It always returns a non-nil error.
+	Listen(ctx context.Context, path string, onChange func(data json.RawMessage)) error
+}
+
+var errFakeBackendDown = errors.New("fake backend is offline")
+
+// FakeSyncBackend keeps the tree in memory, used to run the sync pipeline offline
+type FakeSyncBackend struct {
+	mutex     sync.Mutex
+	tree      interface{}
+	listeners map[*fakeListener]bool
+	err       error
+}
+
+type fakeListener struct {
+	path    []string
+	changed chan struct{} // Signaled when the value at path may have changed
+}
+
+func NewFakeSyncBackend() *FakeSyncBackend {
+	return &FakeSyncBackend{listeners: make(map[*fakeListener]bool)}
+}
+
+func (f *FakeSyncBackend) Name() string {
+	return "fake"
+}
+
+func (f *FakeSyncBackend) Get(ctx context.Context, path string, v interface{}) error {
+	f.mutex.Lock()
+	if f.err != nil {
+		f.mutex.Unlock()
+		return f.err
+	}
+	data, err := f.valueLocked(splitTreePath(path))
+	f.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (f *FakeSyncBackend) Set(ctx context.Context, path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+
+	segments := splitTreePath(path)
+	f.tree = setTreeValue(f.tree, segments, value)
+	for listener := range f.listeners {
+		if overlappingPaths(listener.path, segments) {
+			listener.notify()
+		}
+	}
+	return nil
+}
+
+func (f *FakeSyncBackend) Listen(ctx context.Context, path string, onChange func(data json.RawMessage)) error {
+	listener := &fakeListener{path: splitTreePath(path), changed: make(chan struct{}, 1)}
+	listener.notify()
+
+	f.mutex.Lock()
+	if f.err != nil {
+		f.mutex.Unlock()
+		return f.err
+	}
+	f.listeners[listener] = true
+	f.mutex.Unlock()
+
+	defer func() {
+		f.mutex.Lock()
+		delete(f.listeners, listener)
+		f.mutex.Unlock()
+	}()
+
+	for {
+		select {
+		case <-listener.changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		f.mutex.Lock()
+		if f.err != nil {
+			f.mutex.Unlock()
+			return f.err
+		}
+		data, err := f.valueLocked(listener.path)
+		f.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+		onChange(data)
+	}
+}
+
+// SetOffline simulates a lost connection: calls fail and listeners stop until it is cleared
+func (f *FakeSyncBackend) SetOffline(offline bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !offline {
+		f.err = nil
+		return
+	}
+	f.err = errFakeBackendDown
+	for listener := range f.listeners {
+		listener.notify()
+	}
+}
+
+func (f *FakeSyncBackend) valueLocked(path []string) (json.RawMessage, error) {
+	node := f.tree
+	for _, segment := range path {
+		children, ok := node.(map[string]interface{})
+		if !ok {
+			node = nil
+			break
+		}
+		node = children[segment]
+	}
+	return json.Marshal(node)
+}
+
+func (l *fakeListener) notify() {
+	select {
+	case l.changed <- struct{}{}:
+	default:
+	}
+}
+
+// overlappingPaths reports whether a write at one path can change the value at the other
+func overlappingPaths(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,246 @@
+// core-service/time_allowlist.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Chu kỳ phân giải lại domain được phép (IP của CDN/LMS thay đổi theo thời gian)
+const allowListRefreshInterval = 10 * time.Minute
+
+// Profile mặc định (bảng profiles luôn có profile id 1)
+const defaultProfileID = 1
+
+// Đích luôn được phép truy cập khi bị chặn mạng (cổng bài tập, LMS của trường,
+// captive portal...). ProfileID = 0 áp dụng cho mọi profile.
+type BlockAllowList struct {
+	ProfileID int      `json:"profileId"`
+	Domains   []string `json:"domains,omitempty"`
+	CIDRs     []string `json:"cidrs,omitempty"` // IP hoặc dải CIDR, vd 192.168.1.1, 10.20.0.0/16
+}
+
+// Trạng thái các đích được phép của profile đang dùng
+type AllowedDestinationsState struct {
+	ProfileID   int                 `json:"profileId"`
+	Domains     map[string][]string `json:"domains"` // domain → IP đã phân giải
+	CIDRs       []string            `json:"cidrs"`
+	RefreshedAt time.Time           `json:"refreshedAt,omitempty"`
+}
+
+// Đọc IP hoặc dải CIDR; IP đơn được coi là /32 (IPv4) hoặc /128 (IPv6)
+func parseAllowedCIDR(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR '%s'", value)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address '%s'", value)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Chọn profile mà danh sách đích được phép áp dụng
+func (tm *TimeManager) SetActiveProfile(profileID int) {
+	tm.mutex.Lock()
+	tm.profileID = profileID
+	tm.allowedRefreshedAt = time.Time{}
+	tm.mutex.Unlock()
+
+	go tm.checkTimeRules()
+}
+
+// Gộp danh sách chung (ProfileID 0) và danh sách của profile đang dùng (yêu cầu đã giữ mutex)
+func (tm *TimeManager) activeAllowListLocked() BlockAllowList {
+	merged := BlockAllowList{ProfileID: tm.profileID}
+	if tm.rules == nil {
+		return merged
+	}
+
+	seen := make(map[string]bool)
+	for _, list := range tm.rules.AllowedDuringBlock {
+		if list.ProfileID != 0 && list.ProfileID != tm.profileID {
+			continue
+		}
+		for _, domain := range list.Domains {
+			if !seen["d:"+domain] {
+				seen["d:"+domain] = true
+				merged.Domains = append(merged.Domains, domain)
+			}
+		}
+		for _, cidr := range list.CIDRs {
+			if !seen["c:"+cidr] {
+				seen["c:"+cidr] = true
+				merged.CIDRs = append(merged.CIDRs, cidr)
+			}
+		}
+	}
+	return merged
+}
+
+// Bắt đầu phân giải lại danh sách đích được phép nếu đã tới hạn
+func (tm *TimeManager) scheduleAllowListRefresh(now time.Time) {
+	tm.mutex.Lock()
+	due := tm.allowedRefreshedAt.IsZero() || now.Sub(tm.allowedRefreshedAt) >= allowListRefreshInterval
+	if tm.allowListRefreshing || !due {
+		tm.mutex.Unlock()
+		return
+	}
+	tm.allowListRefreshing = true
+	tm.mutex.Unlock()
+
+	go tm.refreshAllowedDestinations()
+}
+
+// Phân giải các domain được phép thành IP. Nếu danh sách thay đổi trong lúc đang
+// chặn mạng thì rule chặn được áp dụng lại với danh sách mới.
+func (tm *TimeManager) refreshAllowedDestinations() {
+	tm.mutex.RLock()
+	allowList := tm.activeAllowListLocked()
+	previous := tm.allowedResolved
+	lookup := tm.lookupIP
+	domains := append([]string{}, tm.serviceHosts...)
+	tm.mutex.RUnlock()
+
+	var prefixes []netip.Prefix
+	for _, cidr := range allowList.CIDRs {
+		prefix, err := parseAllowedCIDR(cidr)
+		if err != nil {
+			log.Printf("⚠️ Bỏ qua đích được phép: %v", err)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	// Ngoài domain của profile, Firebase và Google API luôn được phép để service
+	// vẫn đồng bộ, nhận lệnh của phụ huynh và xác thực phụ huynh trong lúc chặn mạng
+	domains = append(domains, allowList.Domains...)
+
+	resolved := make(map[string][]string)
+	for _, domain := range domains {
+		ips := resolveAllowedDomain(lookup, domain)
+		if len(ips) == 0 {
+			// Lỗi DNS tạm thời: giữ IP của lần phân giải trước
+			ips = previous[domain]
+			log.Printf("⚠️ Không phân giải được %s, giữ %d IP cũ", domain, len(ips))
+		}
+		resolved[domain] = ips
+		for _, ip := range ips {
+			if addr, err := netip.ParseAddr(ip); err == nil {
+				prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			}
+		}
+	}
+	prefixes = uniquePrefixes(prefixes)
+
+	tm.mutex.Lock()
+	changed := !equalPrefixes(prefixes, tm.allowedPrefixes)
+	tm.allowedPrefixes = prefixes
+	tm.allowedResolved = resolved
+	tm.allowedRefreshedAt = time.Now()
+	tm.allowListRefreshing = false
+	blocked := tm.isBlocked
+	tm.mutex.Unlock()
+
+	if changed {
+		log.Printf("🌐 Đích được phép khi chặn mạng: %d domain, %d địa chỉ", len(resolved), len(prefixes))
+		if blocked {
+			tm.blockNetwork()
+		}
+	}
+}
+
+// Phân giải domain và www.domain, bỏ qua địa chỉ loopback (domain bị chặn trong hosts file)
+func resolveAllowedDomain(lookup func(host string) ([]net.IP, error), domain string) []string {
+	seen := make(map[string]bool)
+	var ips []string
+	for _, host := range []string{domain, "www." + domain} {
+		addrs, err := lookup(host)
+		if err != nil {
+			continue
+		}
+		for _, ip := range addrs {
+			addr, ok := netip.AddrFromSlice(ip)
+			if !ok {
+				continue
+			}
+			addr = addr.Unmap()
+			if addr.IsLoopback() || addr.IsUnspecified() || seen[addr.String()] {
+				continue
+			}
+			seen[addr.String()] = true
+			ips = append(ips, addr.String())
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func uniquePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sort.Slice(prefixes, func(i, j int) bool {
+		if prefixes[i].Addr() != prefixes[j].Addr() {
+			return prefixes[i].Addr().Less(prefixes[j].Addr())
+		}
+		return prefixes[i].Bits() < prefixes[j].Bits()
+	})
+
+	var unique []netip.Prefix
+	for _, prefix := range prefixes {
+		if len(unique) == 0 || unique[len(unique)-1] != prefix {
+			unique = append(unique, prefix)
+		}
+	}
+	return unique
+}
+
+func equalPrefixes(a, b []netip.Prefix) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Trạng thái đích được phép (yêu cầu đã giữ mutex)
+func (tm *TimeManager) allowedDestinationsLocked() AllowedDestinationsState {
+	allowList := tm.activeAllowListLocked()
+	state := AllowedDestinationsState{
+		ProfileID:   tm.profileID,
+		Domains:     make(map[string][]string),
+		CIDRs:       allowList.CIDRs,
+		RefreshedAt: tm.allowedRefreshedAt,
+	}
+	if state.CIDRs == nil {
+		state.CIDRs = []string{}
+	}
+	for _, domain := range allowList.Domains {
+		state.Domains[domain] = tm.allowedResolved[domain]
+	}
+	return state
+}
+
+// Lấy trạng thái đích được phép khi bị chặn mạng
+func (tm *TimeManager) GetAllowedDestinations() AllowedDestinationsState {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return tm.allowedDestinationsLocked()
+}
@@ -0,0 +1,98 @@
+// core-service/time_family.go
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Giới hạn hàng ngày được tính trên tổng usage của trẻ trên mọi thiết bị trong
+// gia đình: usage của máy này cộng với usage mới nhất nhận được của các máy khác.
+// Khi mất kết nối, usage của các máy khác giữ nguyên giá trị cuối cùng (ước lượng
+// cục bộ) và được cập nhật lại khi có kết nối.
+
+// Key trong service_state lưu usage của các thiết bị khác, để giữ ước lượng khi
+// khởi động lại lúc không có mạng
+const otherDevicesUsageKey = "family_usage_other_devices"
+
+// Cập nhật tổng usage của các thiết bị khác trong ngày date (YYYY-MM-DD).
+// Trả về true nếu giá trị thay đổi.
+func (tm *TimeManager) SetOtherDevicesUsage(date string, minutes int64) bool {
+	if minutes < 0 {
+		minutes = 0
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if tm.otherDevicesUsage == nil {
+		tm.otherDevicesUsage = make(map[string]int64)
+	}
+	if previous, exists := tm.otherDevicesUsage[date]; exists && previous == minutes {
+		return false
+	}
+	tm.otherDevicesUsage[date] = minutes
+
+	// Chỉ giữ hôm qua và hôm nay
+	oldest := startOfDay(time.Now()).AddDate(0, 0, -1).Format(usageDateLayout)
+	for day := range tm.otherDevicesUsage {
+		if day < oldest {
+			delete(tm.otherDevicesUsage, day)
+		}
+	}
+
+	tm.saveOtherDevicesUsageLocked()
+	return true
+}
+
+// Usage của các thiết bị khác trong ngày (yêu cầu đã giữ mutex)
+func (tm *TimeManager) otherDevicesUsageLocked(date string) int64 {
+	return tm.otherDevicesUsage[date]
+}
+
+// Tổng usage hôm nay trên mọi thiết bị, gồm cả session đang chạy (yêu cầu đã giữ mutex)
+func (tm *TimeManager) familyUsageLocked(now time.Time) int64 {
+	return tm.liveUsageLocked(now) + tm.otherDevicesUsageLocked(now.Format(usageDateLayout))
+}
+
+// Tổng usage hôm nay trên mọi thiết bị, gồm cả session đang chạy
+func (tm *TimeManager) getFamilyTodayUsage() int64 {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return tm.familyUsageLocked(time.Now())
+}
+
+// Ghi usage của các thiết bị khác vào service_state (yêu cầu đã giữ mutex)
+func (tm *TimeManager) saveOtherDevicesUsageLocked() {
+	if tm.db == nil {
+		return
+	}
+	data, err := json.Marshal(tm.otherDevicesUsage)
+	if err != nil {
+		return
+	}
+	_, err = tm.db.Exec(`INSERT INTO service_state (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		otherDevicesUsageKey, string(data))
+	if err != nil {
+		log.Printf("⚠️ Không thể lưu usage của các thiết bị khác: %v", err)
+	}
+}
+
+// Nạp usage của các thiết bị khác đã lưu (ước lượng khi chưa có kết nối)
+func (tm *TimeManager) loadOtherDevicesUsage() {
+	tm.otherDevicesUsage = make(map[string]int64)
+	if tm.db == nil {
+		return
+	}
+
+	var value string
+	if err := tm.db.QueryRow("SELECT value FROM service_state WHERE key = ?", otherDevicesUsageKey).Scan(&value); err != nil {
+		return
+	}
+	if err := json.Unmarshal([]byte(value), &tm.otherDevicesUsage); err != nil {
+		log.Printf("⚠️ Usage của các thiết bị khác bị hỏng, bỏ qua: %v", err)
+		tm.otherDevicesUsage = make(map[string]int64)
+	}
+}
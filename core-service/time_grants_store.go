@@ -0,0 +1,152 @@
+// core-service/time_grants_store.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Thời gian thưởng được lưu trong bảng time_grants; tm.grants là cache trong bộ nhớ.
+// Mỗi thay đổi được ghi ngay vào SQLite nên không mất grants khi service bị kill giữa chừng.
+
+// sqlExecer là phần chung của *sql.DB và *sql.Tx dùng khi ghi grants
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Ghi (hoặc thay) một grant
+func storeGrant(exec sqlExecer, grant *TimeGrant) error {
+	_, err := exec.Exec(`INSERT INTO time_grants (id, grant_date, minutes, reason, granted_by, created_at, source)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET grant_date = excluded.grant_date, minutes = excluded.minutes,
+			reason = excluded.reason, granted_by = excluded.granted_by, created_at = excluded.created_at, source = excluded.source`,
+		grant.ID, grant.Date, grant.Minutes, grant.Reason, grant.GrantedBy, grant.CreatedAt, grant.Source)
+	return err
+}
+
+// Ghi một grant mới
+func (tm *TimeManager) insertGrant(grant *TimeGrant) error {
+	if tm.db == nil {
+		return nil
+	}
+	return storeGrant(tm.db, grant)
+}
+
+// Xóa một grant
+func (tm *TimeManager) deleteGrant(id string) error {
+	if tm.db == nil {
+		return nil
+	}
+	_, err := tm.db.Exec("DELETE FROM time_grants WHERE id = ?", id)
+	return err
+}
+
+// Thay toàn bộ grants đến từ Firebase trong một transaction, giữ grants tạo trên PC
+func (tm *TimeManager) replaceRemoteGrants(remote []*TimeGrant) error {
+	if tm.db == nil {
+		return nil
+	}
+
+	tx, err := tm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM time_grants WHERE source = ?", "firebase"); err != nil {
+		return err
+	}
+	for _, grant := range remote {
+		if err := storeGrant(tx, grant); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Nạp grants từ SQLite (nhập file JSON cũ trước nếu còn)
+func (tm *TimeManager) loadGrants() error {
+	if tm.db == nil {
+		return nil
+	}
+	if err := tm.importLegacyGrantsFile(); err != nil {
+		log.Printf("⚠️ Không thể nhập grants cũ: %v", err)
+	}
+
+	rows, err := tm.db.Query("SELECT id, grant_date, minutes, reason, granted_by, created_at, source FROM time_grants")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	grants := make(map[string]*TimeGrant)
+	for rows.Next() {
+		var grant TimeGrant
+		var reason, grantedBy sql.NullString
+		if err := rows.Scan(&grant.ID, &grant.Date, &grant.Minutes, &reason, &grantedBy, &grant.CreatedAt, &grant.Source); err != nil {
+			continue
+		}
+		grant.Reason = reason.String
+		grant.GrantedBy = grantedBy.String
+		grants[grant.ID] = &grant
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tm.mutex.Lock()
+	tm.grants = grants
+	tm.mutex.Unlock()
+	return nil
+}
+
+// Nhập grants từ file JSON cũ (time_grants.json) vào SQLite.
+// Sau khi nhập, file được đổi tên thành *.imported để không nhập lại.
+func (tm *TimeManager) importLegacyGrantsFile() error {
+	data, err := os.ReadFile(tm.grantsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var legacy map[string]*TimeGrant
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return fmt.Errorf("invalid legacy grants file: %v", err)
+	}
+
+	tx, err := tm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	imported := 0
+	for id, grant := range legacy {
+		if grant == nil {
+			continue
+		}
+		grant.ID = id
+		if grant.Source == "" {
+			grant.Source = "local"
+		}
+		// Không ghi đè grant đã có trong SQLite
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO time_grants (id, grant_date, minutes, reason, granted_by, created_at, source)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			grant.ID, grant.Date, grant.Minutes, grant.Reason, grant.GrantedBy, grant.CreatedAt, grant.Source); err != nil {
+			return err
+		}
+		imported++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("📦 Đã nhập %d grants từ %s vào SQLite", imported, tm.grantsFile)
+	return os.Rename(tm.grantsFile, tm.grantsFile+".imported")
+}
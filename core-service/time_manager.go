@@ -2,12 +2,12 @@
 package main
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"net"
+	"net/netip"
 	"sync"
 	"time"
 )
@@ -24,34 +24,78 @@ type DayRule struct {
 	BreakIntervalMinutes int        `json:"breakIntervalMinutes"`
 	BreakDurationMinutes int        `json:"breakDurationMinutes"`
 	AllowedSlots         []TimeSlot `json:"allowedSlots"`
+	BlockedSlots         []TimeSlot `json:"blockedSlots"` // Khung giờ bị chặn (vd giờ đi ngủ 21:30–06:30)
 }
 
 type TimeRules struct {
-	Weekdays DayRule `json:"weekdays"`
-	Weekends DayRule `json:"weekends"`
+	Weekdays       DayRule `json:"weekdays"`
+	Weekends       DayRule `json:"weekends"`
+	WarningMinutes []int   `json:"warningMinutes,omitempty"` // Các mốc cảnh báo trước khi chặn (mặc định 10, 5, 1)
+
+	// Số phút không thao tác trước khi tạm dừng tính giờ (0 = mặc định 5 phút)
+	IdleThresholdMinutes int `json:"idleThresholdMinutes,omitempty"`
+
+	// Xử lý khi đồng hồ hệ thống bị chỉnh: ignore | block | alert (mặc định alert)
+	ClockTamperPolicy string `json:"clockTamperPolicy,omitempty"`
+
+	// Đích vẫn truy cập được khi bị chặn mạng, theo profile
+	AllowedDuringBlock []BlockAllowList `json:"allowedDuringBlock,omitempty"`
 }
 
 // Usage tracking struct
 type UsageSession struct {
-	StartTime time.Time `json:"start_time"`
-	EndTime   time.Time `json:"end_time"`
-	Duration  int64     `json:"duration_minutes"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	Duration    int64     `json:"duration_minutes"` // Thời gian thực sự sử dụng (đã trừ idle)
+	IdleMinutes int64     `json:"idle_minutes,omitempty"`
+	IdleGaps    []IdleGap `json:"idle_gaps,omitempty"`
 }
 
 type DailyUsage struct {
-	Date     string         `json:"date"`
-	Sessions []UsageSession `json:"sessions"`
-	Total    int64          `json:"total_minutes"`
+	Date        string         `json:"date"`
+	Sessions    []UsageSession `json:"sessions"`
+	Total       int64          `json:"total_minutes"`
+	Adjustments int64          `json:"adjustment_minutes,omitempty"` // Điều chỉnh thủ công (đã gồm trong Total)
+}
+
+// Tổng hợp usage theo tuần hoặc tháng
+type UsageSummary struct {
+	Period       string  `json:"period"` // "2006-W01" hoặc "2006-01"
+	StartDate    string  `json:"start_date"`
+	EndDate      string  `json:"end_date"`
+	Total        int64   `json:"total_minutes"`
+	Days         int     `json:"days"`
+	ActiveDays   int     `json:"active_days"`
+	AverageDaily float64 `json:"average_daily_minutes"`
 }
 
+// Thời gian thưởng thêm cho một ngày (vd "+30 phút hôm nay")
+type TimeGrant struct {
+	ID        string `json:"id"`
+	Date      string `json:"date"` // YYYY-MM-DD
+	Minutes   int    `json:"minutes"`
+	Reason    string `json:"reason"`
+	GrantedBy string `json:"grantedBy"`
+	CreatedAt int64  `json:"createdAt"`
+	Source    string `json:"source"` // "local", "firebase" hoặc "command" (lệnh từ ứng dụng phụ huynh)
+}
+
+// Định dạng ngày dùng làm key cho dailyUsage
+const usageDateLayout = "2006-01-02"
+
 // --- TimeManager để quản lý trạng thái ---
 type TimeManager struct {
 	rules            *TimeRules
+	rulesRecord      *StoredTimeRules // Phiên bản và nguồn của rules đang dùng
+	rulesStoreMutex  sync.Mutex
 	isBlocked        bool
 	isBreakTime      bool
 	sessionStartTime time.Time
 	lastBreakTime    time.Time
 	dailyUsage       map[string]*DailyUsage // key: YYYY-MM-DD
+	grants           map[string]*TimeGrant  // key: grant ID
+	overrides        []TimeRuleOverride     // Ngoại lệ theo ngày, ưu tiên hơn quy tắc tuần
+	manualOverride   *ManualOverride        // Phụ huynh chặn/cho phép thủ công có thời hạn
 	mutex            sync.RWMutex
 	stopChan         chan bool
 	ticker           *time.Ticker
@@ -59,201 +103,565 @@ type TimeManager struct {
 	// Callback để thông báo status change
 	onStatusChange func(blocked bool, reason string)
 
-	// File paths for persistence
+	// Callback và trạng thái cảnh báo trước khi chặn
+	onWarning      func(event TimeEvent, leadMinutes int)
+	warnedEventKey string
+	warnedLeads    map[int]bool
+
+	// Phát hiện máy không được sử dụng
+	idleSource      IdleSource
+	idleSince       time.Time // Khác zero khi đang idle
+	idleGaps        []IdleGap // Các khoảng idle đã kết thúc của session hiện tại
+	idleErrorLogged bool
+
+	// Phát hiện chỉnh đồng hồ hệ thống
+	clockAnchor        time.Time // Giá trị time.Now() (có monotonic) làm mốc
+	clockAnchorWall    time.Time // Thời gian thực được tin cậy tại mốc
+	clockAnchorIsFloor bool      // Mốc chỉ là giới hạn dưới (sau khi khởi động)
+	clockOffset        time.Duration
+	clockTampered      bool
+	clockTamperSince   time.Time
+	onClockTamper      func(event ClockTamperEvent)
+
+	// Backend chặn mạng (Windows Firewall, nftables...)
+	networkEnforcer       NetworkEnforcer
+	networkErrorLogged    bool
+	persistentEnforcement bool // Giữ rule chặn khi service dừng
+	protectionDisabled    bool // Phụ huynh đã tắt bảo vệ
+
+	// Đích được phép khi bị chặn mạng (đã phân giải thành IP)
+	profileID           int
+	allowedPrefixes     []netip.Prefix
+	allowedResolved     map[string][]string // domain → IP
+	allowedRefreshedAt  time.Time
+	allowListRefreshing bool
+	lookupIP            func(host string) ([]net.IP, error)
+	serviceHosts        []string // Firebase và Google API, luôn được phép
+
+	// Phát hiện máy ngủ/thức (suspend, hibernate, resume)
+	powerSource PowerEventSource
+	lastTickAt  time.Time // Lần kiểm tra gần nhất (có monotonic)
+	suspendedAt time.Time // Khác zero khi đã nhận sự kiện suspend
+
+	// Usage và grants được lưu trong SQLite; usageDataFile, grantsFile là các file JSON cũ cần nhập một lần
+	db            *sql.DB
 	usageDataFile string
-}
+	grantsFile    string
 
-// Firewall rule name constant
-const FIREWALL_RULE_NAME = "KidSafe Time Block"
+	// Usage của các thiết bị khác cùng trẻ trong gia đình, key: YYYY-MM-DD
+	otherDevicesUsage map[string]int64
+}
 
-func NewTimeManager() *TimeManager {
+func NewTimeManager(db *sql.DB) *TimeManager {
 	tm := &TimeManager{
-		dailyUsage:    make(map[string]*DailyUsage),
-		stopChan:      make(chan bool),
-		usageDataFile: "./data/time_usage.json",
+		dailyUsage:      make(map[string]*DailyUsage),
+		grants:          make(map[string]*TimeGrant),
+		stopChan:        make(chan bool),
+		db:              db,
+		usageDataFile:   "./data/time_usage.json",
+		grantsFile:      "./data/time_grants.json",
+		idleSource:      newPlatformIdleSource(),
+		powerSource:     newPlatformPowerEventSource(),
+		networkEnforcer: newPlatformNetworkEnforcer(),
+		profileID:       defaultProfileID,
+		lookupIP:        net.LookupIP,
+		serviceHosts:    serviceHosts(),
 	}
 
 	// Load existing usage data
-	tm.loadUsageData()
+	if err := tm.loadUsageData(); err != nil {
+		log.Printf("⚠️ Không thể khôi phục session dang dở: %v", err)
+	}
+	tm.loadOtherDevicesUsage()
+	if err := tm.loadGrants(); err != nil {
+		log.Printf("⚠️ Không thể load grants: %v", err)
+	}
+	if err := tm.loadOverrides(); err != nil {
+		log.Printf("⚠️ Không thể load ngoại lệ lịch: %v", err)
+	}
+	if err := tm.loadManualOverride(); err != nil {
+		log.Printf("⚠️ Không thể load can thiệp thủ công: %v", err)
+	}
 	return tm
 }
 
-// --- Windows Firewall Functions ---
+// --- Usage Tracking Functions ---
+
+// Nạp dữ liệu usage: nhập file JSON cũ (nếu có) vào SQLite, nạp cache các ngày
+// gần đây, sau đó khôi phục session còn dang dở (nếu lần chạy trước bị crash hoặc bị kill)
+func (tm *TimeManager) loadUsageData() error {
+	if err := tm.importLegacyUsageFile(); err != nil {
+		log.Printf("⚠️ Không thể nhập dữ liệu usage cũ: %v", err)
+	}
+
+	tm.loadRecentUsage()
+	return tm.recoverSession()
+}
 
-// Chặn mạng bằng cách thêm firewall rule
-func (tm *TimeManager) blockNetwork() error {
-	log.Println("🚫 Chặn truy cập internet...")
+// Checkpoint của session đang chạy, ghi định kỳ để không mất usage khi crash
+type sessionCheckpoint struct {
+	StartTime      time.Time `json:"start_time"`
+	LastCheckpoint time.Time `json:"last_checkpoint"`
+	IdleSince      time.Time `json:"idle_since,omitempty"`
+	IdleGaps       []IdleGap `json:"idle_gaps,omitempty"`
+}
 
-	// Xóa rule cũ trước (nếu có)
-	tm.unblockNetwork()
+// Số lần thử đọc checkpoint khi DB tạm thời lỗi (vd database is locked)
+const (
+	checkpointReadAttempts = 3
+	checkpointRetryDelay   = 500 * time.Millisecond
+)
 
-	// Thêm rule chặn HTTP (port 80)
-	cmd1 := exec.Command("netsh", "advfirewall", "firewall", "add", "rule",
-		"name="+FIREWALL_RULE_NAME+" HTTP",
-		"dir=out",
-		"action=block",
-		"protocol=TCP",
-		"localport=80")
+// Khôi phục session từ checkpoint: session được đóng tại thời điểm checkpoint cuối cùng
+func (tm *TimeManager) recoverSession() error {
+	checkpoint, err := tm.loadSessionCheckpoint()
+	for attempt := 1; err != nil && !errors.Is(err, errCorruptCheckpoint) && attempt < checkpointReadAttempts; attempt++ {
+		time.Sleep(checkpointRetryDelay)
+		checkpoint, err = tm.loadSessionCheckpoint()
+	}
+	if errors.Is(err, errCorruptCheckpoint) {
+		log.Printf("⚠️ Checkpoint session bị hỏng, bỏ qua: %v", err)
+		tm.clearSessionCheckpoint()
+		return nil
+	}
+	if err != nil {
+		// Lỗi DB: giữ nguyên checkpoint để lần khởi động sau khôi phục
+		return fmt.Errorf("failed to read session checkpoint: %v", err)
+	}
+	if checkpoint == nil {
+		return nil
+	}
 
-	if err := cmd1.Run(); err != nil {
-		log.Printf("❌ Lỗi khi chặn HTTP: %v", err)
-		return err
+	end := checkpoint.LastCheckpoint
+	if now := time.Now(); end.After(now) {
+		end = now
 	}
 
-	// Thêm rule chặn HTTPS (port 443)
-	cmd2 := exec.Command("netsh", "advfirewall", "firewall", "add", "rule",
-		"name="+FIREWALL_RULE_NAME+" HTTPS",
-		"dir=out",
-		"action=block",
-		"protocol=TCP",
-		"localport=443")
+	if !checkpoint.StartTime.IsZero() && end.After(checkpoint.StartTime) {
+		gaps := checkpoint.IdleGaps
+		if !checkpoint.IdleSince.IsZero() && end.After(checkpoint.IdleSince) {
+			gaps = append(gaps, IdleGap{Start: checkpoint.IdleSince, End: end})
+		}
 
-	if err := cmd2.Run(); err != nil {
-		log.Printf("❌ Lỗi khi chặn HTTPS: %v", err)
-		return err
-	}
+		tm.mutex.Lock()
+		tm.recordSessionLocked(checkpoint.StartTime, end, gaps)
+		tm.mutex.Unlock()
 
-	tm.mutex.Lock()
-	tm.isBlocked = true
-	tm.mutex.Unlock()
+		log.Printf("♻️ Khôi phục session dang dở: %s - %s",
+			checkpoint.StartTime.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"))
+	}
 
-	log.Println("✅ Đã chặn truy cập internet (HTTP/HTTPS)")
+	tm.clearSessionCheckpoint()
 	return nil
 }
 
-// Mở lại mạng bằng cách xóa firewall rule
-func (tm *TimeManager) unblockNetwork() error {
-	log.Println("🔓 Mở lại truy cập internet...")
+// Ghi nhận một session vào daily usage, tách tại các mốc nửa đêm để mỗi ngày
+// chỉ bị tính phần thời gian thuộc về ngày đó (yêu cầu đã giữ mutex)
+func (tm *TimeManager) recordSessionLocked(start, end time.Time, gaps []IdleGap) {
+	for pieceStart := start; pieceStart.Before(end); {
+		pieceEnd := startOfDay(pieceStart).AddDate(0, 0, 1)
+		if pieceEnd.After(end) {
+			pieceEnd = end
+		}
+
+		idle := idleOverlap(gaps, pieceStart, pieceEnd)
+		session := UsageSession{
+			StartTime:   pieceStart,
+			EndTime:     pieceEnd,
+			Duration:    int64((pieceEnd.Sub(pieceStart) - idle).Minutes()),
+			IdleMinutes: int64(idle.Minutes()),
+			IdleGaps:    clipIdleGaps(gaps, pieceStart, pieceEnd),
+		}
 
-	// Xóa rule HTTP
-	cmd1 := exec.Command("netsh", "advfirewall", "firewall", "delete", "rule",
-		"name="+FIREWALL_RULE_NAME+" HTTP")
-	cmd1.Run() // Không check error vì rule có thể không tồn tại
+		date := pieceStart.Format(usageDateLayout)
+		usage := tm.usageForDateLocked(date)
+		usage.Total += session.Duration
 
-	// Xóa rule HTTPS
-	cmd2 := exec.Command("netsh", "advfirewall", "firewall", "delete", "rule",
-		"name="+FIREWALL_RULE_NAME+" HTTPS")
-	cmd2.Run() // Không check error vì rule có thể không tồn tại
+		if err := tm.storeSessionLocked(usage, session); err != nil {
+			log.Printf("⚠️ Không thể lưu session ngày %s: %v", date, err)
+		}
 
+		log.Printf("⏱️ Ghi nhận %d phút cho ngày %s. Tổng: %d phút",
+			session.Duration, date, usage.Total)
+
+		pieceStart = pieceEnd
+	}
+}
+
+// Bắt đầu session sử dụng
+func (tm *TimeManager) startSession() {
 	tm.mutex.Lock()
-	tm.isBlocked = false
-	tm.mutex.Unlock()
+	defer tm.mutex.Unlock()
 
-	log.Println("✅ Đã mở lại truy cập internet")
-	return nil
+	tm.sessionStartTime = time.Now()
+	tm.idleSince = time.Time{}
+	tm.idleGaps = nil
+	log.Printf("⏱️ Bắt đầu session lúc: %s", tm.sessionStartTime.Format("15:04:05"))
 }
 
-// Kiểm tra xem mạng có đang bị chặn không
-func (tm *TimeManager) isNetworkBlocked() bool {
-	tm.mutex.RLock()
-	defer tm.mutex.RUnlock()
-	return tm.isBlocked
+// Kết thúc session và ghi nhận usage
+func (tm *TimeManager) endSession() {
+	tm.endSessionAt(time.Now())
 }
 
-// --- Usage Tracking Functions ---
+// Kết thúc session tại thời điểm end (vd lúc máy bắt đầu ngủ) và ghi nhận usage
+func (tm *TimeManager) endSessionAt(end time.Time) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
 
-// Lưu dữ liệu usage vào file
-func (tm *TimeManager) saveUsageData() error {
+	if tm.sessionStartTime.IsZero() {
+		return
+	}
+
+	tm.closeIdleGapLocked(end)
+
+	// Ghi nhận vào daily usage (tách theo ngày nếu session vắt qua nửa đêm)
+	log.Printf("⏱️ Kết thúc session bắt đầu lúc %s", tm.sessionStartTime.Format("2006-01-02 15:04:05"))
+	tm.recordSessionLocked(tm.sessionStartTime, end, tm.idleGaps)
+
+	// Reset session
+	tm.sessionStartTime = time.Time{}
+	tm.idleGaps = nil
+
+	tm.clearSessionCheckpoint()
+}
+
+// Lấy total usage hôm nay
+func (tm *TimeManager) getTodayUsage() int64 {
 	tm.mutex.RLock()
 	defer tm.mutex.RUnlock()
 
-	// Ensure data directory exists
-	os.MkdirAll(filepath.Dir(tm.usageDataFile), 0755)
+	today := time.Now().Format("2006-01-02")
+	if usage, exists := tm.dailyUsage[today]; exists {
+		return usage.Total
+	}
+	return 0
+}
 
-	data, err := json.MarshalIndent(tm.dailyUsage, "", "  ")
-	if err != nil {
-		return err
+// Reset usage của một ngày (YYYY-MM-DD). Nếu là hôm nay, session đang chạy
+// được tính lại từ thời điểm reset.
+func (tm *TimeManager) ResetUsage(date string) (int64, error) {
+	if _, err := time.ParseInLocation(usageDateLayout, date, time.Local); err != nil {
+		return 0, fmt.Errorf("invalid date '%s' (use YYYY-MM-DD)", date)
 	}
 
-	return os.WriteFile(tm.usageDataFile, data, 0644)
-}
+	tm.mutex.Lock()
+	previous := tm.usageForDateLocked(date).Total
+	err := tm.deleteDayLocked(date)
 
-// Load dữ liệu usage từ file
-func (tm *TimeManager) loadUsageData() error {
-	if _, err := os.Stat(tm.usageDataFile); os.IsNotExist(err) {
-		return nil // File không tồn tại, skip
+	if date == time.Now().Format(usageDateLayout) {
+		if !tm.sessionStartTime.IsZero() {
+			tm.sessionStartTime = time.Now()
+		}
+		tm.isBreakTime = false
 	}
+	tm.mutex.Unlock()
+
+	log.Printf("🔄 Reset usage ngày %s (trước đó: %d phút)", date, previous)
 
-	data, err := os.ReadFile(tm.usageDataFile)
 	if err != nil {
-		return err
+		return previous, fmt.Errorf("failed to save usage data: %v", err)
+	}
+
+	go tm.checkTimeRules()
+	return previous, nil
+}
+
+// Cộng/trừ số phút usage của một ngày. Tổng không bao giờ âm.
+// Trả về tổng mới và số phút thực sự được điều chỉnh.
+func (tm *TimeManager) AdjustUsage(date string, minutes int64) (int64, int64, error) {
+	if _, err := time.ParseInLocation(usageDateLayout, date, time.Local); err != nil {
+		return 0, 0, fmt.Errorf("invalid date '%s' (use YYYY-MM-DD)", date)
+	}
+	if minutes == 0 {
+		return 0, 0, fmt.Errorf("adjustment must not be zero")
 	}
 
 	tm.mutex.Lock()
-	defer tm.mutex.Unlock()
+	usage := tm.usageForDateLocked(date)
 
-	return json.Unmarshal(data, &tm.dailyUsage)
+	// Không cho tổng âm: chỉ trừ tối đa phần đang có
+	if usage.Total+minutes < 0 {
+		minutes = -usage.Total
+	}
+	if minutes == 0 {
+		tm.mutex.Unlock()
+		return usage.Total, 0, fmt.Errorf("no usage to subtract on %s", date)
+	}
+	usage.Total += minutes
+	usage.Adjustments += minutes
+	total := usage.Total
+	err := tm.storeDayLocked(usage)
+	tm.mutex.Unlock()
+
+	log.Printf("✏️ Điều chỉnh usage ngày %s: %+d phút. Tổng: %d phút", date, minutes, total)
+
+	if err != nil {
+		return total, minutes, fmt.Errorf("failed to save usage data: %v", err)
+	}
+
+	go tm.checkTimeRules()
+	return total, minutes, nil
 }
 
-// Bắt đầu session sử dụng
-func (tm *TimeManager) startSession() {
+// --- Bonus Time Grants ---
+
+// Thêm thời gian thưởng
+func (tm *TimeManager) AddGrant(grant TimeGrant) (*TimeGrant, error) {
+	if grant.Minutes <= 0 || grant.Minutes > 720 {
+		return nil, fmt.Errorf("grant minutes must be between 1 and 720")
+	}
+	if grant.Date == "" {
+		grant.Date = time.Now().Format(usageDateLayout)
+	}
+	if _, err := time.ParseInLocation(usageDateLayout, grant.Date, time.Local); err != nil {
+		return nil, fmt.Errorf("invalid date '%s' (use YYYY-MM-DD)", grant.Date)
+	}
+	if grant.ID == "" {
+		grant.ID = fmt.Sprintf("local_%d", time.Now().UnixNano())
+	}
+	if grant.Source == "" {
+		grant.Source = "local"
+	}
+	if grant.CreatedAt == 0 {
+		grant.CreatedAt = time.Now().UnixMilli()
+	}
+
+	if err := tm.insertGrant(&grant); err != nil {
+		return nil, fmt.Errorf("failed to save grant: %v", err)
+	}
+
 	tm.mutex.Lock()
-	defer tm.mutex.Unlock()
+	tm.grants[grant.ID] = &grant
+	tm.mutex.Unlock()
 
-	tm.sessionStartTime = time.Now()
-	log.Printf("⏱️ Bắt đầu session lúc: %s", tm.sessionStartTime.Format("15:04:05"))
+	log.Printf("🎁 Thưởng thêm %d phút cho ngày %s (%s)", grant.Minutes, grant.Date, grant.Reason)
+
+	go tm.checkTimeRules()
+	return &grant, nil
 }
 
-// Kết thúc session và ghi nhận usage
-func (tm *TimeManager) endSession() {
+// Xóa một grant theo ID
+func (tm *TimeManager) RemoveGrant(id string) bool {
 	tm.mutex.Lock()
-	defer tm.mutex.Unlock()
+	_, exists := tm.grants[id]
+	delete(tm.grants, id)
+	tm.mutex.Unlock()
 
-	if tm.sessionStartTime.IsZero() {
-		return
+	if !exists {
+		return false
 	}
 
-	now := time.Now()
-	duration := now.Sub(tm.sessionStartTime)
+	if err := tm.deleteGrant(id); err != nil {
+		log.Printf("⚠️ Không thể xóa grant %s: %v", id, err)
+	}
 
-	// Ghi nhận vào daily usage
-	today := now.Format("2006-01-02")
-	if tm.dailyUsage[today] == nil {
-		tm.dailyUsage[today] = &DailyUsage{
-			Date:     today,
-			Sessions: []UsageSession{},
-			Total:    0,
+	go tm.checkTimeRules()
+	return true
+}
+
+// Thay thế toàn bộ grants đến từ Firebase, giữ nguyên grants tạo trên PC
+func (tm *TimeManager) SetRemoteGrants(remote map[string]*TimeGrant) {
+	incoming := []*TimeGrant{}
+	for id, grant := range remote {
+		if grant == nil || grant.Minutes <= 0 {
+			continue
 		}
+		g := *grant
+		g.ID = id
+		g.Source = "firebase"
+		incoming = append(incoming, &g)
 	}
 
-	session := UsageSession{
-		StartTime: tm.sessionStartTime,
-		EndTime:   now,
-		Duration:  int64(duration.Minutes()),
+	if err := tm.replaceRemoteGrants(incoming); err != nil {
+		log.Printf("⚠️ Không thể lưu grants: %v", err)
 	}
 
-	tm.dailyUsage[today].Sessions = append(tm.dailyUsage[today].Sessions, session)
-	tm.dailyUsage[today].Total += session.Duration
+	tm.mutex.Lock()
+	for id, grant := range tm.grants {
+		if grant.Source == "firebase" {
+			delete(tm.grants, id)
+		}
+	}
+	for _, grant := range incoming {
+		tm.grants[grant.ID] = grant
+	}
+	tm.mutex.Unlock()
 
-	log.Printf("⏱️ Kết thúc session: %d phút. Tổng hôm nay: %d phút",
-		session.Duration, tm.dailyUsage[today].Total)
+	go tm.checkTimeRules()
+}
 
-	// Reset session
-	tm.sessionStartTime = time.Time{}
+// Lấy danh sách grants của một ngày (date rỗng = tất cả)
+func (tm *TimeManager) GetGrants(date string) []TimeGrant {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
 
-	// Save to file
-	go tm.saveUsageData()
+	result := []TimeGrant{}
+	for _, grant := range tm.grants {
+		if date == "" || grant.Date == date {
+			result = append(result, *grant)
+		}
+	}
+	return result
 }
 
-// Lấy total usage hôm nay
-func (tm *TimeManager) getTodayUsage() int64 {
+// Tổng số phút thưởng của một ngày
+func (tm *TimeManager) getBonusMinutes(date string) int {
 	tm.mutex.RLock()
 	defer tm.mutex.RUnlock()
 
-	today := time.Now().Format("2006-01-02")
-	if usage, exists := tm.dailyUsage[today]; exists {
-		return usage.Total
+	return tm.bonusMinutesLocked(date)
+}
+
+// bonusMinutesLocked giống getBonusMinutes nhưng yêu cầu đã giữ mutex
+func (tm *TimeManager) bonusMinutesLocked(date string) int {
+	total := 0
+	for _, grant := range tm.grants {
+		if grant.Date == date {
+			total += grant.Minutes
+		}
 	}
-	return 0
+	return total
+}
+
+// --- Usage History Functions ---
+
+// Lấy usage theo từng ngày trong khoảng [from, to], kể cả những ngày không sử dụng.
+// includeSessions = false chỉ đọc tổng theo ngày (nhanh hơn với khoảng dài).
+func (tm *TimeManager) GetUsageHistory(from, to time.Time, includeSessions bool) ([]DailyUsage, error) {
+	fromDate := startOfDay(from).Format(usageDateLayout)
+	toDate := startOfDay(to).Format(usageDateLayout)
+
+	var stored map[string]*DailyUsage
+	if tm.db != nil {
+		var err error
+		if stored, err = tm.queryUsageRange(fromDate, toDate, includeSessions); err != nil {
+			return nil, err
+		}
+	} else {
+		tm.mutex.RLock()
+		stored = make(map[string]*DailyUsage)
+		for date, usage := range tm.dailyUsage {
+			stored[date] = usage
+		}
+		tm.mutex.RUnlock()
+	}
+
+	var history []DailyUsage
+	for day := startOfDay(from); !day.After(startOfDay(to)); day = day.AddDate(0, 0, 1) {
+		date := day.Format(usageDateLayout)
+		entry := DailyUsage{Date: date, Sessions: []UsageSession{}}
+		if usage, exists := stored[date]; exists {
+			entry.Sessions = append(entry.Sessions, usage.Sessions...)
+			entry.Total = usage.Total
+			entry.Adjustments = usage.Adjustments
+		}
+		history = append(history, entry)
+	}
+	return history, nil
+}
+
+// Tổng hợp usage theo tuần ("week") hoặc tháng ("month")
+func (tm *TimeManager) GetUsageSummary(from, to time.Time, period string) ([]UsageSummary, error) {
+	history, err := tm.GetUsageHistory(from, to, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []UsageSummary
+	index := make(map[string]int)
+	for _, day := range history {
+		date, err := time.ParseInLocation(usageDateLayout, day.Date, time.Local)
+		if err != nil {
+			continue
+		}
+
+		var key string
+		if period == "month" {
+			key = date.Format("2006-01")
+		} else {
+			year, week := date.ISOWeek()
+			key = fmt.Sprintf("%04d-W%02d", year, week)
+		}
+
+		i, exists := index[key]
+		if !exists {
+			summaries = append(summaries, UsageSummary{Period: key, StartDate: day.Date})
+			i = len(summaries) - 1
+			index[key] = i
+		}
+
+		summary := &summaries[i]
+		summary.EndDate = day.Date
+		summary.Total += day.Total
+		summary.Days++
+		if day.Total > 0 {
+			summary.ActiveDays++
+		}
+	}
+
+	for i := range summaries {
+		if summaries[i].Days > 0 {
+			summaries[i].AverageDaily = float64(summaries[i].Total) / float64(summaries[i].Days)
+		}
+	}
+	return summaries, nil
+}
+
+// Phân bổ usage theo từng giờ trong ngày (0-23), tính bằng phút, cộng dồn trong khoảng [from, to]
+func (tm *TimeManager) GetHourlyUsage(from, to time.Time) ([]int64, error) {
+	history, err := tm.GetUsageHistory(from, to, true)
+	if err != nil {
+		return nil, err
+	}
+
+	rangeStart := startOfDay(from)
+	rangeEnd := startOfDay(to).AddDate(0, 0, 1)
+
+	var seconds [24]float64
+	for _, day := range history {
+		for _, session := range day.Sessions {
+			start, end := session.StartTime, session.EndTime
+			if start.Before(rangeStart) {
+				start = rangeStart
+			}
+			if end.After(rangeEnd) {
+				end = rangeEnd
+			}
+
+			// Chia session theo từng giờ
+			for start.Before(end) {
+				hourEnd := start.Truncate(time.Hour).Add(time.Hour)
+				if hourEnd.After(end) {
+					hourEnd = end
+				}
+				seconds[start.Hour()] += hourEnd.Sub(start).Seconds()
+				start = hourEnd
+			}
+		}
+	}
+
+	hourly := make([]int64, 24)
+	for hour, secs := range seconds {
+		hourly[hour] = int64(secs / 60)
+	}
+	return hourly, nil
+}
+
+// startOfDay trả về 00:00 theo giờ địa phương của ngày chứa t
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
 }
 
 // --- Main Functions ---
 
-// Cập nhật quy tắc mới từ Firebase
+// Áp dụng quy tắc mới (chỉ trong bộ nhớ; dùng SaveLocalRules/ApplyFirebaseRules để lưu)
 func (tm *TimeManager) UpdateRules(newRules TimeRules) {
-	log.Println("📋 Cập nhật time rules từ Firebase")
+	log.Println("📋 Cập nhật time rules")
 	tm.mutex.Lock()
 	tm.rules = &newRules
+	tm.allowedRefreshedAt = time.Time{} // Phân giải lại đích được phép theo rule mới
 	tm.mutex.Unlock()
 
 	// Trigger immediate check
@@ -281,24 +689,72 @@ func (tm *TimeManager) notifyStatusChange(blocked bool, reason string) {
 
 // Kiểm tra quy tắc thời gian
 func (tm *TimeManager) checkTimeRules() {
-	if tm.rules == nil {
+	now := time.Now()
+	tm.detectResume(now)
+	tm.checkClock(now)
+
+	// Phụ huynh đã tắt bảo vệ: không chặn, chỉ tính giờ sử dụng
+	if tm.isProtectionDisabled() {
+		if tm.isNetworkBlocked() {
+			tm.unblockNetwork()
+			tm.notifyStatusChange(false, "Bảo vệ đã bị tắt")
+		}
+		if !tm.hasActiveSession() {
+			tm.startSession()
+		}
+		if err := tm.checkpointSession(); err != nil {
+			log.Printf("⚠️ Không thể ghi checkpoint session: %v", err)
+		}
 		return
 	}
 
-	now := time.Now()
-	today := now.Weekday()
+	// Phụ huynh chặn hoặc cho phép thủ công, cho tới khi hết hạn
+	if tm.applyManualOverride(now) {
+		return
+	}
 
-	var currentRule DayRule
-	var dayType string
-	if today == time.Saturday || today == time.Sunday {
-		currentRule = tm.rules.Weekends
-		dayType = "Cuối tuần"
-	} else {
-		currentRule = tm.rules.Weekdays
-		dayType = "Ngày thường"
+	tm.mutex.RLock()
+	hasRules := tm.rules != nil
+	tm.mutex.RUnlock()
+	if !hasRules {
+		// Không có quy tắc thời gian: không còn lý do chặn (vd chặn thủ công vừa hết hạn)
+		if tm.isNetworkBlocked() {
+			tm.unblockNetwork()
+			tm.notifyStatusChange(false, "Hết thời gian chặn thủ công")
+		}
+		return
 	}
 
+	tm.scheduleAllowListRefresh(now)
+
+	// Đồng hồ bị chỉnh và chính sách là chặn: chặn cho tới khi đồng hồ đúng trở lại
+	if tm.clockBlockActive() {
+		if !tm.isNetworkBlocked() {
+			tm.blockNetwork()
+			tm.endSession()
+			tm.notifyStatusChange(true, "Đồng hồ hệ thống bị thay đổi")
+		}
+		return
+	}
+
+	tm.updateIdleState(now)
+
+	tm.mutex.RLock()
+	currentRule, dayType := tm.ruleForDate(now)
+	prevRule, _ := tm.ruleForDate(now.AddDate(0, 0, -1))
+	tm.mutex.RUnlock()
+
 	if !currentRule.Enabled {
+		// Quy tắc hôm nay tắt nhưng khung chặn qua đêm của hôm qua vẫn còn hiệu lực
+		if prevRule.Enabled && tm.matchSlotTails(prevRule.BlockedSlots, now) {
+			if !tm.isNetworkBlocked() {
+				tm.blockNetwork()
+				tm.endSession()
+				tm.notifyStatusChange(true, "Trong khung giờ bị chặn")
+			}
+			return
+		}
+
 		// Rule disabled, unblock if blocked
 		if tm.isNetworkBlocked() {
 			tm.unblockNetwork()
@@ -307,26 +763,34 @@ func (tm *TimeManager) checkTimeRules() {
 		return
 	}
 
-	// 1. Kiểm tra khung giờ cho phép
-	isAllowedTime := tm.isInAllowedTimeSlot(currentRule.AllowedSlots, now)
+	// 1. Kiểm tra khung giờ cho phép và khung giờ bị chặn
+	isAllowedTime := tm.isInAllowedTimeSlot(currentRule, prevRule, now)
+	isBlockedTime := tm.isInBlockedTimeSlot(currentRule, prevRule, now)
 
-	// 2. Kiểm tra giới hạn thời gian hàng ngày
-	todayUsage := tm.getTodayUsage()
-	isWithinDailyLimit := currentRule.DailyLimitMinutes == 0 || todayUsage < int64(currentRule.DailyLimitMinutes)
+	// 2. Kiểm tra giới hạn thời gian hàng ngày (cộng thêm thời gian thưởng), tính
+	// trên tổng usage của mọi thiết bị trong gia đình
+	todayUsage := tm.getFamilyTodayUsage()
+	dailyLimit := currentRule.DailyLimitMinutes
+	if dailyLimit > 0 {
+		dailyLimit += tm.getBonusMinutes(now.Format(usageDateLayout))
+	}
+	isWithinDailyLimit := dailyLimit == 0 || todayUsage < int64(dailyLimit)
 
 	// 3. Kiểm tra nghỉ ngơi bắt buộc
 	needBreak := tm.needMandatoryBreak(currentRule)
 
 	// Quyết định chặn hay mở
-	shouldBlock := !isAllowedTime || !isWithinDailyLimit || needBreak
+	shouldBlock := !isAllowedTime || isBlockedTime || !isWithinDailyLimit || needBreak
 
 	// Log chi tiết
 	var reason string
 	if !isAllowedTime {
 		reason = "Ngoài giờ cho phép"
+	} else if isBlockedTime {
+		reason = "Trong khung giờ bị chặn"
 	} else if !isWithinDailyLimit {
 		reason = fmt.Sprintf("Đã vượt quá giới hạn %d phút/ngày (đã dùng %d phút)",
-			currentRule.DailyLimitMinutes, todayUsage)
+			dailyLimit, todayUsage)
 	} else if needBreak {
 		reason = "Cần nghỉ ngơi bắt buộc"
 	} else {
@@ -342,18 +806,74 @@ func (tm *TimeManager) checkTimeRules() {
 		tm.unblockNetwork()
 		tm.startSession() // Start new session when unblocked
 		tm.notifyStatusChange(false, reason)
+	} else if !shouldBlock && !tm.hasActiveSession() {
+		tm.startSession() // Đang được phép dùng nhưng chưa có session (vd lúc khởi động)
+	}
+
+	// Cảnh báo trước khi bị chặn
+	if !shouldBlock {
+		tm.checkUpcomingWarnings()
+	}
+
+	// Ghi checkpoint session đang chạy
+	if err := tm.checkpointSession(); err != nil {
+		log.Printf("⚠️ Không thể ghi checkpoint session: %v", err)
+	}
+}
+
+// Kiểm tra có session đang chạy không
+func (tm *TimeManager) hasActiveSession() bool {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return !tm.sessionStartTime.IsZero()
+}
+
+// Lấy quy tắc áp dụng cho ngày chứa thời điểm t: ngoại lệ theo ngày nếu có,
+// nếu không thì quy tắc ngày thường/cuối tuần (yêu cầu đã giữ mutex)
+func (tm *TimeManager) ruleForDate(t time.Time) (DayRule, string) {
+	if override := tm.overrideForDateLocked(t.Format(usageDateLayout)); override != nil {
+		return override.Rule, "Ngoại lệ: " + override.Name
 	}
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return tm.rules.Weekends, "Cuối tuần"
+	}
+	return tm.rules.Weekdays, "Ngày thường"
 }
 
-// Kiểm tra xem có trong khung giờ cho phép không
-func (tm *TimeManager) isInAllowedTimeSlot(slots []TimeSlot, now time.Time) bool {
-	if len(slots) == 0 {
+// Kiểm tra xem có trong khung giờ cho phép không.
+// Khung giờ qua đêm thuộc về ngày bắt đầu, nên phần sau nửa đêm được lấy
+// từ quy tắc của ngày hôm trước (prevRule).
+func (tm *TimeManager) isInAllowedTimeSlot(rule, prevRule DayRule, now time.Time) bool {
+	if len(rule.AllowedSlots) == 0 {
 		return true // Không có giới hạn khung giờ
 	}
 
+	if prevRule.Enabled && tm.matchSlotTails(prevRule.AllowedSlots, now) {
+		return true
+	}
+	return tm.matchSlots(rule.AllowedSlots, now)
+}
+
+// Kiểm tra xem có trong khung giờ bị chặn không (cùng quy ước qua đêm như trên)
+func (tm *TimeManager) isInBlockedTimeSlot(rule, prevRule DayRule, now time.Time) bool {
+	if prevRule.Enabled && tm.matchSlotTails(prevRule.BlockedSlots, now) {
+		return true
+	}
+	return tm.matchSlots(rule.BlockedSlots, now)
+}
+
+// matchSlots kiểm tra các khung giờ bắt đầu trong ngày hôm nay.
+// Với khung qua đêm, chỉ phần từ giờ bắt đầu đến 24:00 được tính.
+func (tm *TimeManager) matchSlots(slots []TimeSlot, now time.Time) bool {
 	currentTime := fmt.Sprintf("%02d:%02d", now.Hour(), now.Minute())
 
 	for _, slot := range slots {
+		if isOvernightSlot(slot) {
+			if start, err := parseClock(slot.StartTime); err == nil && clockMinutes(now) >= start {
+				return true
+			}
+			continue
+		}
 		if tm.isTimeInRange(currentTime, slot.StartTime, slot.EndTime) {
 			return true
 		}
@@ -361,9 +881,80 @@ func (tm *TimeManager) isInAllowedTimeSlot(slots []TimeSlot, now time.Time) bool
 	return false
 }
 
-// Kiểm tra thời gian có trong khoảng không
+// matchSlotTails kiểm tra phần sau nửa đêm của các khung qua đêm từ hôm trước
+func (tm *TimeManager) matchSlotTails(slots []TimeSlot, now time.Time) bool {
+	for _, slot := range slots {
+		if !isOvernightSlot(slot) {
+			continue
+		}
+		if end, err := parseClock(slot.EndTime); err == nil && clockMinutes(now) <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// Kiểm tra thời gian có trong khoảng không (hỗ trợ khoảng qua nửa đêm, vd 20:00–01:00)
 func (tm *TimeManager) isTimeInRange(current, start, end string) bool {
-	return current >= start && current <= end
+	cur, err1 := parseClock(current)
+	s, err2 := parseClock(start)
+	e, err3 := parseClock(end)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return false
+	}
+
+	if s <= e {
+		return cur >= s && cur <= e
+	}
+	// Khoảng qua nửa đêm
+	return cur >= s || cur <= e
+}
+
+// parseClock chuyển "HH:MM" thành số phút kể từ 00:00
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// clockMinutes trả về số phút kể từ 00:00 của thời điểm t
+func clockMinutes(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
+
+// isOvernightSlot cho biết khung giờ có vắt qua nửa đêm không
+func isOvernightSlot(slot TimeSlot) bool {
+	start, err1 := parseClock(slot.StartTime)
+	end, err2 := parseClock(slot.EndTime)
+	return err1 == nil && err2 == nil && start > end
+}
+
+// slotSegments tách khung giờ thành các đoạn nửa mở [start, end) trong ngày,
+// khung qua đêm cho ra hai đoạn. Dùng để phát hiện các khung chồng lấn.
+func slotSegments(slot TimeSlot) [][2]int {
+	start, err1 := parseClock(slot.StartTime)
+	end, err2 := parseClock(slot.EndTime)
+	if err1 != nil || err2 != nil || start == end {
+		return nil
+	}
+	if start < end {
+		return [][2]int{{start, end}}
+	}
+	return [][2]int{{start, 24 * 60}, {0, end}}
+}
+
+// slotsOverlap cho biết hai khung giờ có chồng lấn nhau không
+func slotsOverlap(a, b TimeSlot) bool {
+	for _, sa := range slotSegments(a) {
+		for _, sb := range slotSegments(b) {
+			if sa[0] < sb[1] && sb[0] < sa[1] {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Kiểm tra cần nghỉ ngơi bắt buộc không
@@ -372,8 +963,8 @@ func (tm *TimeManager) needMandatoryBreak(rule DayRule) bool {
 		return false // Không có yêu cầu nghỉ ngơi
 	}
 
-	tm.mutex.RLock()
-	defer tm.mutex.RUnlock()
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
 
 	// Nếu đang trong break time
 	if tm.isBreakTime {
@@ -388,7 +979,9 @@ func (tm *TimeManager) needMandatoryBreak(rule DayRule) bool {
 
 	// Kiểm tra có cần bắt đầu nghỉ không
 	if !tm.sessionStartTime.IsZero() {
-		sessionDuration := time.Since(tm.sessionStartTime).Minutes()
+		now := time.Now()
+		breakDuration := time.Duration(rule.BreakDurationMinutes) * time.Minute
+		sessionDuration := tm.activeDurationLocked(tm.breakCounterStartLocked(breakDuration), now).Minutes()
 		if sessionDuration >= float64(rule.BreakIntervalMinutes) {
 			tm.isBreakTime = true
 			tm.lastBreakTime = time.Now()
@@ -406,7 +999,9 @@ func (tm *TimeManager) StartMonitoring() {
 
 	tm.ticker = time.NewTicker(30 * time.Second) // Kiểm tra mỗi 30 giây
 
-	// Initial check
+	// So sánh đồng hồ với lần chạy trước, sau đó kiểm tra lần đầu
+	tm.checkClockAtStartup()
+	tm.startPowerEvents()
 	go tm.checkTimeRules()
 
 	for {
@@ -427,12 +1022,20 @@ func (tm *TimeManager) Stop() {
 	if tm.ticker != nil {
 		tm.ticker.Stop()
 	}
+	tm.stopPowerEvents()
 
 	// End current session
 	tm.endSession()
 
-	// Unblock network
-	tm.unblockNetwork()
+	// Unblock network (chế độ bền vững giữ nguyên rule chặn cho tới khi service chạy lại)
+	tm.mutex.RLock()
+	persistent := tm.persistentEnforcement
+	tm.mutex.RUnlock()
+	if persistent {
+		log.Println("🛡️ Chế độ chặn bền vững: giữ nguyên trạng thái chặn mạng")
+	} else {
+		tm.unblockNetwork()
+	}
 
 	// Signal stop
 	close(tm.stopChan)
@@ -446,27 +1049,47 @@ func (tm *TimeManager) GetStatus() map[string]interface{} {
 	defer tm.mutex.RUnlock()
 
 	status := map[string]interface{}{
-		"is_blocked":    tm.isBlocked,
-		"is_break_time": tm.isBreakTime,
-		"today_usage":   tm.getTodayUsage(),
-		"has_rules":     tm.rules != nil,
+		"is_blocked":           tm.isBlocked,
+		"network_backend":      networkBackendName(tm.networkEnforcer),
+		"is_break_time":        tm.isBreakTime,
+		"today_usage":          tm.liveUsageLocked(time.Now()),
+		"family_usage":         tm.familyUsageLocked(time.Now()),
+		"has_rules":            tm.rules != nil,
+		"clock":                tm.clockStateLocked(),
+		"allowed_during_block": tm.allowedDestinationsLocked(),
+	}
+
+	if override := tm.manualOverrideLocked(time.Now()); override != nil {
+		status["manual_override"] = *override
+	}
+
+	if tm.rulesRecord != nil {
+		status["rules_version"] = tm.rulesRecord.Version
+		status["rules_source"] = tm.rulesRecord.Source
 	}
 
 	if tm.rules != nil {
-		now := time.Now()
-		var currentRule DayRule
-		if now.Weekday() == time.Saturday || now.Weekday() == time.Sunday {
-			currentRule = tm.rules.Weekends
-		} else {
-			currentRule = tm.rules.Weekdays
-		}
+		currentRule, ruleName := tm.ruleForDate(time.Now())
 
 		status["current_rule"] = currentRule
+		status["rule_name"] = ruleName
+		if override := tm.overrideForDateLocked(time.Now().Format(usageDateLayout)); override != nil {
+			status["active_override"] = *override
+		}
 		status["daily_limit"] = currentRule.DailyLimitMinutes
+
+		bonus := tm.bonusMinutesLocked(time.Now().Format(usageDateLayout))
+		status["bonus_minutes"] = bonus
+		if currentRule.DailyLimitMinutes > 0 {
+			status["effective_daily_limit"] = currentRule.DailyLimitMinutes + bonus
+		} else {
+			status["effective_daily_limit"] = 0
+		}
 	}
 
 	if !tm.sessionStartTime.IsZero() {
-		status["session_duration"] = int64(time.Since(tm.sessionStartTime).Minutes())
+		status["session_duration"] = int64(tm.activeDurationLocked(tm.sessionStartTime, time.Now()).Minutes())
+		status["is_idle"] = !tm.idleSince.IsZero()
 	}
 
 	return status
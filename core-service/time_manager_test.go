@@ -0,0 +1,130 @@
+// core-service/time_manager_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOvernightBlockCarriesIntoDisabledDay(t *testing.T) {
+	core, _, _ := newTestServices(t)
+	tm := core.timeManager
+	enforcer := tm.networkEnforcer.(*FakeNetworkEnforcer)
+
+	now := time.Now()
+	if now.Hour() == 23 && now.Minute() >= 58 {
+		t.Skip("khung qua đêm 23:59–23:58 không còn phủ thời điểm hiện tại")
+	}
+
+	// Hôm qua chặn từ 23:59 tới 23:58 hôm nay, quy tắc hôm nay tắt
+	tm.UpdateRules(TimeRules{Weekdays: DayRule{Enabled: true}, Weekends: DayRule{Enabled: true}})
+	yesterday := now.AddDate(0, 0, -1).Format(usageDateLayout)
+	overnight := DayRule{Enabled: true, BlockedSlots: []TimeSlot{{StartTime: "23:59", EndTime: "23:58"}}}
+	if _, err := tm.AddOverride(TimeRuleOverride{Name: "yesterday", StartDate: yesterday, Rule: overnight}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tm.AddOverride(TimeRuleOverride{Name: "today", StartDate: now.Format(usageDateLayout)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tm.checkTimeRules()
+	if blocked, _ := enforcer.IsBlocked(); !blocked {
+		t.Fatal("overnight block from yesterday lifted because today's rule is off")
+	}
+}
+
+// Session đang chạy từ start, dùng FakeIdleSource để giả lập người dùng rời máy
+func newIdleTimeManager(t *testing.T, start time.Time) (*TimeManager, *FakeIdleSource) {
+	t.Helper()
+
+	core, _, _ := newTestServices(t)
+	tm := core.timeManager
+	idle := NewFakeIdleSource()
+	tm.SetIdleSource(idle)
+
+	tm.mutex.Lock()
+	tm.sessionStartTime = start
+	tm.mutex.Unlock()
+	return tm, idle
+}
+
+func TestIdleGapNotCountedAsUsage(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-30 * time.Minute)
+	if start.Format(usageDateLayout) != now.Format(usageDateLayout) {
+		t.Skip("session vắt qua nửa đêm")
+	}
+	tm, idle := newIdleTimeManager(t, start)
+
+	// Không thao tác từ phút thứ 10 tới hết session
+	idle.SetIdle(10 * time.Minute)
+	tm.updateIdleState(now.Add(-10 * time.Minute))
+	idle.SetIdle(0)
+	tm.updateIdleState(now)
+	tm.endSessionAt(now)
+
+	if usage := tm.getTodayUsage(); usage != 10 {
+		t.Fatalf("recorded %d minutes, want 10 (30-minute session with 20 minutes idle)", usage)
+	}
+}
+
+func TestIdleGapNotCountedTowardsBreak(t *testing.T) {
+	rule := DayRule{Enabled: true, BreakIntervalMinutes: 20, BreakDurationMinutes: 10}
+	now := time.Now()
+
+	// 25 phút liên tục: tới giờ nghỉ
+	tm, _ := newIdleTimeManager(t, now.Add(-25*time.Minute))
+	if !tm.needMandatoryBreak(rule) {
+		t.Fatal("no break after 25 minutes of continuous use")
+	}
+
+	// 25 phút nhưng 8 phút không thao tác (ngắn hơn thời gian nghỉ): mới dùng 17 phút
+	t.Run("idle", func(t *testing.T) {
+		tm, idle := newIdleTimeManager(t, now.Add(-25*time.Minute))
+		idle.SetIdle(8 * time.Minute)
+		tm.updateIdleState(now.Add(-5 * time.Minute))
+		idle.SetIdle(0)
+		tm.updateIdleState(now.Add(-5 * time.Minute).Add(time.Second))
+
+		if tm.needMandatoryBreak(rule) {
+			t.Fatal("idle minutes counted towards the break interval")
+		}
+	})
+}
+
+func TestSuspendEndsSessionAndSleepIsNotCharged(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-90 * time.Minute)
+	if start.Format(usageDateLayout) != now.Format(usageDateLayout) {
+		t.Skip("session vắt qua nửa đêm")
+	}
+
+	core, _, _ := newTestServices(t)
+	tm := core.timeManager
+	power := NewFakePowerEventSource()
+	tm.SetPowerEventSource(power)
+	tm.SetIdleSource(nil)
+	tm.startPowerEvents()
+	t.Cleanup(tm.stopPowerEvents)
+
+	// Dùng 30 phút, ngủ 60 phút rồi thức dậy
+	tm.mutex.Lock()
+	tm.sessionStartTime = start
+	tm.lastTickAt = start
+	tm.mutex.Unlock()
+
+	power.Emit(PowerEventSuspend, now.Add(-60*time.Minute))
+	if tm.hasActiveSession() {
+		t.Fatal("session still open after suspend")
+	}
+	if usage := tm.getTodayUsage(); usage != 30 {
+		t.Fatalf("recorded %d minutes at suspend, want 30", usage)
+	}
+
+	power.Emit(PowerEventResume, now)
+	tm.checkTimeRules()
+	tm.endSession()
+	if usage := tm.getTodayUsage(); usage != 30 {
+		t.Fatalf("recorded %d minutes after resume, want 30 (sleep charged)", usage)
+	}
+}
@@ -0,0 +1,277 @@
+// core-service/time_manual.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Các kiểu can thiệp thủ công của phụ huynh
+const (
+	ManualBlock = "block" // Chặn ngay trong N phút
+	ManualAllow = "allow" // Cho phép tới HH:MM
+	ManualPause = "pause" // Tạm dừng mọi quy tắc thời gian tới hết hôm nay
+)
+
+// Key trong service_state lưu can thiệp thủ công đang áp dụng
+const manualOverrideKey = "manual_override"
+
+// Thời gian chặn mặc định khi không chỉ định số phút, và tối đa
+const (
+	defaultManualBlockMinutes = 60
+	maxManualBlockMinutes     = 24 * 60
+)
+
+// Can thiệp thủ công có thời hạn, được ưu tiên hơn quy tắc thời gian cho tới khi hết hạn
+type ManualOverride struct {
+	Mode      string    `json:"mode"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Reason    string    `json:"reason,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Tạo can thiệp thủ công: block dùng minutes, allow dùng until (HH:MM, nếu đã qua
+// thì là ngày mai), pause hết hạn lúc nửa đêm
+func newManualOverride(mode string, minutes int, until string, now time.Time) (*ManualOverride, error) {
+	override := &ManualOverride{Mode: mode, CreatedAt: now}
+
+	switch mode {
+	case ManualBlock:
+		if minutes == 0 {
+			minutes = defaultManualBlockMinutes
+		}
+		if minutes < 1 || minutes > maxManualBlockMinutes {
+			return nil, fmt.Errorf("minutes must be between 1 and %d", maxManualBlockMinutes)
+		}
+		override.ExpiresAt = now.Add(time.Duration(minutes) * time.Minute)
+	case ManualAllow:
+		at, err := time.Parse("15:04", until)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time '%s' (use HH:MM)", until)
+		}
+		expires := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+		if !expires.After(now) {
+			expires = expires.AddDate(0, 0, 1)
+		}
+		override.ExpiresAt = expires
+	case ManualPause:
+		override.ExpiresAt = startOfDay(now).AddDate(0, 0, 1)
+	default:
+		return nil, fmt.Errorf("invalid mode '%s'", mode)
+	}
+	return override, nil
+}
+
+// Mô tả dùng làm lý do khi thay đổi trạng thái chặn
+func (o *ManualOverride) describe() string {
+	switch o.Mode {
+	case ManualBlock:
+		return fmt.Sprintf("Phụ huynh chặn thủ công tới %s", o.ExpiresAt.Format("15:04"))
+	case ManualAllow:
+		return fmt.Sprintf("Phụ huynh cho phép sử dụng tới %s", o.ExpiresAt.Format("15:04"))
+	default:
+		return "Phụ huynh tạm dừng quy tắc thời gian hôm nay"
+	}
+}
+
+// Can thiệp thủ công còn hiệu lực tại thời điểm now (yêu cầu đã giữ mutex).
+// Khi đồng hồ bị chỉnh thì lệnh chặn thủ công vẫn có hiệu lực sau hạn, vì hạn
+// của nó có thể bị vượt qua bằng cách chỉnh đồng hồ tới trước.
+func (tm *TimeManager) manualOverrideLocked(now time.Time) *ManualOverride {
+	override := tm.manualOverride
+	if override == nil {
+		return nil
+	}
+	if now.Before(override.ExpiresAt) || (override.Mode == ManualBlock && tm.clockTampered) {
+		return override
+	}
+	return nil
+}
+
+// Lấy can thiệp thủ công đang áp dụng (nil nếu không có)
+func (tm *TimeManager) GetManualOverride() *ManualOverride {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	override := tm.manualOverrideLocked(time.Now())
+	if override == nil {
+		return nil
+	}
+	copied := *override
+	return &copied
+}
+
+// Áp dụng can thiệp thủ công mới, thay cho can thiệp trước đó
+func (tm *TimeManager) SetManualOverride(override ManualOverride) error {
+	if err := tm.saveManualOverride(&override); err != nil {
+		return err
+	}
+
+	tm.mutex.Lock()
+	tm.manualOverride = &override
+	tm.mutex.Unlock()
+
+	log.Printf("✋ %s (%s)", override.describe(), override.Reason)
+
+	go tm.checkTimeRules()
+	return nil
+}
+
+// Hủy can thiệp thủ công, quay lại quy tắc thời gian
+func (tm *TimeManager) ClearManualOverride() (bool, error) {
+	tm.mutex.Lock()
+	active := tm.manualOverrideLocked(time.Now()) != nil
+	tm.manualOverride = nil
+	tm.mutex.Unlock()
+
+	if err := tm.saveManualOverride(nil); err != nil {
+		return active, err
+	}
+	if active {
+		log.Println("✋ Hủy can thiệp thủ công, áp dụng lại quy tắc thời gian")
+	}
+
+	go tm.checkTimeRules()
+	return active, nil
+}
+
+// Bỏ can thiệp đã hết hạn
+func (tm *TimeManager) expireManualOverride(now time.Time) {
+	tm.mutex.Lock()
+	override := tm.manualOverride
+	if override == nil || tm.manualOverrideLocked(now) != nil {
+		tm.mutex.Unlock()
+		return
+	}
+	tm.manualOverride = nil
+	tm.mutex.Unlock()
+
+	log.Printf("✋ Hết hạn can thiệp thủ công (%s lúc %s)", override.Mode, override.ExpiresAt.Format("15:04"))
+	if err := tm.saveManualOverride(nil); err != nil {
+		log.Printf("⚠️ Không thể xóa can thiệp thủ công: %v", err)
+	}
+}
+
+// Thực thi can thiệp thủ công trong checkTimeRules. Trả về true nếu can thiệp
+// đã quyết định trạng thái chặn và không cần xét quy tắc thời gian.
+func (tm *TimeManager) applyManualOverride(now time.Time) bool {
+	tm.expireManualOverride(now)
+
+	tm.mutex.RLock()
+	active := tm.manualOverrideLocked(now)
+	var override ManualOverride
+	if active != nil {
+		override = *active
+	}
+	tm.mutex.RUnlock()
+
+	if active == nil {
+		return false
+	}
+
+	if override.Mode == ManualBlock {
+		if !tm.isNetworkBlocked() {
+			tm.blockNetwork()
+			tm.endSession()
+			tm.notifyStatusChange(true, override.describe())
+		}
+		return true
+	}
+
+	// Đồng hồ bị chỉnh thì hạn cho phép không còn tin cậy được
+	if tm.clockBlockActive() {
+		return false
+	}
+
+	tm.updateIdleState(now)
+
+	if tm.isNetworkBlocked() {
+		tm.unblockNetwork()
+		tm.startSession()
+		tm.notifyStatusChange(false, override.describe())
+	} else if !tm.hasActiveSession() {
+		tm.startSession()
+	}
+
+	tm.checkUpcomingWarnings()
+
+	if err := tm.checkpointSession(); err != nil {
+		log.Printf("⚠️ Không thể ghi checkpoint session: %v", err)
+	}
+	return true
+}
+
+// Sự kiện chặn khi hết thời gian cho phép thủ công, nếu quy tắc thời gian sẽ
+// chặn vào lúc đó (yêu cầu đã giữ mutex)
+func (tm *TimeManager) manualOverrideEventsLocked(now time.Time, override *ManualOverride) []TimeEvent {
+	at := override.ExpiresAt
+	limit := tm.effectiveLimitLocked(at)
+	usageAtExpiry := tm.familyUsageLocked(now) + int64(at.Sub(now).Minutes())
+	limitReached := limit > 0 && sameDay(at, now) && usageAtExpiry >= int64(limit)
+	if tm.isTimeAllowedAt(at) && !limitReached {
+		return nil
+	}
+
+	remaining := at.Sub(now)
+	return []TimeEvent{{
+		Type:             "override_ending",
+		At:               at,
+		MinutesRemaining: int(remaining.Minutes()),
+		SecondsRemaining: int64(remaining.Seconds()),
+		Message:          "Sắp hết thời gian phụ huynh cho phép",
+		key:              "override_ending@" + at.Format(time.RFC3339),
+	}}
+}
+
+// Load can thiệp thủ công đã lưu (còn hiệu lực sau khi service khởi động lại)
+func (tm *TimeManager) loadManualOverride() error {
+	if tm.db == nil {
+		return nil
+	}
+
+	var value string
+	err := tm.db.QueryRow("SELECT value FROM service_state WHERE key = ?", manualOverrideKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var override ManualOverride
+	if err := json.Unmarshal([]byte(value), &override); err != nil {
+		return err
+	}
+
+	tm.mutex.Lock()
+	tm.manualOverride = &override
+	tm.mutex.Unlock()
+
+	log.Printf("✋ Khôi phục can thiệp thủ công: %s", override.describe())
+	return nil
+}
+
+// Lưu can thiệp thủ công; nil xóa can thiệp đã lưu
+func (tm *TimeManager) saveManualOverride(override *ManualOverride) error {
+	if tm.db == nil {
+		return nil
+	}
+
+	if override == nil {
+		_, err := tm.db.Exec("DELETE FROM service_state WHERE key = ?", manualOverrideKey)
+		return err
+	}
+
+	data, err := json.Marshal(override)
+	if err != nil {
+		return err
+	}
+	_, err = tm.db.Exec(`INSERT INTO service_state (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		manualOverrideKey, string(data))
+	return err
+}
@@ -0,0 +1,288 @@
+// core-service/time_overrides.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Số ngày tối đa của một ngoại lệ (vd nghỉ hè)
+const maxOverrideDays = 366
+
+// Ngoại lệ theo ngày (ngày nghỉ, tuần thi...), được ưu tiên hơn quy tắc tuần
+type TimeRuleOverride struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	StartDate string    `json:"startDate"` // YYYY-MM-DD
+	EndDate   string    `json:"endDate"`   // YYYY-MM-DD, bao gồm
+	Rule      DayRule   `json:"rule"`
+	Source    string    `json:"source"`        // "manual" hoặc "ics:<tên file>"
+	UID       string    `json:"uid,omitempty"` // UID của sự kiện iCalendar
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Kết quả nhập file .ics
+type ICSImportResult struct {
+	Source   string   `json:"source"`
+	Imported int      `json:"imported"`
+	Replaced int      `json:"replaced"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Số ngày của ngoại lệ, dùng để chọn ngoại lệ hẹp nhất khi chồng nhau
+func (o *TimeRuleOverride) days() int {
+	start, _ := time.ParseInLocation(usageDateLayout, o.StartDate, time.Local)
+	end, _ := time.ParseInLocation(usageDateLayout, o.EndDate, time.Local)
+	return int(end.Sub(start).Hours()/24) + 1
+}
+
+// Kiểm tra khoảng ngày hợp lệ
+func validateOverrideDates(startDate, endDate string) error {
+	start, err := time.ParseInLocation(usageDateLayout, startDate, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid start date '%s' (use YYYY-MM-DD)", startDate)
+	}
+	end, err := time.ParseInLocation(usageDateLayout, endDate, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid end date '%s' (use YYYY-MM-DD)", endDate)
+	}
+	if end.Before(start) {
+		return fmt.Errorf("end date must not be before start date")
+	}
+	if end.Sub(start) >= maxOverrideDays*24*time.Hour {
+		return fmt.Errorf("an override can cover at most %d days", maxOverrideDays)
+	}
+	return nil
+}
+
+// Sắp xếp để ngoại lệ hẹp nhất (rồi mới nhất) được chọn trước (yêu cầu đã giữ mutex)
+func (tm *TimeManager) sortOverridesLocked() {
+	sort.SliceStable(tm.overrides, func(i, j int) bool {
+		di, dj := tm.overrides[i].days(), tm.overrides[j].days()
+		if di != dj {
+			return di < dj
+		}
+		return tm.overrides[i].ID > tm.overrides[j].ID
+	})
+}
+
+// Tìm ngoại lệ áp dụng cho ngày date (yêu cầu đã giữ mutex)
+func (tm *TimeManager) overrideForDateLocked(date string) *TimeRuleOverride {
+	for i := range tm.overrides {
+		if tm.overrides[i].StartDate <= date && date <= tm.overrides[i].EndDate {
+			return &tm.overrides[i]
+		}
+	}
+	return nil
+}
+
+// Load danh sách ngoại lệ từ SQLite
+func (tm *TimeManager) loadOverrides() error {
+	if tm.db == nil {
+		return nil
+	}
+
+	rows, err := tm.db.Query("SELECT id, name, start_date, end_date, rule, source, uid, created_at FROM time_rule_overrides")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var overrides []TimeRuleOverride
+	for rows.Next() {
+		var override TimeRuleOverride
+		var rule string
+		var uid sql.NullString
+		if err := rows.Scan(&override.ID, &override.Name, &override.StartDate, &override.EndDate,
+			&rule, &override.Source, &uid, &override.CreatedAt); err != nil {
+			continue
+		}
+		if err := json.Unmarshal([]byte(rule), &override.Rule); err != nil {
+			log.Printf("⚠️ Bỏ qua ngoại lệ %d bị hỏng: %v", override.ID, err)
+			continue
+		}
+		override.UID = uid.String
+		overrides = append(overrides, override)
+	}
+
+	tm.mutex.Lock()
+	tm.overrides = overrides
+	tm.sortOverridesLocked()
+	tm.mutex.Unlock()
+
+	log.Printf("📅 Đã load %d ngoại lệ lịch", len(overrides))
+	return nil
+}
+
+// Lấy danh sách ngoại lệ, sắp xếp theo ngày bắt đầu
+func (tm *TimeManager) GetOverrides() []TimeRuleOverride {
+	tm.mutex.RLock()
+	overrides := make([]TimeRuleOverride, len(tm.overrides))
+	copy(overrides, tm.overrides)
+	tm.mutex.RUnlock()
+
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].StartDate != overrides[j].StartDate {
+			return overrides[i].StartDate < overrides[j].StartDate
+		}
+		return overrides[i].ID < overrides[j].ID
+	})
+	return overrides
+}
+
+// Thêm ngoại lệ cho một ngày hoặc một khoảng ngày
+func (tm *TimeManager) AddOverride(override TimeRuleOverride) (*TimeRuleOverride, error) {
+	if override.EndDate == "" {
+		override.EndDate = override.StartDate
+	}
+	if err := validateOverrideDates(override.StartDate, override.EndDate); err != nil {
+		return nil, err
+	}
+	if tm.db == nil {
+		return nil, fmt.Errorf("override storage is not available")
+	}
+	if override.Source == "" {
+		override.Source = "manual"
+	}
+
+	rule, err := json.Marshal(override.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	override.CreatedAt = time.Now()
+	result, err := tm.db.Exec("INSERT INTO time_rule_overrides (name, start_date, end_date, rule, source, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		override.Name, override.StartDate, override.EndDate, string(rule), override.Source, override.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	override.ID, _ = result.LastInsertId()
+
+	tm.mutex.Lock()
+	tm.overrides = append(tm.overrides, override)
+	tm.sortOverridesLocked()
+	tm.mutex.Unlock()
+
+	log.Printf("📅 Thêm ngoại lệ '%s': %s → %s", override.Name, override.StartDate, override.EndDate)
+
+	go tm.checkTimeRules()
+	return &override, nil
+}
+
+// Xóa một ngoại lệ
+func (tm *TimeManager) RemoveOverride(id int64) (bool, error) {
+	if tm.db == nil {
+		return false, nil
+	}
+
+	result, err := tm.db.Exec("DELETE FROM time_rule_overrides WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	tm.mutex.Lock()
+	for i := range tm.overrides {
+		if tm.overrides[i].ID == id {
+			tm.overrides = append(tm.overrides[:i], tm.overrides[i+1:]...)
+			break
+		}
+	}
+	tm.mutex.Unlock()
+
+	log.Printf("🗑️ Xóa ngoại lệ %d", id)
+
+	go tm.checkTimeRules()
+	return true, nil
+}
+
+// Nhập lịch nghỉ từ file .ics: mỗi sự kiện trở thành một ngoại lệ dùng chung rule.
+// Sự kiện đã nhập trước đó (cùng file và UID) được cập nhật; replace = true xóa
+// toàn bộ ngoại lệ đã nhập từ file này trước khi nhập lại.
+func (tm *TimeManager) ImportICS(path string, rule DayRule, replace bool) (*ICSImportResult, error) {
+	if tm.db == nil {
+		return nil, fmt.Errorf("override storage is not available")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open calendar file: %v", err)
+	}
+	defer file.Close()
+
+	events, warnings, err := parseICSEvents(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ICSImportResult{Source: "ics:" + filepath.Base(path), Warnings: warnings}
+
+	ruleJSON, err := json.Marshal(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := tm.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		deleted, err := tx.Exec("DELETE FROM time_rule_overrides WHERE source = ?", result.Source)
+		if err != nil {
+			return nil, err
+		}
+		affected, _ := deleted.RowsAffected()
+		result.Replaced = int(affected)
+	}
+
+	now := time.Now()
+	for _, event := range events {
+		startDate := event.StartDate.Format(usageDateLayout)
+		endDate := event.EndDate.Format(usageDateLayout)
+		if err := validateOverrideDates(startDate, endDate); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("event '%s': %v, skipped", event.Summary, err))
+			continue
+		}
+		if event.Recurring {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("event '%s' repeats, only the first occurrence was imported", event.Summary))
+		}
+
+		if event.UID != "" {
+			deleted, err := tx.Exec("DELETE FROM time_rule_overrides WHERE source = ? AND uid = ?", result.Source, event.UID)
+			if err != nil {
+				return nil, err
+			}
+			affected, _ := deleted.RowsAffected()
+			result.Replaced += int(affected)
+		}
+
+		if _, err := tx.Exec("INSERT INTO time_rule_overrides (name, start_date, end_date, rule, source, uid, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			event.Summary, startDate, endDate, string(ruleJSON), result.Source, event.UID, now); err != nil {
+			return nil, err
+		}
+		result.Imported++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("📅 Đã nhập %d ngoại lệ từ %s", result.Imported, path)
+
+	if err := tm.loadOverrides(); err != nil {
+		return result, err
+	}
+
+	go tm.checkTimeRules()
+	return result, nil
+}
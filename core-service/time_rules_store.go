@@ -0,0 +1,181 @@
+// core-service/time_rules_store.go
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Nguồn của time rules
+const (
+	RulesSourceLocal    = "local"    // Cấu hình trên PC (UI admin, API)
+	RulesSourceFirebase = "firebase" // Đồng bộ từ ứng dụng Android
+)
+
+// Số phiên bản rule cũ được giữ lại để tra cứu
+const maxStoredRuleVersions = 20
+
+// Time rules đã lưu trong SQLite.
+//
+// Chính sách gộp khi rule từ Firebase tới:
+//   - Rule giống hệt bản đang dùng: bỏ qua, không tạo phiên bản mới.
+//   - Bản đang dùng đến từ Firebase: rule mới từ Firebase luôn được áp dụng.
+//   - Bản đang dùng được cấu hình trên PC: chỉ bị thay khi phụ huynh sửa rule
+//     trên Android (updatedAt) sau thời điểm lưu trên PC. Lần đọc lại rule cũ
+//     khi service khởi động không ghi đè cấu hình trên PC.
+type StoredTimeRules struct {
+	Version         int64     `json:"version"`
+	Source          string    `json:"source"`
+	Rules           TimeRules `json:"rules"`
+	UpdatedAt       time.Time `json:"updatedAt"`                 // Thời điểm lưu trên PC
+	SourceUpdatedAt time.Time `json:"sourceUpdatedAt,omitempty"` // Thời điểm phụ huynh sửa trên Android
+}
+
+// Load phiên bản rule mới nhất; cần gọi trước StartMonitoring
+func (tm *TimeManager) LoadStoredRules() error {
+	if tm.db == nil {
+		return nil
+	}
+
+	var record StoredTimeRules
+	var rules string
+	var sourceUpdatedAt int64
+	err := tm.db.QueryRow(`SELECT version, source, rules, source_updated_at, created_at
+		FROM time_rules ORDER BY version DESC LIMIT 1`).Scan(
+		&record.Version, &record.Source, &rules, &sourceUpdatedAt, &record.UpdatedAt)
+	if err == sql.ErrNoRows {
+		log.Println("📋 Chưa có time rules đã lưu")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(rules), &record.Rules); err != nil {
+		return fmt.Errorf("time rules version %d is corrupted: %v", record.Version, err)
+	}
+	if sourceUpdatedAt > 0 {
+		record.SourceUpdatedAt = time.UnixMilli(sourceUpdatedAt)
+	}
+
+	tm.mutex.Lock()
+	tm.rulesRecord = &record
+	tm.mutex.Unlock()
+
+	log.Printf("📋 Đã load time rules phiên bản %d (nguồn: %s)", record.Version, record.Source)
+	tm.UpdateRules(record.Rules)
+	return nil
+}
+
+// Lưu và áp dụng rule cấu hình trên PC
+func (tm *TimeManager) SaveLocalRules(rules TimeRules) (*StoredTimeRules, error) {
+	return tm.storeRules(rules, RulesSourceLocal, time.Time{})
+}
+
+// Áp dụng rule từ Firebase theo chính sách gộp của StoredTimeRules.
+// editedAt là lần phụ huynh sửa rule gần nhất trên Android.
+func (tm *TimeManager) ApplyFirebaseRules(rules TimeRules, editedAt time.Time) (bool, error) {
+	tm.mutex.RLock()
+	current := tm.rulesRecord
+	tm.mutex.RUnlock()
+
+	if current != nil {
+		if sameTimeRules(current.Rules, rules) {
+			return false, nil
+		}
+		if current.Source == RulesSourceLocal && !editedAt.After(current.UpdatedAt) {
+			log.Printf("📋 Giữ time rules cấu hình trên PC (phiên bản %d, lưu lúc %s), rule trên Firebase cũ hơn",
+				current.Version, current.UpdatedAt.Format("2006-01-02 15:04:05"))
+			return false, nil
+		}
+	}
+
+	if _, err := tm.storeRules(rules, RulesSourceFirebase, editedAt); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Lấy thông tin phiên bản rule đang dùng (nil nếu chưa có)
+func (tm *TimeManager) GetStoredRules() *StoredTimeRules {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	if tm.rulesRecord == nil {
+		return nil
+	}
+	record := *tm.rulesRecord
+	return &record
+}
+
+// Lưu phiên bản rule mới rồi áp dụng
+func (tm *TimeManager) storeRules(rules TimeRules, source string, sourceUpdatedAt time.Time) (*StoredTimeRules, error) {
+	tm.rulesStoreMutex.Lock()
+	defer tm.rulesStoreMutex.Unlock()
+
+	record := &StoredTimeRules{
+		Source:          source,
+		Rules:           rules,
+		UpdatedAt:       time.Now(),
+		SourceUpdatedAt: sourceUpdatedAt,
+	}
+
+	if tm.db != nil {
+		data, err := json.Marshal(rules)
+		if err != nil {
+			return nil, err
+		}
+
+		var sourceMillis int64
+		if !sourceUpdatedAt.IsZero() {
+			sourceMillis = sourceUpdatedAt.UnixMilli()
+		}
+
+		tx, err := tm.db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) + 1 FROM time_rules").Scan(&record.Version); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("INSERT INTO time_rules (version, source, rules, source_updated_at, created_at) VALUES (?, ?, ?, ?, ?)",
+			record.Version, source, string(data), sourceMillis, record.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("DELETE FROM time_rules WHERE version <= ?", record.Version-maxStoredRuleVersions); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	} else {
+		tm.mutex.RLock()
+		if tm.rulesRecord != nil {
+			record.Version = tm.rulesRecord.Version
+		}
+		tm.mutex.RUnlock()
+		record.Version++
+	}
+
+	tm.mutex.Lock()
+	tm.rulesRecord = record
+	tm.mutex.Unlock()
+
+	log.Printf("📋 Lưu time rules phiên bản %d (nguồn: %s)", record.Version, source)
+	tm.UpdateRules(rules)
+
+	saved := *record
+	return &saved, nil
+}
+
+func sameTimeRules(a, b TimeRules) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
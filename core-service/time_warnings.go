@@ -0,0 +1,267 @@
+// core-service/time_warnings.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Các mốc cảnh báo mặc định (phút trước khi bị chặn)
+var defaultWarningMinutes = []int{10, 5, 1}
+
+// Sự kiện chặn sắp xảy ra
+type TimeEvent struct {
+	Type             string    `json:"type"` // limit_reached | slot_ending | break_due | override_ending
+	At               time.Time `json:"at"`
+	MinutesRemaining int       `json:"minutes_remaining"`
+	SecondsRemaining int64     `json:"seconds_remaining"`
+	Message          string    `json:"message"`
+
+	key string // Định danh sự kiện để không cảnh báo lặp lại
+}
+
+// Thông tin thay đổi trạng thái tiếp theo, dành cho UI của trẻ và extension
+type NextChange struct {
+	Blocked   bool       `json:"blocked"`
+	Event     *TimeEvent `json:"event,omitempty"`      // Sự kiện chặn sắp tới (khi đang được dùng)
+	UnblockAt *time.Time `json:"unblock_at,omitempty"` // Thời điểm được mở lại (khi đang bị chặn)
+}
+
+// Set callback nhận cảnh báo trước khi chặn
+func (tm *TimeManager) SetWarningCallback(callback func(event TimeEvent, leadMinutes int)) {
+	tm.onWarning = callback
+}
+
+// Lấy usage hôm nay bao gồm cả session đang chạy (yêu cầu đã giữ mutex)
+func (tm *TimeManager) liveUsageLocked(now time.Time) int64 {
+	var total int64
+	if usage, exists := tm.dailyUsage[now.Format(usageDateLayout)]; exists {
+		total = usage.Total
+	}
+
+	if !tm.sessionStartTime.IsZero() {
+		start := tm.sessionStartTime
+		if dayStart := startOfDay(now); start.Before(dayStart) {
+			start = dayStart
+		}
+		total += int64(tm.activeDurationLocked(start, now).Minutes())
+	}
+	return total
+}
+
+// Lấy usage hôm nay bao gồm cả session đang chạy
+func (tm *TimeManager) getLiveTodayUsage() int64 {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return tm.liveUsageLocked(time.Now())
+}
+
+// Kiểm tra tại thời điểm t có nằm trong khung giờ được phép dùng không (yêu cầu đã giữ mutex)
+func (tm *TimeManager) isTimeAllowedAt(t time.Time) bool {
+	rule, _ := tm.ruleForDate(t)
+	if !rule.Enabled {
+		return true
+	}
+	prevRule, _ := tm.ruleForDate(t.AddDate(0, 0, -1))
+	return tm.isInAllowedTimeSlot(rule, prevRule, t) && !tm.isInBlockedTimeSlot(rule, prevRule, t)
+}
+
+// Giới hạn hàng ngày đã cộng thời gian thưởng (yêu cầu đã giữ mutex). 0 = không giới hạn
+func (tm *TimeManager) effectiveLimitLocked(t time.Time) int {
+	rule, _ := tm.ruleForDate(t)
+	if !rule.Enabled || rule.DailyLimitMinutes == 0 {
+		return 0
+	}
+	return rule.DailyLimitMinutes + tm.bonusMinutesLocked(t.Format(usageDateLayout))
+}
+
+// Tính các sự kiện chặn sắp xảy ra, sắp xếp theo thời gian
+func (tm *TimeManager) upcomingEventsLocked(now time.Time) []TimeEvent {
+	if tm.rules == nil || tm.isBlocked {
+		return nil
+	}
+
+	// Đang được phụ huynh cho phép: chỉ còn sự kiện hết hạn cho phép
+	if override := tm.manualOverrideLocked(now); override != nil && override.Mode != ManualBlock {
+		return tm.manualOverrideEventsLocked(now, override)
+	}
+
+	rule, _ := tm.ruleForDate(now)
+	if !rule.Enabled {
+		return nil
+	}
+
+	var events []TimeEvent
+
+	// 1. Hết giới hạn thời gian trong ngày
+	if limit := tm.effectiveLimitLocked(now); limit > 0 {
+		remaining := int64(limit) - tm.familyUsageLocked(now)
+		if remaining < 0 {
+			remaining = 0
+		}
+		at := now.Add(time.Duration(remaining) * time.Minute)
+		// Giới hạn được tính lại từ đầu vào ngày mới
+		if at.Before(startOfDay(now).AddDate(0, 0, 1)) {
+			events = append(events, TimeEvent{
+				Type:    "limit_reached",
+				At:      at,
+				Message: fmt.Sprintf("Sắp hết %d phút sử dụng hôm nay", limit),
+				key:     "limit_reached@" + now.Format(usageDateLayout),
+			})
+		}
+	}
+
+	// 2. Hết khung giờ cho phép (quét từng phút trong 24 giờ tới)
+	t := now.Truncate(time.Minute).Add(time.Minute)
+	for i := 0; i < 24*60; i++ {
+		if !tm.isTimeAllowedAt(t) {
+			events = append(events, TimeEvent{
+				Type:    "slot_ending",
+				At:      t,
+				Message: "Sắp hết khung giờ được phép sử dụng",
+				key:     "slot_ending@" + t.Format(time.RFC3339),
+			})
+			break
+		}
+		t = t.Add(time.Minute)
+	}
+
+	// 3. Đến giờ nghỉ ngơi bắt buộc
+	if rule.BreakIntervalMinutes > 0 && rule.BreakDurationMinutes > 0 && !tm.sessionStartTime.IsZero() && !tm.isBreakTime {
+		breakDuration := time.Duration(rule.BreakDurationMinutes) * time.Minute
+		active := tm.activeDurationLocked(tm.breakCounterStartLocked(breakDuration), now)
+		events = append(events, TimeEvent{
+			Type:    "break_due",
+			At:      now.Add(time.Duration(rule.BreakIntervalMinutes)*time.Minute - active),
+			Message: fmt.Sprintf("Sắp đến giờ nghỉ ngơi %d phút", rule.BreakDurationMinutes),
+			key:     "break_due@" + tm.sessionStartTime.Format(time.RFC3339Nano),
+		})
+	}
+
+	for i := range events {
+		remaining := events[i].At.Sub(now)
+		if remaining < 0 {
+			remaining = 0
+		}
+		events[i].SecondsRemaining = int64(remaining.Seconds())
+		events[i].MinutesRemaining = int(remaining.Minutes())
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	return events
+}
+
+// Tính thời điểm được mở lại khi đang bị chặn (yêu cầu đã giữ mutex)
+func (tm *TimeManager) unblockTimeLocked(now time.Time) *time.Time {
+	// Phụ huynh chặn thủ công: tìm từ lúc hết hạn chặn
+	t := now.Truncate(time.Minute).Add(time.Minute)
+	manualBlock := false
+	if override := tm.manualOverrideLocked(now); override != nil && override.Mode == ManualBlock {
+		if !now.Before(override.ExpiresAt) {
+			return nil // Giữ chặn vì đồng hồ bị chỉnh
+		}
+		if tm.rules == nil {
+			at := override.ExpiresAt
+			return &at
+		}
+		t = override.ExpiresAt
+		manualBlock = true
+	}
+
+	if tm.rules == nil {
+		return nil
+	}
+
+	rule, _ := tm.ruleForDate(now)
+
+	// Đang nghỉ ngơi bắt buộc
+	if tm.isBreakTime && rule.BreakDurationMinutes > 0 && !manualBlock {
+		at := tm.lastBreakTime.Add(time.Duration(rule.BreakDurationMinutes) * time.Minute)
+		return &at
+	}
+
+	// Quét tối đa 48 giờ để tìm phút đầu tiên được phép dùng
+	for i := 0; i < 48*60; i++ {
+		limit := tm.effectiveLimitLocked(t)
+		withinLimit := limit == 0 || !sameDay(t, now) || tm.familyUsageLocked(now) < int64(limit)
+		if tm.isTimeAllowedAt(t) && withinLimit {
+			return &t
+		}
+		t = t.Add(time.Minute)
+	}
+	return nil
+}
+
+// Lấy thông tin thay đổi trạng thái tiếp theo
+func (tm *TimeManager) GetNextChange() NextChange {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	now := time.Now()
+	result := NextChange{Blocked: tm.isBlocked}
+
+	if tm.isBlocked {
+		result.UnblockAt = tm.unblockTimeLocked(now)
+		return result
+	}
+
+	if events := tm.upcomingEventsLocked(now); len(events) > 0 {
+		result.Event = &events[0]
+	}
+	return result
+}
+
+// Gửi cảnh báo khi sự kiện chặn sắp tới rơi vào một trong các mốc cảnh báo.
+// Mỗi mốc chỉ được cảnh báo một lần cho mỗi sự kiện.
+func (tm *TimeManager) checkUpcomingWarnings() {
+	tm.mutex.Lock()
+
+	now := time.Now()
+	events := tm.upcomingEventsLocked(now)
+	if len(events) == 0 {
+		tm.warnedEventKey = ""
+		tm.mutex.Unlock()
+		return
+	}
+
+	event := events[0]
+	if event.key != tm.warnedEventKey {
+		tm.warnedEventKey = event.key
+		tm.warnedLeads = make(map[int]bool)
+	}
+
+	leads := defaultWarningMinutes
+	if len(tm.rules.WarningMinutes) > 0 {
+		leads = tm.rules.WarningMinutes
+	}
+
+	// Chỉ gửi mốc nhỏ nhất đã tới, đánh dấu các mốc lớn hơn là đã qua
+	lead := -1
+	remaining := event.At.Sub(now)
+	for _, l := range leads {
+		if remaining <= time.Duration(l)*time.Minute && !tm.warnedLeads[l] {
+			tm.warnedLeads[l] = true
+			if lead == -1 || l < lead {
+				lead = l
+			}
+		}
+	}
+	callback := tm.onWarning
+	tm.mutex.Unlock()
+
+	if lead == -1 {
+		return
+	}
+
+	log.Printf("⚠️ Cảnh báo: %s sau %d phút (%s)", event.Type, event.MinutesRemaining, event.Message)
+	if callback != nil {
+		go callback(event, lead)
+	}
+}
+
+// sameDay cho biết hai thời điểm có cùng ngày theo giờ địa phương không
+func sameDay(a, b time.Time) bool {
+	return a.Format(usageDateLayout) == b.Format(usageDateLayout)
+}
@@ -0,0 +1,294 @@
+// core-service/usage_store.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Lưu trữ usage trong SQLite (bảng usage_days, usage_sessions, usage_checkpoint).
+// dailyUsage trong TimeManager chỉ là cache tổng theo ngày cho các ngày gần đây.
+
+// Số ngày gần nhất được nạp sẵn vào cache khi khởi động
+const usageCacheDays = 2
+
+// Checkpoint không đọc được nội dung (khác với lỗi truy vấn DB, có thể thử lại)
+var errCorruptCheckpoint = errors.New("corrupt session checkpoint")
+
+// Đọc usage của một ngày vào cache nếu chưa có (yêu cầu đã giữ mutex ghi)
+func (tm *TimeManager) usageForDateLocked(date string) *DailyUsage {
+	if usage, exists := tm.dailyUsage[date]; exists {
+		return usage
+	}
+
+	usage := &DailyUsage{Date: date}
+	if tm.db != nil {
+		err := tm.db.QueryRow("SELECT total_minutes, adjustment_minutes FROM usage_days WHERE date = ?", date).
+			Scan(&usage.Total, &usage.Adjustments)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("⚠️ Không đọc được usage ngày %s: %v", date, err)
+		}
+	}
+
+	tm.dailyUsage[date] = usage
+	return usage
+}
+
+// Ghi tổng usage của một ngày (yêu cầu đã giữ mutex)
+func (tm *TimeManager) storeDayLocked(usage *DailyUsage) error {
+	if tm.db == nil {
+		return nil
+	}
+
+	_, err := tm.db.Exec(`INSERT INTO usage_days (date, total_minutes, adjustment_minutes) VALUES (?, ?, ?)
+		ON CONFLICT(date) DO UPDATE SET total_minutes = excluded.total_minutes, adjustment_minutes = excluded.adjustment_minutes`,
+		usage.Date, usage.Total, usage.Adjustments)
+	return err
+}
+
+// Ghi một session và tổng mới của ngày trong cùng transaction (yêu cầu đã giữ mutex)
+func (tm *TimeManager) storeSessionLocked(usage *DailyUsage, session UsageSession) error {
+	if tm.db == nil {
+		return nil
+	}
+
+	tx, err := tm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertUsageSession(tx, usage.Date, session); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO usage_days (date, total_minutes, adjustment_minutes) VALUES (?, ?, ?)
+		ON CONFLICT(date) DO UPDATE SET total_minutes = excluded.total_minutes, adjustment_minutes = excluded.adjustment_minutes`,
+		usage.Date, usage.Total, usage.Adjustments)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Xóa toàn bộ usage của một ngày (yêu cầu đã giữ mutex)
+func (tm *TimeManager) deleteDayLocked(date string) error {
+	delete(tm.dailyUsage, date)
+	if tm.db == nil {
+		return nil
+	}
+
+	tx, err := tm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM usage_sessions WHERE usage_date = ?", date); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM usage_days WHERE date = ?", date); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertUsageSession ghi một dòng usage_sessions
+func insertUsageSession(tx *sql.Tx, date string, session UsageSession) error {
+	var gaps []byte
+	if len(session.IdleGaps) > 0 {
+		gaps, _ = json.Marshal(session.IdleGaps)
+	}
+
+	_, err := tx.Exec(`INSERT INTO usage_sessions (usage_date, start_time, end_time, duration_minutes, idle_minutes, idle_gaps)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		date, session.StartTime.Format(time.RFC3339Nano), session.EndTime.Format(time.RFC3339Nano),
+		session.Duration, session.IdleMinutes, string(gaps))
+	return err
+}
+
+// Đọc usage theo ngày trong khoảng [fromDate, toDate] từ SQLite
+func (tm *TimeManager) queryUsageRange(fromDate, toDate string, includeSessions bool) (map[string]*DailyUsage, error) {
+	result := make(map[string]*DailyUsage)
+
+	rows, err := tm.db.Query("SELECT date, total_minutes, adjustment_minutes FROM usage_days WHERE date BETWEEN ? AND ?", fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		usage := &DailyUsage{Sessions: []UsageSession{}}
+		if err := rows.Scan(&usage.Date, &usage.Total, &usage.Adjustments); err != nil {
+			continue
+		}
+		result[usage.Date] = usage
+	}
+
+	if !includeSessions {
+		return result, nil
+	}
+
+	sessionRows, err := tm.db.Query(`SELECT usage_date, start_time, end_time, duration_minutes, idle_minutes, idle_gaps
+		FROM usage_sessions WHERE usage_date BETWEEN ? AND ? ORDER BY start_time`, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	defer sessionRows.Close()
+
+	for sessionRows.Next() {
+		var date, start, end string
+		var gaps sql.NullString
+		var session UsageSession
+		if err := sessionRows.Scan(&date, &start, &end, &session.Duration, &session.IdleMinutes, &gaps); err != nil {
+			continue
+		}
+		session.StartTime, _ = time.Parse(time.RFC3339Nano, start)
+		session.EndTime, _ = time.Parse(time.RFC3339Nano, end)
+		if gaps.Valid && gaps.String != "" {
+			json.Unmarshal([]byte(gaps.String), &session.IdleGaps)
+		}
+
+		usage := result[date]
+		if usage == nil {
+			usage = &DailyUsage{Date: date, Sessions: []UsageSession{}}
+			result[date] = usage
+		}
+		usage.Sessions = append(usage.Sessions, session)
+	}
+
+	return result, nil
+}
+
+// Nạp tổng usage của các ngày gần đây vào cache
+func (tm *TimeManager) loadRecentUsage() {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	now := time.Now()
+	for i := 0; i < usageCacheDays; i++ {
+		tm.usageForDateLocked(now.AddDate(0, 0, -i).Format(usageDateLayout))
+	}
+}
+
+// Nhập dữ liệu từ file JSON cũ (time_usage.json) vào SQLite ở lần khởi động đầu tiên.
+// Sau khi nhập, file được đổi tên thành *.imported để không nhập lại.
+func (tm *TimeManager) importLegacyUsageFile() error {
+	if tm.db == nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(tm.usageDataFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var existing int
+	if err := tm.db.QueryRow("SELECT COUNT(*) FROM usage_days").Scan(&existing); err != nil {
+		return err
+	}
+	if existing > 0 {
+		log.Printf("⚠️ Bảng usage đã có dữ liệu, bỏ qua nhập file %s", tm.usageDataFile)
+		return nil
+	}
+
+	var legacy map[string]*DailyUsage
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return fmt.Errorf("invalid legacy usage file: %v", err)
+	}
+
+	tx, err := tm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sessions := 0
+	for date, usage := range legacy {
+		if usage == nil {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO usage_days (date, total_minutes, adjustment_minutes) VALUES (?, ?, ?)",
+			date, usage.Total, usage.Adjustments); err != nil {
+			return err
+		}
+		for _, session := range usage.Sessions {
+			if err := insertUsageSession(tx, date, session); err != nil {
+				return err
+			}
+			sessions++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("📦 Đã nhập %d ngày (%d session) từ %s vào SQLite", len(legacy), sessions, tm.usageDataFile)
+	return os.Rename(tm.usageDataFile, tm.usageDataFile+".imported")
+}
+
+// Ghi checkpoint của session đang chạy
+func (tm *TimeManager) checkpointSession() error {
+	tm.mutex.RLock()
+	if tm.sessionStartTime.IsZero() || tm.db == nil {
+		tm.mutex.RUnlock()
+		return nil
+	}
+	checkpoint := sessionCheckpoint{
+		StartTime:      tm.sessionStartTime,
+		LastCheckpoint: time.Now(),
+		IdleSince:      tm.idleSince,
+		IdleGaps:       tm.idleGaps,
+	}
+	tm.mutex.RUnlock()
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	_, err = tm.db.Exec("INSERT OR REPLACE INTO usage_checkpoint (id, data, updated_at) VALUES (1, ?, CURRENT_TIMESTAMP)", string(data))
+	return err
+}
+
+// Xóa checkpoint khi session đã được ghi nhận
+func (tm *TimeManager) clearSessionCheckpoint() {
+	if tm.db == nil {
+		return
+	}
+	if _, err := tm.db.Exec("DELETE FROM usage_checkpoint WHERE id = 1"); err != nil {
+		log.Printf("⚠️ Không thể xóa checkpoint session: %v", err)
+	}
+}
+
+// Đọc checkpoint session còn lại từ lần chạy trước (nil nếu không có)
+func (tm *TimeManager) loadSessionCheckpoint() (*sessionCheckpoint, error) {
+	if tm.db == nil {
+		return nil, nil
+	}
+
+	var data string
+	err := tm.db.QueryRow("SELECT data FROM usage_checkpoint WHERE id = 1").Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint sessionCheckpoint
+	if err := json.Unmarshal([]byte(data), &checkpoint); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptCheckpoint, err)
+	}
+	return &checkpoint, nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// How often today's usage is published to Firebase
+const usageUploadInterval = 5 * time.Minute
+
+// Days after the last successful upload that are queued again after a long offline period
+const maxUsageCatchUpDays = 14
+
+// Key in service_state holding the last date uploaded successfully
+const usageUploadedDateKey = "pc_usage_uploaded_date"
+
+// PCUsageReport is written to kidsafe/families/{uid}/pcUsage/{date} for the parent app
+type PCUsageReport struct {
+	Date         string           `json:"date"`
+	TotalMinutes int64            `json:"totalMinutes"`
+	IdleMinutes  int64            `json:"idleMinutes"`
+	Sessions     []PCUsageSession `json:"sessions"`
+	BlockEvents  []PCBlockEvent   `json:"blockEvents"`
+	Status       *PCTimeStatus    `json:"status,omitempty"` // Only in today's report
+	UpdatedAt    int64            `json:"updatedAt"`
+}
+
+// PCUsageSession is one stretch of use, timestamps in milliseconds
+type PCUsageSession struct {
+	Start       int64 `json:"start"`
+	End         int64 `json:"end"`
+	Minutes     int64 `json:"minutes"`
+	IdleMinutes int64 `json:"idleMinutes,omitempty"`
+}
+
+// PCBlockEvent records a time-based block or unblock
+type PCBlockEvent struct {
+	At      int64  `json:"at"`
+	Blocked bool   `json:"blocked"`
+	Reason  string `json:"reason"`
+}
+
+// PCTimeStatus is the current time status of the PC
+type PCTimeStatus struct {
+	Blocked           bool   `json:"blocked"`
+	RuleName          string `json:"ruleName,omitempty"`
+	DailyLimitMinutes int    `json:"dailyLimitMinutes"` // Including bonus time, 0 = no limit
+	RemainingMinutes  int64  `json:"remainingMinutes"`  // -1 when there is no limit
+	ManualOverride    string `json:"manualOverride,omitempty"`
+	NextChangeAt      int64  `json:"nextChangeAt,omitempty"`
+}
+
+// queueUsageUpload marks a day as changed so its report is uploaded on the next flush
+func queueUsageUpload(db *sql.DB, date string) {
+	_, err := db.Exec(`INSERT INTO usage_upload_queue (usage_date, revision, queued_at) VALUES (?, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT(usage_date) DO UPDATE SET revision = revision + 1, queued_at = CURRENT_TIMESTAMP`, date)
+	if err != nil {
+		log.Printf("Warning: could not queue usage upload for %s: %v", date, err)
+	}
+}
+
+// recordBlockEvent stores a block/unblock for the usage report and publishes it
+func (s *CoreService) recordBlockEvent(blocked bool, reason string) {
+	now := time.Now()
+	date := now.Format(usageDateLayout)
+
+	_, err := s.db.Exec("INSERT INTO time_block_events (usage_date, blocked, reason, created_at) VALUES (?, ?, ?, ?)",
+		date, blocked, reason, now)
+	if err != nil {
+		log.Printf("Warning: could not record block event: %v", err)
+	}
+
+	queueUsageUpload(s.db, date)
+	if s.firebaseService != nil {
+		go s.firebaseService.flushUsageQueue()
+	}
+}
+
+// buildUsageReport collects usage, sessions and block events of one day from SQLite
+func (s *CoreService) buildUsageReport(date string) (*PCUsageReport, error) {
+	day, err := time.ParseInLocation(usageDateLayout, date, time.Local)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.timeManager.GetUsageHistory(day, day, true)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PCUsageReport{
+		Date:        date,
+		Sessions:    []PCUsageSession{},
+		BlockEvents: []PCBlockEvent{},
+		UpdatedAt:   time.Now().UnixMilli(),
+	}
+	if len(history) > 0 {
+		report.TotalMinutes = history[0].Total
+		for _, session := range history[0].Sessions {
+			report.IdleMinutes += session.IdleMinutes
+			report.Sessions = append(report.Sessions, PCUsageSession{
+				Start:       session.StartTime.UnixMilli(),
+				End:         session.EndTime.UnixMilli(),
+				Minutes:     session.Duration,
+				IdleMinutes: session.IdleMinutes,
+			})
+		}
+	}
+
+	rows, err := s.db.Query("SELECT blocked, reason, created_at FROM time_block_events WHERE usage_date = ? ORDER BY id", date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event PCBlockEvent
+		var reason sql.NullString
+		var at time.Time
+		if err := rows.Scan(&event.Blocked, &reason, &at); err != nil {
+			continue
+		}
+		event.Reason = reason.String
+		event.At = at.UnixMilli()
+		report.BlockEvents = append(report.BlockEvents, event)
+	}
+
+	if date == time.Now().Format(usageDateLayout) {
+		report.Status = s.currentTimeStatus()
+		if live, ok := s.timeManager.GetStatus()["today_usage"].(int64); ok {
+			report.TotalMinutes = live // Includes the session still running
+		}
+	}
+	return report, nil
+}
+
+// currentTimeStatus summarizes TimeManager.GetStatus for the parent app
+func (s *CoreService) currentTimeStatus() *PCTimeStatus {
+	status := s.timeManager.GetStatus()
+
+	result := &PCTimeStatus{RemainingMinutes: -1}
+	result.Blocked, _ = status["is_blocked"].(bool)
+	result.RuleName, _ = status["rule_name"].(string)
+	if override, ok := status["manual_override"].(ManualOverride); ok {
+		result.ManualOverride = override.Mode
+	}
+
+	if limit, ok := status["effective_daily_limit"].(int); ok && limit > 0 {
+		result.DailyLimitMinutes = limit
+		used, _ := status["family_usage"].(int64)
+		result.RemainingMinutes = int64(limit) - used
+		if result.RemainingMinutes < 0 {
+			result.RemainingMinutes = 0
+		}
+	}
+
+	next := s.timeManager.GetNextChange()
+	if next.UnblockAt != nil {
+		result.NextChangeAt = next.UnblockAt.UnixMilli()
+	} else if next.Event != nil {
+		result.NextChangeAt = next.Event.At.UnixMilli()
+	}
+	return result
+}
+
+// uploadUsagePeriodically publishes today's usage on a schedule and retries the
+// days queued while the PC was offline
+func (fs *FirebaseService) uploadUsagePeriodically() {
+	ticker := time.NewTicker(usageUploadInterval)
+	defer ticker.Stop()
+
+	fs.queuePendingUsageDays()
+	fs.flushUsageQueue()
+
+	for {
+		select {
+		case <-ticker.C:
+			fs.queuePendingUsageDays()
+			fs.flushUsageQueue()
+		case <-fs.ctx.Done():
+			return
+		}
+	}
+}
+
+// queuePendingUsageDays queues today and every day since the last successful upload
+func (fs *FirebaseService) queuePendingUsageDays() {
+	today := startOfDay(time.Now())
+	from := today
+
+	var lastDate string
+	err := fs.database.QueryRow("SELECT value FROM service_state WHERE key = ?", usageUploadedDateKey).Scan(&lastDate)
+	if err == nil {
+		if last, err := time.ParseInLocation(usageDateLayout, lastDate, time.Local); err == nil && last.Before(today) {
+			from = last
+		}
+	}
+	if oldest := today.AddDate(0, 0, -maxUsageCatchUpDays); from.Before(oldest) {
+		from = oldest
+	}
+
+	for day := from; !day.After(today); day = day.AddDate(0, 0, 1) {
+		queueUsageUpload(fs.database, day.Format(usageDateLayout))
+	}
+}
+
+// flushUsageQueue uploads every queued day, oldest first. A day that changes
+// while it is being uploaded stays queued for the next flush.
+func (fs *FirebaseService) flushUsageQueue() {
+	if fs.coreService == nil || fs.coreService.timeManager == nil {
+		return
+	}
+
+	fs.usageUploadMutex.Lock()
+	defer fs.usageUploadMutex.Unlock()
+
+	type queuedDay struct {
+		date     string
+		revision int64
+	}
+
+	rows, err := fs.database.Query("SELECT usage_date, revision FROM usage_upload_queue ORDER BY usage_date")
+	if err != nil {
+		log.Printf("❌ Error reading usage upload queue: %v", err)
+		return
+	}
+	var queue []queuedDay
+	for rows.Next() {
+		var day queuedDay
+		if err := rows.Scan(&day.date, &day.revision); err == nil {
+			queue = append(queue, day)
+		}
+	}
+	rows.Close()
+
+	uploaded := 0
+	for _, day := range queue {
+		if err := fs.uploadUsageReport(day.date); err != nil {
+			fs.database.Exec("UPDATE usage_upload_queue SET attempts = attempts + 1, last_error = ? WHERE usage_date = ?",
+				err.Error(), day.date)
+			log.Printf("⚠️ Usage for %s not uploaded, will retry: %v", day.date, err)
+			return // Most likely offline, keep the rest for the next flush
+		}
+
+		fs.database.Exec("DELETE FROM usage_upload_queue WHERE usage_date = ? AND revision = ?", day.date, day.revision)
+		fs.database.Exec(`INSERT INTO service_state (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(key) DO UPDATE SET value = MAX(value, excluded.value), updated_at = CURRENT_TIMESTAMP`,
+			usageUploadedDateKey, day.date)
+		uploaded++
+	}
+
+	if uploaded > 0 {
+		log.Printf("[FIREBASE] Usage uploaded for %d day(s)", uploaded)
+	}
+}
+
+// uploadUsageReport writes one day's report to Firebase
+func (fs *FirebaseService) uploadUsageReport(date string) error {
+	report, err := fs.coreService.buildUsageReport(date)
+	if err != nil {
+		return fmt.Errorf("could not build report: %v", err)
+	}
+
+	return fs.backend.Set(fs.ctx, fmt.Sprintf("kidsafe/families/%s/pcUsage/%s", fs.familyID, date), report)
+}
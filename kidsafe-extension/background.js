@@ -211,6 +211,41 @@ function updateBadge() {
   });
 }
 
+// Report the active site to KidSafe PC once a minute (used for per-site time budgets)
+const KIDSAFE_API = 'http://127.0.0.1:8081/api/v1';
+
+chrome.alarms.create('reportActivity', { periodInMinutes: 1 });
+
+chrome.alarms.onAlarm.addListener((alarm) => {
+  if (alarm.name === 'reportActivity') {
+    reportActiveTab();
+  }
+});
+
+function reportActiveTab() {
+  chrome.windows.getLastFocused({ populate: false }, (window) => {
+    if (chrome.runtime.lastError || !window || !window.focused) {
+      return;
+    }
+
+    chrome.tabs.query({ active: true, windowId: window.id }, (tabs) => {
+      const tab = tabs && tabs[0];
+      if (!tab || !tab.url || !/^https?:/.test(tab.url)) {
+        return;
+      }
+
+      fetch(`${KIDSAFE_API}/activity/visits`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ visits: [{ url: tab.url, seconds: 60 }] })
+      }).catch((error) => {
+        // Core service not running, nothing to report to
+        console.log('KidSafe PC: Activity report failed:', error);
+      });
+    });
+  });
+}
+
 // Update badge periodically
 setInterval(updateBadge, 5000);
 updateBadge(); // Initial update